@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/Azmekk/Vidra/backend/services"
+	"github.com/Azmekk/Vidra/backend/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type CollectionHandler struct {
+	Queries *database.Queries
+	Tags    *services.TagService
+}
+
+func NewCollectionHandler(queries *database.Queries, tags *services.TagService) *CollectionHandler {
+	return &CollectionHandler{
+		Queries: queries,
+		Tags:    tags,
+	}
+}
+
+type CollectionResponse struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	VideoCount  int64  `json:"videoCount"`
+	CreatedAt   string `json:"createdAt"`
+	UpdatedAt   string `json:"updatedAt"`
+}
+
+type CollectionDetailResponse struct {
+	CollectionResponse
+	Videos []VideoResponse `json:"videos"`
+}
+
+func mapCollectionToResponse(c database.Collection) CollectionResponse {
+	return CollectionResponse{
+		ID:          c.ID.String(),
+		Name:        c.Name,
+		Description: c.Description,
+		CreatedAt:   c.CreatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:   c.UpdatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+type CollectionRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func (r *CollectionRequest) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	return nil
+}
+
+type AddCollectionVideoRequest struct {
+	VideoID string `json:"videoId"`
+}
+
+type ReorderCollectionRequest struct {
+	VideoIDs []string `json:"videoIds"` // the collection's videos in their new order
+}
+
+// ListCollections godoc
+// @Summary List collections
+// @Description Get all collections with the number of videos in each
+// @ID listCollections
+// @Tags collections
+// @Produce json
+// @Success 200 {array} CollectionResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/collections [get]
+func (h *CollectionHandler) ListCollections(w http.ResponseWriter, r *http.Request) {
+	collections, err := h.Queries.ListCollections(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	responses := make([]CollectionResponse, len(collections))
+	for i, c := range collections {
+		responses[i] = CollectionResponse{
+			ID:          c.ID.String(),
+			Name:        c.Name,
+			Description: c.Description,
+			VideoCount:  c.VideoCount,
+			CreatedAt:   c.CreatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+			UpdatedAt:   c.UpdatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+		}
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, responses)
+}
+
+// CreateCollection godoc
+// @Summary Create a collection
+// @Description Create an empty, user-defined ordered list of videos
+// @ID createCollection
+// @Tags collections
+// @Accept json
+// @Produce json
+// @Param collection body CollectionRequest true "Collection details"
+// @Success 201 {object} CollectionResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/collections [post]
+func (h *CollectionHandler) CreateCollection(w http.ResponseWriter, r *http.Request) {
+	var req CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	collection, err := h.Queries.CreateCollection(r.Context(), database.CreateCollectionParams{
+		Name:        req.Name,
+		Description: req.Description,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, mapCollectionToResponse(collection))
+}
+
+// GetCollection godoc
+// @Summary Get a collection
+// @Description Get a collection and its videos in order
+// @ID getCollection
+// @Tags collections
+// @Produce json
+// @Param id path string true "Collection ID"
+// @Success 200 {object} CollectionDetailResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/collections/{id} [get]
+func (h *CollectionHandler) GetCollection(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid collection ID")
+		return
+	}
+
+	collection, err := h.Queries.GetCollection(r.Context(), id)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+
+	videos, err := h.Queries.ListCollectionVideos(r.Context(), id)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := CollectionDetailResponse{
+		CollectionResponse: mapCollectionToResponse(collection),
+		Videos:             mapVideosWithTags(r.Context(), h.Tags, videos),
+	}
+	resp.VideoCount = int64(len(videos))
+
+	utils.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// UpdateCollection godoc
+// @Summary Update a collection
+// @Description Update the name and description of a collection
+// @ID updateCollection
+// @Tags collections
+// @Accept json
+// @Produce json
+// @Param id path string true "Collection ID"
+// @Param collection body CollectionRequest true "Collection details"
+// @Success 200 {object} CollectionResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/collections/{id} [put]
+func (h *CollectionHandler) UpdateCollection(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid collection ID")
+		return
+	}
+
+	var req CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	collection, err := h.Queries.UpdateCollection(r.Context(), database.UpdateCollectionParams{
+		ID:          id,
+		Name:        req.Name,
+		Description: req.Description,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, mapCollectionToResponse(collection))
+}
+
+// DeleteCollection godoc
+// @Summary Delete a collection
+// @Description Delete a collection. The videos in it are kept.
+// @ID deleteCollection
+// @Tags collections
+// @Param id path string true "Collection ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/collections/{id} [delete]
+func (h *CollectionHandler) DeleteCollection(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid collection ID")
+		return
+	}
+
+	if err := h.Queries.DeleteCollection(r.Context(), id); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddCollectionVideo godoc
+// @Summary Add a video to a collection
+// @Description Append a video to the end of a collection. Adding a video that is already in it does nothing.
+// @ID addCollectionVideo
+// @Tags collections
+// @Accept json
+// @Param id path string true "Collection ID"
+// @Param request body AddCollectionVideoRequest true "Video"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/collections/{id}/videos [post]
+func (h *CollectionHandler) AddCollectionVideo(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid collection ID")
+		return
+	}
+
+	var req AddCollectionVideoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	var videoID pgtype.UUID
+	if err := videoID.Scan(req.VideoID); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	if _, err := h.Queries.GetCollection(r.Context(), id); err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+	if _, err := h.Queries.GetVideo(r.Context(), videoID); err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Video not found")
+		return
+	}
+
+	if err := h.Queries.AddCollectionVideo(r.Context(), database.AddCollectionVideoParams{
+		CollectionID: id,
+		VideoID:      videoID,
+	}); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveCollectionVideo godoc
+// @Summary Remove a video from a collection
+// @Description Remove a video from a collection without deleting it
+// @ID removeCollectionVideo
+// @Tags collections
+// @Param id path string true "Collection ID"
+// @Param videoId path string true "Video ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/collections/{id}/videos/{videoId} [delete]
+func (h *CollectionHandler) RemoveCollectionVideo(w http.ResponseWriter, r *http.Request) {
+	var id, videoID pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid collection ID")
+		return
+	}
+	if err := videoID.Scan(chi.URLParam(r, "videoId")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	if err := h.Queries.RemoveCollectionVideo(r.Context(), database.RemoveCollectionVideoParams{
+		CollectionID: id,
+		VideoID:      videoID,
+	}); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReorderCollection godoc
+// @Summary Reorder a collection
+// @Description Set the order of the videos in a collection. Videos not listed keep their position after the listed ones.
+// @ID reorderCollection
+// @Tags collections
+// @Accept json
+// @Param id path string true "Collection ID"
+// @Param request body ReorderCollectionRequest true "Video IDs in order"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/collections/{id}/order [put]
+func (h *CollectionHandler) ReorderCollection(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid collection ID")
+		return
+	}
+
+	var req ReorderCollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	videoIDs := make([]pgtype.UUID, len(req.VideoIDs))
+	for i, idStr := range req.VideoIDs {
+		if err := videoIDs[i].Scan(idStr); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid video ID: "+idStr)
+			return
+		}
+	}
+
+	if _, err := h.Queries.GetCollection(r.Context(), id); err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+
+	if err := h.Queries.ReorderCollectionVideos(r.Context(), database.ReorderCollectionVideosParams{
+		VideoIds:     videoIDs,
+		CollectionID: id,
+	}); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
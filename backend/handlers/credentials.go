@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/Azmekk/Vidra/backend/services"
+	"github.com/Azmekk/Vidra/backend/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type CredentialHandler struct {
+	Queries     *database.Queries
+	Credentials *services.CredentialService
+}
+
+func NewCredentialHandler(queries *database.Queries, credentials *services.CredentialService) *CredentialHandler {
+	return &CredentialHandler{
+		Queries:     queries,
+		Credentials: credentials,
+	}
+}
+
+type SiteCredentialRequest struct {
+	Domain   string  `json:"domain"`             // also covers its subdomains, e.g. youtube.com for www.youtube.com
+	Cookies  *string `json:"cookies,omitempty"`  // Netscape cookie file; omit to keep, empty to remove
+	Username *string `json:"username,omitempty"` // omit to keep the login, empty to remove it
+	Password string  `json:"password,omitempty"`
+}
+
+func (r *SiteCredentialRequest) Validate() error {
+	domain, err := services.NormalizeCredentialDomain(r.Domain)
+	if err != nil {
+		return err
+	}
+	r.Domain = domain
+	if r.Cookies != nil {
+		if err := services.ValidateCookies(*r.Cookies); err != nil {
+			return err
+		}
+	}
+	if r.Username != nil && *r.Username != "" && r.Password == "" {
+		return fmt.Errorf("password is required with a username")
+	}
+	return nil
+}
+
+func (r *SiteCredentialRequest) input() services.CredentialInput {
+	input := services.CredentialInput{Domain: r.Domain, Cookies: r.Cookies}
+	if r.Username != nil {
+		input.Login = &services.SiteLogin{Username: *r.Username, Password: r.Password}
+	}
+	return input
+}
+
+// ListSiteCredentials godoc
+// @Summary List site credentials
+// @Description Get the domains with stored cookies or logins. The secrets themselves are never returned.
+// @ID listSiteCredentials
+// @Tags credentials
+// @Produce json
+// @Success 200 {array} services.SiteCredentialDTO
+// @Failure 500 {object} map[string]string
+// @Router /api/credentials [get]
+func (h *CredentialHandler) ListSiteCredentials(w http.ResponseWriter, r *http.Request) {
+	credentials, err := h.Queries.ListSiteCredentials(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	responses := make([]services.SiteCredentialDTO, len(credentials))
+	for i, c := range credentials {
+		responses[i] = services.MapSiteCredential(c)
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, responses)
+}
+
+// CreateSiteCredential godoc
+// @Summary Store site credentials
+// @Description Store a Netscape cookie file and/or a username and password for a domain, encrypted with VIDRA_SECRET_KEY. yt-dlp gets them for URLs on the domain and its subdomains.
+// @ID createSiteCredential
+// @Tags credentials
+// @Accept json
+// @Produce json
+// @Param credential body SiteCredentialRequest true "Domain and credentials"
+// @Success 201 {object} services.SiteCredentialDTO
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /api/credentials [post]
+func (h *CredentialHandler) CreateSiteCredential(w http.ResponseWriter, r *http.Request) {
+	var req SiteCredentialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	credential, err := h.Credentials.Save(r.Context(), pgtype.UUID{}, req.input())
+	if errors.Is(err, services.ErrSecretKeyMissing) {
+		utils.RespondWithError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, credential)
+}
+
+// UpdateSiteCredential godoc
+// @Summary Update site credentials
+// @Description Change the domain, cookies or login of stored credentials. Omitted cookies and username are kept; empty ones are removed.
+// @ID updateSiteCredential
+// @Tags credentials
+// @Accept json
+// @Produce json
+// @Param id path string true "Credential ID"
+// @Param credential body SiteCredentialRequest true "Domain and credentials"
+// @Success 200 {object} services.SiteCredentialDTO
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /api/credentials/{id} [put]
+func (h *CredentialHandler) UpdateSiteCredential(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid credential ID")
+		return
+	}
+
+	var req SiteCredentialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	credential, err := h.Credentials.Save(r.Context(), id, req.input())
+	if errors.Is(err, services.ErrSecretKeyMissing) {
+		utils.RespondWithError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.RespondWithError(w, http.StatusNotFound, "Credential not found")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, credential)
+}
+
+// DeleteSiteCredential godoc
+// @Summary Delete site credentials
+// @Description Delete the stored cookies and login of a domain
+// @ID deleteSiteCredential
+// @Tags credentials
+// @Param id path string true "Credential ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/credentials/{id} [delete]
+func (h *CredentialHandler) DeleteSiteCredential(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid credential ID")
+		return
+	}
+
+	if err := h.Queries.DeleteSiteCredential(r.Context(), id); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
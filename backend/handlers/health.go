@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Azmekk/Vidra/backend/services"
+	"github.com/Azmekk/Vidra/backend/utils"
+)
+
+type HealthHandler struct {
+	Health *services.HealthService
+}
+
+func NewHealthHandler(health *services.HealthService) *HealthHandler {
+	return &HealthHandler{Health: health}
+}
+
+// Liveness godoc
+// @Summary Liveness probe
+// @Description Returns 200 as long as the HTTP server is able to handle requests
+// @ID getLiveness
+// @Tags system
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /healthz [get]
+func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"status": services.HealthStatusOK})
+}
+
+// Readiness godoc
+// @Summary Readiness probe
+// @Description Checks the database, yt-dlp/ffmpeg/ffprobe binaries, the downloads directory and the WebSocket hub. Returns 503 if any check fails.
+// @ID getReadiness
+// @Tags system
+// @Produce json
+// @Success 200 {object} services.ReadinessDTO
+// @Failure 503 {object} services.ReadinessDTO
+// @Router /readyz [get]
+func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
+	report := h.Health.CheckReadiness(r.Context())
+
+	code := http.StatusOK
+	if report.Status != services.HealthStatusOK {
+		code = http.StatusServiceUnavailable
+	}
+
+	utils.RespondWithJSON(w, code, report)
+}
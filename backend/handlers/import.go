@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Azmekk/Vidra/backend/services"
+	"github.com/Azmekk/Vidra/backend/utils"
+)
+
+type ImportHandler struct {
+	Import *services.ImportService
+}
+
+func NewImportHandler(importService *services.ImportService) *ImportHandler {
+	return &ImportHandler{Import: importService}
+}
+
+type StartImportRequest struct {
+	Directory string `json:"directory"` // defaults to downloads/import
+	Mode      string `json:"mode"`      // move or link, defaults to move
+}
+
+func (r *StartImportRequest) Validate() error {
+	if r.Directory == "" {
+		r.Directory = services.ImportDropDir
+	}
+	if r.Mode == "" {
+		r.Mode = services.ImportModeMove
+	}
+	if r.Mode != services.ImportModeMove && r.Mode != services.ImportModeLink {
+		return fmt.Errorf("invalid mode: must be move or link")
+	}
+	return nil
+}
+
+// StartImport godoc
+// @Summary Import local video files
+// @Description Import every video file in a server directory into the library in the background. Each file is probed with ffprobe, gets a generated thumbnail and uses a yt-dlp .info.json sidecar when present.
+// @ID startImport
+// @Tags import
+// @Accept json
+// @Produce json
+// @Param request body StartImportRequest true "Import options"
+// @Success 202 {object} services.ImportStatusDTO
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/import [post]
+func (h *ImportHandler) StartImport(w http.ResponseWriter, r *http.Request) {
+	var req StartImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.Import.Start(req.Directory, req.Mode); err != nil {
+		if errors.Is(err, services.ErrImportRunning) {
+			utils.RespondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusAccepted, h.Import.GetStatus())
+}
+
+// GetImportStatus godoc
+// @Summary Get import status
+// @Description Get the progress and per-file results of the current or last import
+// @ID getImportStatus
+// @Tags import
+// @Produce json
+// @Success 200 {object} services.ImportStatusDTO
+// @Router /api/import/status [get]
+func (h *ImportHandler) GetImportStatus(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, http.StatusOK, h.Import.GetStatus())
+}
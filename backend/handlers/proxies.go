@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/Azmekk/Vidra/backend/services"
+	"github.com/Azmekk/Vidra/backend/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type ProxyHandler struct {
+	Queries *database.Queries
+	Proxies *services.ProxyService
+}
+
+func NewProxyHandler(queries *database.Queries, proxies *services.ProxyService) *ProxyHandler {
+	return &ProxyHandler{
+		Queries: queries,
+		Proxies: proxies,
+	}
+}
+
+type ProxyRequest struct {
+	URL     string `json:"url"`
+	Enabled *bool  `json:"enabled,omitempty"` // default: true
+}
+
+type ProxyPoolRequest struct {
+	Name     string         `json:"name"`
+	Strategy string         `json:"strategy"` // failover (default) or round_robin
+	Proxies  []ProxyRequest `json:"proxies"`  // in failover order
+}
+
+func (r *ProxyPoolRequest) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if r.Strategy == "" {
+		r.Strategy = services.ProxyStrategyFailover
+	}
+	if r.Strategy != services.ProxyStrategyFailover && r.Strategy != services.ProxyStrategyRoundRobin {
+		return fmt.Errorf("invalid strategy: must be failover or round_robin")
+	}
+	for _, p := range r.Proxies {
+		if err := services.ValidateProxyURL(p.URL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ProxyPoolRequest) inputs() []services.ProxyInput {
+	inputs := make([]services.ProxyInput, len(r.Proxies))
+	for i, p := range r.Proxies {
+		inputs[i] = services.ProxyInput{URL: p.URL, Enabled: p.Enabled == nil || *p.Enabled}
+	}
+	return inputs
+}
+
+type ProxyRuleRequest struct {
+	PoolID    string `json:"poolId"`
+	MatchType string `json:"matchType"` // extractor or domain
+	Pattern   string `json:"pattern"`   // e.g. "youtube" or "bbc.co.uk", which also matches its subdomains
+	Priority  int32  `json:"priority"`  // lower is checked first
+	Enabled   *bool  `json:"enabled,omitempty"`
+}
+
+func (r *ProxyRuleRequest) Validate() error {
+	if r.MatchType != services.ProxyMatchExtractor && r.MatchType != services.ProxyMatchDomain {
+		return fmt.Errorf("invalid matchType: must be extractor or domain")
+	}
+	r.Pattern = strings.ToLower(strings.TrimSpace(r.Pattern))
+	if r.Pattern == "" {
+		return fmt.Errorf("pattern is required")
+	}
+	return nil
+}
+
+type ProxyRuleResponse struct {
+	ID        string `json:"id"`
+	PoolID    string `json:"poolId"`
+	MatchType string `json:"matchType"`
+	Pattern   string `json:"pattern"`
+	Priority  int32  `json:"priority"`
+	Enabled   bool   `json:"enabled"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+func mapProxyRuleToResponse(rule database.ProxyRule) ProxyRuleResponse {
+	return ProxyRuleResponse{
+		ID:        rule.ID.String(),
+		PoolID:    rule.PoolID.String(),
+		MatchType: rule.MatchType,
+		Pattern:   rule.Pattern,
+		Priority:  rule.Priority,
+		Enabled:   rule.Enabled,
+		CreatedAt: rule.CreatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt: rule.UpdatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+// ListProxyPools godoc
+// @Summary List proxy pools
+// @Description Get all proxy pools with their proxies, last health check results and 403/429 cooldowns
+// @ID listProxyPools
+// @Tags proxies
+// @Produce json
+// @Success 200 {array} services.ProxyPoolDTO
+// @Failure 500 {object} map[string]string
+// @Router /api/proxies/pools [get]
+func (h *ProxyHandler) ListProxyPools(w http.ResponseWriter, r *http.Request) {
+	pools, err := h.Proxies.ListPools(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, pools)
+}
+
+// CreateProxyPool godoc
+// @Summary Create a proxy pool
+// @Description Create a pool of proxies that proxy rules can route downloads through. Failover tries the proxies in order; round_robin starts each download at the next proxy.
+// @ID createProxyPool
+// @Tags proxies
+// @Accept json
+// @Produce json
+// @Param pool body ProxyPoolRequest true "Pool details"
+// @Success 201 {object} services.ProxyPoolDTO
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/proxies/pools [post]
+func (h *ProxyHandler) CreateProxyPool(w http.ResponseWriter, r *http.Request) {
+	var req ProxyPoolRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pool, err := h.Proxies.SavePool(r.Context(), pgtype.UUID{}, req.Name, req.Strategy, req.inputs())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, pool)
+}
+
+// UpdateProxyPool godoc
+// @Summary Update a proxy pool
+// @Description Update a pool and replace its proxies. Health check results are kept for proxies whose URL is unchanged.
+// @ID updateProxyPool
+// @Tags proxies
+// @Accept json
+// @Produce json
+// @Param id path string true "Pool ID"
+// @Param pool body ProxyPoolRequest true "Pool details"
+// @Success 200 {object} services.ProxyPoolDTO
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/proxies/pools/{id} [put]
+func (h *ProxyHandler) UpdateProxyPool(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid pool ID")
+		return
+	}
+
+	var req ProxyPoolRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pool, err := h.Proxies.SavePool(r.Context(), id, req.Name, req.Strategy, req.inputs())
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.RespondWithError(w, http.StatusNotFound, "Proxy pool not found")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, pool)
+}
+
+// DeleteProxyPool godoc
+// @Summary Delete a proxy pool
+// @Description Delete a pool with its proxies and the rules that route to it
+// @ID deleteProxyPool
+// @Tags proxies
+// @Param id path string true "Pool ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/proxies/pools/{id} [delete]
+func (h *ProxyHandler) DeleteProxyPool(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid pool ID")
+		return
+	}
+
+	if err := h.Queries.DeleteProxyPool(r.Context(), id); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListProxyRules godoc
+// @Summary List proxy rules
+// @Description Get all proxy rules in the order they are checked. The first enabled rule matching a URL picks its pool; URLs no rule matches use the global proxy setting.
+// @ID listProxyRules
+// @Tags proxies
+// @Produce json
+// @Success 200 {array} ProxyRuleResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/proxies/rules [get]
+func (h *ProxyHandler) ListProxyRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.Queries.ListProxyRules(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	responses := make([]ProxyRuleResponse, len(rules))
+	for i, rule := range rules {
+		responses[i] = mapProxyRuleToResponse(rule)
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, responses)
+}
+
+// CreateProxyRule godoc
+// @Summary Create a proxy rule
+// @Description Route downloads from a site to a proxy pool, matched by yt-dlp extractor or by domain
+// @ID createProxyRule
+// @Tags proxies
+// @Accept json
+// @Produce json
+// @Param rule body ProxyRuleRequest true "Rule details"
+// @Success 201 {object} ProxyRuleResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/proxies/rules [post]
+func (h *ProxyHandler) CreateProxyRule(w http.ResponseWriter, r *http.Request) {
+	var req ProxyRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	poolID, ok := h.validateRule(w, r, &req)
+	if !ok {
+		return
+	}
+
+	rule, err := h.Queries.CreateProxyRule(r.Context(), database.CreateProxyRuleParams{
+		PoolID:    poolID,
+		MatchType: req.MatchType,
+		Pattern:   req.Pattern,
+		Priority:  req.Priority,
+		Enabled:   req.Enabled == nil || *req.Enabled,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, mapProxyRuleToResponse(rule))
+}
+
+// UpdateProxyRule godoc
+// @Summary Update a proxy rule
+// @Description Update the pool, match and priority of a proxy rule
+// @ID updateProxyRule
+// @Tags proxies
+// @Accept json
+// @Produce json
+// @Param id path string true "Rule ID"
+// @Param rule body ProxyRuleRequest true "Rule details"
+// @Success 200 {object} ProxyRuleResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/proxies/rules/{id} [put]
+func (h *ProxyHandler) UpdateProxyRule(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid rule ID")
+		return
+	}
+
+	var req ProxyRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	poolID, ok := h.validateRule(w, r, &req)
+	if !ok {
+		return
+	}
+
+	rule, err := h.Queries.UpdateProxyRule(r.Context(), database.UpdateProxyRuleParams{
+		ID:        id,
+		PoolID:    poolID,
+		MatchType: req.MatchType,
+		Pattern:   req.Pattern,
+		Priority:  req.Priority,
+		Enabled:   req.Enabled == nil || *req.Enabled,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Proxy rule not found")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, mapProxyRuleToResponse(rule))
+}
+
+// validateRule validates a rule request and checks that its pool exists, responding with 400 if not
+func (h *ProxyHandler) validateRule(w http.ResponseWriter, r *http.Request, req *ProxyRuleRequest) (pgtype.UUID, bool) {
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return pgtype.UUID{}, false
+	}
+
+	var poolID pgtype.UUID
+	if err := poolID.Scan(req.PoolID); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid pool ID")
+		return pgtype.UUID{}, false
+	}
+	if _, err := h.Queries.GetProxyPool(r.Context(), poolID); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Proxy pool not found")
+		return pgtype.UUID{}, false
+	}
+	return poolID, true
+}
+
+// DeleteProxyRule godoc
+// @Summary Delete a proxy rule
+// @Description Delete a proxy rule. Its pool is kept.
+// @ID deleteProxyRule
+// @Tags proxies
+// @Param id path string true "Rule ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/proxies/rules/{id} [delete]
+func (h *ProxyHandler) DeleteProxyRule(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid rule ID")
+		return
+	}
+
+	if err := h.Queries.DeleteProxyRule(r.Context(), id); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CheckProxies godoc
+// @Summary Check proxy health
+// @Description Fetch a known URL through every proxy and record whether it answered and how fast
+// @ID checkProxies
+// @Tags proxies
+// @Produce json
+// @Success 200 {array} services.ProxyHealthDTO
+// @Failure 500 {object} map[string]string
+// @Router /api/proxies/check [post]
+func (h *ProxyHandler) CheckProxies(w http.ResponseWriter, r *http.Request) {
+	results, err := h.Proxies.CheckAll(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, results)
+}
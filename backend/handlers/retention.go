@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/Azmekk/Vidra/backend/services"
+	"github.com/Azmekk/Vidra/backend/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type RetentionHandler struct {
+	Queries   *database.Queries
+	Retention *services.RetentionService
+}
+
+func NewRetentionHandler(queries *database.Queries, retention *services.RetentionService) *RetentionHandler {
+	return &RetentionHandler{
+		Queries:   queries,
+		Retention: retention,
+	}
+}
+
+type RetentionRuleResponse struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	RuleType  string `json:"ruleType"`
+	Value     int    `json:"value"`
+	Scope     string `json:"scope"`
+	Enabled   bool   `json:"enabled"`
+	Tag       string `json:"tag,omitempty"`
+	Permanent bool   `json:"permanent"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+func mapRetentionRuleToResponse(r database.RetentionRule) RetentionRuleResponse {
+	return RetentionRuleResponse{
+		ID:        r.ID.String(),
+		Name:      r.Name,
+		RuleType:  r.RuleType,
+		Value:     int(r.Value),
+		Scope:     r.Scope,
+		Enabled:   r.Enabled,
+		Tag:       r.Tag,
+		Permanent: r.Permanent,
+		CreatedAt: r.CreatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt: r.UpdatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+type RetentionRuleRequest struct {
+	Name      string `json:"name"`
+	RuleType  string `json:"ruleType"` // max_age (days), keep_latest (count) or unwatched (days since download without anyone starting it)
+	Value     int    `json:"value"`
+	Scope     string `json:"scope"` // all, site (groups keep_latest by site) or tag
+	Tag       string `json:"tag,omitempty"`
+	Enabled   bool   `json:"enabled"`
+	Permanent bool   `json:"permanent"` // delete for good instead of moving to the trash
+}
+
+func (r *RetentionRuleRequest) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	validTypes := map[string]bool{services.RetentionRuleMaxAge: true, services.RetentionRuleKeepLatest: true, services.RetentionRuleUnwatched: true}
+	if !validTypes[r.RuleType] {
+		return fmt.Errorf("invalid rule type: must be max_age, keep_latest or unwatched")
+	}
+	if r.Value < 1 {
+		return fmt.Errorf("invalid value: must be at least 1")
+	}
+	if r.Scope == "" {
+		r.Scope = services.RetentionScopeAll
+	}
+	validScopes := map[string]bool{services.RetentionScopeAll: true, services.RetentionScopeSite: true, services.RetentionScopeTag: true}
+	if !validScopes[r.Scope] {
+		return fmt.Errorf("invalid scope: must be all, site or tag")
+	}
+	if r.Scope != services.RetentionScopeTag {
+		r.Tag = ""
+		return nil
+	}
+	tags, err := services.NormalizeTags([]string{r.Tag})
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return fmt.Errorf("tag is required with the tag scope")
+	}
+	r.Tag = tags[0]
+	return nil
+}
+
+// ListRetentionRules godoc
+// @Summary List retention rules
+// @Description Get all retention rules
+// @ID listRetentionRules
+// @Tags retention
+// @Produce json
+// @Success 200 {array} RetentionRuleResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/retention/rules [get]
+func (h *RetentionHandler) ListRetentionRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.Queries.ListRetentionRules(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	responses := make([]RetentionRuleResponse, len(rules))
+	for i, rule := range rules {
+		responses[i] = mapRetentionRuleToResponse(rule)
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, responses)
+}
+
+// CreateRetentionRule godoc
+// @Summary Create a retention rule
+// @Description Create a rule that the background janitor uses to clean up videos: by age, by count, or unwatched after a number of days, optionally limited to a tag. Matching videos go to the trash unless the rule is permanent. Pinned videos are always exempt.
+// @ID createRetentionRule
+// @Tags retention
+// @Accept json
+// @Produce json
+// @Param rule body RetentionRuleRequest true "Rule details"
+// @Success 201 {object} RetentionRuleResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/retention/rules [post]
+func (h *RetentionHandler) CreateRetentionRule(w http.ResponseWriter, r *http.Request) {
+	var req RetentionRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rule, err := h.Queries.CreateRetentionRule(r.Context(), database.CreateRetentionRuleParams{
+		Name:      req.Name,
+		RuleType:  req.RuleType,
+		Value:     int32(req.Value),
+		Scope:     req.Scope,
+		Enabled:   req.Enabled,
+		Tag:       req.Tag,
+		Permanent: req.Permanent,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, mapRetentionRuleToResponse(rule))
+}
+
+// UpdateRetentionRule godoc
+// @Summary Update a retention rule
+// @Description Update an existing retention rule
+// @ID updateRetentionRule
+// @Tags retention
+// @Accept json
+// @Produce json
+// @Param id path string true "Rule ID"
+// @Param rule body RetentionRuleRequest true "Rule details"
+// @Success 200 {object} RetentionRuleResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/retention/rules/{id} [put]
+func (h *RetentionHandler) UpdateRetentionRule(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid rule ID")
+		return
+	}
+
+	var req RetentionRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rule, err := h.Queries.UpdateRetentionRule(r.Context(), database.UpdateRetentionRuleParams{
+		ID:        id,
+		Name:      req.Name,
+		RuleType:  req.RuleType,
+		Value:     int32(req.Value),
+		Scope:     req.Scope,
+		Enabled:   req.Enabled,
+		Tag:       req.Tag,
+		Permanent: req.Permanent,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Rule not found")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, mapRetentionRuleToResponse(rule))
+}
+
+// DeleteRetentionRule godoc
+// @Summary Delete a retention rule
+// @Description Delete a retention rule by ID
+// @ID deleteRetentionRule
+// @Tags retention
+// @Param id path string true "Rule ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/retention/rules/{id} [delete]
+func (h *RetentionHandler) DeleteRetentionRule(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid rule ID")
+		return
+	}
+
+	if err := h.Queries.DeleteRetentionRule(r.Context(), id); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PreviewRetention godoc
+// @Summary Preview retention
+// @Description Dry run: list the videos the enabled retention rules would delete without deleting anything
+// @ID previewRetention
+// @Tags retention
+// @Produce json
+// @Success 200 {array} services.RetentionCandidateDTO
+// @Failure 500 {object} map[string]string
+// @Router /api/retention/preview [get]
+func (h *RetentionHandler) PreviewRetention(w http.ResponseWriter, r *http.Request) {
+	candidates, err := h.Retention.Evaluate(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, candidates)
+}
+
+// RunRetention godoc
+// @Summary Run retention now
+// @Description Apply the enabled retention rules immediately instead of waiting for the janitor. Videos go to the trash unless their rule is permanent.
+// @ID runRetention
+// @Tags retention
+// @Produce json
+// @Success 200 {array} services.RetentionCandidateDTO
+// @Failure 500 {object} map[string]string
+// @Router /api/retention/run [post]
+func (h *RetentionHandler) RunRetention(w http.ResponseWriter, r *http.Request) {
+	deleted, err := h.Retention.RunOnce(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, deleted)
+}
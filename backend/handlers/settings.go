@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/Azmekk/Vidra/backend/services"
 	"github.com/Azmekk/Vidra/backend/utils"
@@ -11,11 +12,13 @@ import (
 
 type SettingsHandler struct {
 	Settings *services.SettingsService
+	Schedule *services.ScheduleService
 }
 
-func NewSettingsHandler(settings *services.SettingsService) *SettingsHandler {
+func NewSettingsHandler(settings *services.SettingsService, schedule *services.ScheduleService) *SettingsHandler {
 	return &SettingsHandler{
 		Settings: settings,
+		Schedule: schedule,
 	}
 }
 
@@ -132,3 +135,612 @@ func (h *SettingsHandler) UpdateSettings(w http.ResponseWriter, r *http.Request)
 		Theme:             settings.Theme,
 	})
 }
+
+type StorageSettingsResponse struct {
+	MaxLibrarySizeGB   float64 `json:"maxLibrarySizeGb"`
+	MinFreeSpaceGB     float64 `json:"minFreeSpaceGb"`
+	DiskWarningPercent int     `json:"diskWarningPercent"`
+}
+
+type UpdateStorageSettingsRequest struct {
+	MaxLibrarySizeGB   float64 `json:"maxLibrarySizeGb"`   // 0 means unlimited
+	MinFreeSpaceGB     float64 `json:"minFreeSpaceGb"`     // 0 means no minimum
+	DiskWarningPercent int     `json:"diskWarningPercent"` // 0 disables warnings
+}
+
+func (r *UpdateStorageSettingsRequest) Validate() error {
+	if r.MaxLibrarySizeGB < 0 {
+		return fmt.Errorf("invalid max library size: must be 0 (unlimited) or greater")
+	}
+	if r.MinFreeSpaceGB < 0 {
+		return fmt.Errorf("invalid min free space: must be 0 (disabled) or greater")
+	}
+	if r.DiskWarningPercent < 0 || r.DiskWarningPercent > 100 {
+		return fmt.Errorf("invalid disk warning percent: must be between 0 and 100")
+	}
+	return nil
+}
+
+func mapStorageSettingsToResponse(settings services.SettingsDTO) StorageSettingsResponse {
+	return StorageSettingsResponse{
+		MaxLibrarySizeGB:   settings.MaxLibrarySizeGB,
+		MinFreeSpaceGB:     settings.MinFreeSpaceGB,
+		DiskWarningPercent: settings.DiskWarningPercent,
+	}
+}
+
+// GetStorageSettings godoc
+// @Summary Get storage settings
+// @Description Get the disk quota settings: max library size, minimum free space and warning threshold
+// @ID getStorageSettings
+// @Tags settings
+// @Produce json
+// @Success 200 {object} StorageSettingsResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/settings/storage [get]
+func (h *SettingsHandler) GetStorageSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.Settings.GetSettings(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, mapStorageSettingsToResponse(settings))
+}
+
+// UpdateStorageSettings godoc
+// @Summary Update storage settings
+// @Description Update the disk quota settings
+// @ID updateStorageSettings
+// @Tags settings
+// @Accept json
+// @Produce json
+// @Param settings body UpdateStorageSettingsRequest true "Storage settings to update"
+// @Success 200 {object} StorageSettingsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/settings/storage [put]
+func (h *SettingsHandler) UpdateStorageSettings(w http.ResponseWriter, r *http.Request) {
+	var req UpdateStorageSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	settings, err := h.Settings.UpdateStorageSettings(r.Context(), services.SettingsDTO{
+		MaxLibrarySizeGB:   req.MaxLibrarySizeGB,
+		MinFreeSpaceGB:     req.MinFreeSpaceGB,
+		DiskWarningPercent: req.DiskWarningPercent,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, mapStorageSettingsToResponse(settings))
+}
+
+type LibrarySettingsResponse struct {
+	FilenameTemplate string `json:"filenameTemplate"`
+}
+
+type UpdateLibrarySettingsRequest struct {
+	// Fields: {title}, {id}, {uploader}, {upload_date}, {extractor}, {uuid}, {ext}. Use / for subdirectories.
+	FilenameTemplate string `json:"filenameTemplate"`
+}
+
+func (r *UpdateLibrarySettingsRequest) Validate() error {
+	return services.ValidateFilenameTemplate(r.FilenameTemplate)
+}
+
+// GetLibrarySettings godoc
+// @Summary Get library settings
+// @Description Get the filename template used to lay out finished videos
+// @ID getLibrarySettings
+// @Tags settings
+// @Produce json
+// @Success 200 {object} LibrarySettingsResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/settings/library [get]
+func (h *SettingsHandler) GetLibrarySettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.Settings.GetSettings(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, LibrarySettingsResponse{FilenameTemplate: settings.FilenameTemplate})
+}
+
+// UpdateLibrarySettings godoc
+// @Summary Update library settings
+// @Description Update the filename template, e.g. "{uploader}/{upload_date} - {title} [{id}].{ext}". Only new downloads use it; run POST /api/system/reorganize to move existing files.
+// @ID updateLibrarySettings
+// @Tags settings
+// @Accept json
+// @Produce json
+// @Param settings body UpdateLibrarySettingsRequest true "Library settings to update"
+// @Success 200 {object} LibrarySettingsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/settings/library [put]
+func (h *SettingsHandler) UpdateLibrarySettings(w http.ResponseWriter, r *http.Request) {
+	var req UpdateLibrarySettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	settings, err := h.Settings.UpdateLibrarySettings(r.Context(), services.SettingsDTO{
+		FilenameTemplate: req.FilenameTemplate,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, LibrarySettingsResponse{FilenameTemplate: settings.FilenameTemplate})
+}
+
+type TrashSettingsResponse struct {
+	TrashRetentionDays int `json:"trashRetentionDays"`
+}
+
+type UpdateTrashSettingsRequest struct {
+	TrashRetentionDays int `json:"trashRetentionDays"` // 0 keeps trashed videos until deleted by hand
+}
+
+func (r *UpdateTrashSettingsRequest) Validate() error {
+	if r.TrashRetentionDays < 0 {
+		return fmt.Errorf("invalid trash retention days: must be 0 (never purge) or greater")
+	}
+	return nil
+}
+
+// GetTrashSettings godoc
+// @Summary Get trash settings
+// @Description Get the number of days after which trashed videos are deleted permanently
+// @ID getTrashSettings
+// @Tags settings
+// @Produce json
+// @Success 200 {object} TrashSettingsResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/settings/trash [get]
+func (h *SettingsHandler) GetTrashSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.Settings.GetSettings(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, TrashSettingsResponse{TrashRetentionDays: settings.TrashRetentionDays})
+}
+
+// UpdateTrashSettings godoc
+// @Summary Update trash settings
+// @Description Update the number of days after which trashed videos are deleted permanently. 0 disables the auto-purge.
+// @ID updateTrashSettings
+// @Tags settings
+// @Accept json
+// @Produce json
+// @Param settings body UpdateTrashSettingsRequest true "Trash settings to update"
+// @Success 200 {object} TrashSettingsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/settings/trash [put]
+func (h *SettingsHandler) UpdateTrashSettings(w http.ResponseWriter, r *http.Request) {
+	var req UpdateTrashSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	settings, err := h.Settings.UpdateTrashSettings(r.Context(), services.SettingsDTO{
+		TrashRetentionDays: req.TrashRetentionDays,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, TrashSettingsResponse{TrashRetentionDays: settings.TrashRetentionDays})
+}
+
+type SponsorBlockSettingsResponse struct {
+	APIURL string `json:"apiUrl"`
+}
+
+type UpdateSponsorBlockSettingsRequest struct {
+	APIURL string `json:"apiUrl"` // empty uses yt-dlp's default, https://sponsor.ajay.app
+}
+
+func (r *UpdateSponsorBlockSettingsRequest) Validate() error {
+	if r.APIURL == "" {
+		return nil
+	}
+	u, err := url.Parse(r.APIURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid SponsorBlock API URL: must be an http or https URL")
+	}
+	return nil
+}
+
+// GetSponsorBlockSettings godoc
+// @Summary Get SponsorBlock settings
+// @Description Get the SponsorBlock API host used by downloads with SponsorBlock handling
+// @ID getSponsorBlockSettings
+// @Tags settings
+// @Produce json
+// @Success 200 {object} SponsorBlockSettingsResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/settings/sponsorblock [get]
+func (h *SettingsHandler) GetSponsorBlockSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.Settings.GetSettings(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, SponsorBlockSettingsResponse{APIURL: settings.SponsorBlockAPIURL})
+}
+
+// UpdateSponsorBlockSettings godoc
+// @Summary Update SponsorBlock settings
+// @Description Update the SponsorBlock API host, e.g. to use a mirror or a local stub. Empty restores the default.
+// @ID updateSponsorBlockSettings
+// @Tags settings
+// @Accept json
+// @Produce json
+// @Param settings body UpdateSponsorBlockSettingsRequest true "SponsorBlock settings to update"
+// @Success 200 {object} SponsorBlockSettingsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/settings/sponsorblock [put]
+func (h *SettingsHandler) UpdateSponsorBlockSettings(w http.ResponseWriter, r *http.Request) {
+	var req UpdateSponsorBlockSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	settings, err := h.Settings.UpdateSponsorBlockSettings(r.Context(), services.SettingsDTO{
+		SponsorBlockAPIURL: req.APIURL,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, SponsorBlockSettingsResponse{APIURL: settings.SponsorBlockAPIURL})
+}
+
+type YtdlpOptionsSettingsResponse struct {
+	Options []string `json:"options"`
+}
+
+type UpdateYtdlpOptionsSettingsRequest struct {
+	Options []string `json:"options"` // extra yt-dlp options from the allow-list, e.g. ["--limit-rate", "5M", "--geo-bypass"]
+}
+
+func (r *UpdateYtdlpOptionsSettingsRequest) Validate() error {
+	options, err := services.NormalizeYtdlpOptions(r.Options)
+	if err != nil {
+		return err
+	}
+	r.Options = options
+	return nil
+}
+
+// GetYtdlpOptionsSettings godoc
+// @Summary Get extra yt-dlp options
+// @Description Get the extra yt-dlp options added to every download
+// @ID getYtdlpOptionsSettings
+// @Tags settings
+// @Produce json
+// @Success 200 {object} YtdlpOptionsSettingsResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/settings/yt-dlp-options [get]
+func (h *SettingsHandler) GetYtdlpOptionsSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.Settings.GetSettings(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, YtdlpOptionsSettingsResponse{Options: settings.YtdlpOptions})
+}
+
+// UpdateYtdlpOptionsSettings godoc
+// @Summary Update extra yt-dlp options
+// @Description Set the extra yt-dlp options added to every download, such as --limit-rate, --sleep-interval, --geo-bypass, --extractor-args or --concurrent-fragments. Options outside the allow-list, like --exec, and output templates outside downloads/ are rejected.
+// @ID updateYtdlpOptionsSettings
+// @Tags settings
+// @Accept json
+// @Produce json
+// @Param settings body UpdateYtdlpOptionsSettingsRequest true "yt-dlp options"
+// @Success 200 {object} YtdlpOptionsSettingsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/settings/yt-dlp-options [put]
+func (h *SettingsHandler) UpdateYtdlpOptionsSettings(w http.ResponseWriter, r *http.Request) {
+	var req UpdateYtdlpOptionsSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	settings, err := h.Settings.UpdateYtdlpOptionsSettings(r.Context(), services.SettingsDTO{
+		YtdlpOptions: req.Options,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, YtdlpOptionsSettingsResponse{Options: settings.YtdlpOptions})
+}
+
+type DownloadSettingsResponse struct {
+	RateLimit string                    `json:"rateLimit"`
+	Windows   []services.DownloadWindow `json:"windows"`
+	NextStart string                    `json:"nextStart"` // when a new download would start, now if inside a window
+}
+
+type UpdateDownloadSettingsRequest struct {
+	RateLimit string                    `json:"rateLimit"` // bytes per second passed to yt-dlp --limit-rate, e.g. 5M; empty for no limit
+	Windows   []services.DownloadWindow `json:"windows"`   // times of day in the server's time zone when downloads may start; empty for any time
+}
+
+func (r *UpdateDownloadSettingsRequest) Validate() error {
+	if err := services.ValidateRateLimit(r.RateLimit); err != nil {
+		return err
+	}
+	if r.Windows == nil {
+		r.Windows = []services.DownloadWindow{}
+	}
+	return services.ValidateDownloadWindows(r.Windows)
+}
+
+func (h *SettingsHandler) downloadSettingsResponse(r *http.Request, settings services.SettingsDTO) DownloadSettingsResponse {
+	next, _ := h.Schedule.NextStart(r.Context())
+	return DownloadSettingsResponse{
+		RateLimit: settings.DownloadRateLimit,
+		Windows:   settings.DownloadWindows,
+		NextStart: next.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+// GetDownloadSettings godoc
+// @Summary Get download settings
+// @Description Get the global download rate limit and the download windows
+// @ID getDownloadSettings
+// @Tags settings
+// @Produce json
+// @Success 200 {object} DownloadSettingsResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/settings/downloads [get]
+func (h *SettingsHandler) GetDownloadSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.Settings.GetSettings(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, h.downloadSettingsResponse(r, settings))
+}
+
+// UpdateDownloadSettings godoc
+// @Summary Update download settings
+// @Description Update the global download rate limit and the download windows. Outside the windows new downloads wait in the scheduled status; scheduled downloads start once a window opens.
+// @ID updateDownloadSettings
+// @Tags settings
+// @Accept json
+// @Produce json
+// @Param settings body UpdateDownloadSettingsRequest true "Download settings to update"
+// @Success 200 {object} DownloadSettingsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/settings/downloads [put]
+func (h *SettingsHandler) UpdateDownloadSettings(w http.ResponseWriter, r *http.Request) {
+	var req UpdateDownloadSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	settings, err := h.Settings.UpdateDownloadSettings(r.Context(), services.SettingsDTO{
+		DownloadRateLimit: req.RateLimit,
+		DownloadWindows:   req.Windows,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Start or reschedule the waiting downloads for the new windows
+	h.Schedule.Check(r.Context())
+
+	utils.RespondWithJSON(w, http.StatusOK, h.downloadSettingsResponse(r, settings))
+}
+
+type YtdlpUpdateSettingsResponse struct {
+	AutoUpdate bool   `json:"autoUpdate"`
+	Time       string `json:"time"`
+}
+
+type UpdateYtdlpUpdateSettingsRequest struct {
+	AutoUpdate bool   `json:"autoUpdate"`
+	Time       string `json:"time"` // HH:MM in the server's time zone
+}
+
+func (r *UpdateYtdlpUpdateSettingsRequest) Validate() error {
+	return services.ValidateYtdlpUpdateTime(r.Time)
+}
+
+// GetYtdlpUpdateSettings godoc
+// @Summary Get automatic yt-dlp update settings
+// @Description Get whether yt-dlp is updated automatically and at what time of day
+// @ID getYtdlpUpdateSettings
+// @Tags settings
+// @Produce json
+// @Success 200 {object} YtdlpUpdateSettingsResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/settings/yt-dlp-updates [get]
+func (h *SettingsHandler) GetYtdlpUpdateSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.Settings.GetSettings(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, YtdlpUpdateSettingsResponse{
+		AutoUpdate: settings.YtdlpAutoUpdate,
+		Time:       settings.YtdlpUpdateTime,
+	})
+}
+
+// UpdateYtdlpUpdateSettings godoc
+// @Summary Update automatic yt-dlp update settings
+// @Description Enable or disable the daily yt-dlp update and set its time of day. The update installs the configured channel or pinned version and waits until no downloads are active; every run is listed under /api/system/maintenance-runs.
+// @ID updateYtdlpUpdateSettings
+// @Tags settings
+// @Accept json
+// @Produce json
+// @Param settings body UpdateYtdlpUpdateSettingsRequest true "Automatic update settings"
+// @Success 200 {object} YtdlpUpdateSettingsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/settings/yt-dlp-updates [put]
+func (h *SettingsHandler) UpdateYtdlpUpdateSettings(w http.ResponseWriter, r *http.Request) {
+	var req UpdateYtdlpUpdateSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	settings, err := h.Settings.UpdateYtdlpAutoUpdateSettings(r.Context(), services.SettingsDTO{
+		YtdlpAutoUpdate: req.AutoUpdate,
+		YtdlpUpdateTime: req.Time,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, YtdlpUpdateSettingsResponse{
+		AutoUpdate: settings.YtdlpAutoUpdate,
+		Time:       settings.YtdlpUpdateTime,
+	})
+}
+
+type FormatPolicySettingsResponse struct {
+	Policy     services.FormatPolicy `json:"policy"`
+	Format     string                `json:"format"`               // the compiled yt-dlp -f selector
+	FormatSort string                `json:"formatSort,omitempty"` // the compiled yt-dlp -S sort, if any
+}
+
+type UpdateFormatPolicySettingsRequest struct {
+	Policy services.FormatPolicy `json:"policy"` // empty lets yt-dlp pick the best format
+}
+
+func (r *UpdateFormatPolicySettingsRequest) Validate() error {
+	return services.ValidateFormatPolicy(r.Policy)
+}
+
+func formatPolicySettingsResponse(settings services.SettingsDTO) FormatPolicySettingsResponse {
+	format, sort := services.CompileFormatPolicy(settings.DefaultFormatPolicy)
+	return FormatPolicySettingsResponse{
+		Policy:     settings.DefaultFormatPolicy,
+		Format:     format,
+		FormatSort: sort,
+	}
+}
+
+// GetFormatPolicySettings godoc
+// @Summary Get the default format policy
+// @Description Get the format policy used by downloads without a format ID or policy of their own, with the yt-dlp format selector and sort it compiles to
+// @ID getFormatPolicySettings
+// @Tags settings
+// @Produce json
+// @Success 200 {object} FormatPolicySettingsResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/settings/format-policy [get]
+func (h *SettingsHandler) GetFormatPolicySettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.Settings.GetSettings(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, formatPolicySettingsResponse(settings))
+}
+
+// UpdateFormatPolicySettings godoc
+// @Summary Update the default format policy
+// @Description Set the format policy used by downloads without a format ID or policy of their own, e.g. max 1080p, prefer av1 > vp9 > h264, prefer 60fps, max 2G per stream
+// @ID updateFormatPolicySettings
+// @Tags settings
+// @Accept json
+// @Produce json
+// @Param settings body UpdateFormatPolicySettingsRequest true "Default format policy"
+// @Success 200 {object} FormatPolicySettingsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/settings/format-policy [put]
+func (h *SettingsHandler) UpdateFormatPolicySettings(w http.ResponseWriter, r *http.Request) {
+	var req UpdateFormatPolicySettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	settings, err := h.Settings.UpdateFormatPolicySettings(r.Context(), services.SettingsDTO{
+		DefaultFormatPolicy: req.Policy,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, formatPolicySettingsResponse(settings))
+}
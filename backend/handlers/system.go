@@ -1,15 +1,27 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/Azmekk/Vidra/backend/services"
 	"github.com/Azmekk/Vidra/backend/utils"
 )
 
-type SystemHandler struct{}
+type SystemHandler struct {
+	Queries   *database.Queries
+	Health    *services.HealthService
+	Quota     *services.QuotaService
+	Reconcile *services.ReconcileService
+	Layout    *services.LibraryLayout
+	Previews  *services.PreviewService
+	MediaInfo *services.MediaInfoService
+}
 
-func NewSystemHandler() *SystemHandler {
-	return &SystemHandler{}
+func NewSystemHandler(queries *database.Queries, health *services.HealthService, quota *services.QuotaService, reconcile *services.ReconcileService, layout *services.LibraryLayout, previews *services.PreviewService, mediaInfo *services.MediaInfoService) *SystemHandler {
+	return &SystemHandler{Queries: queries, Health: health, Quota: quota, Reconcile: reconcile, Layout: layout, Previews: previews, MediaInfo: mediaInfo}
 }
 
 type SystemInfoResponse struct {
@@ -20,22 +32,271 @@ type SystemInfoResponse struct {
 
 // GetSystemInfo godoc
 // @Summary Get system information
-// @Description Get server status and downloads directory size
+// @Description Get server status and library size. Status is the result of the last readiness check if it ran within the last minute, and otherwise whether the database responds.
 // @ID getSystemInfo
 // @Tags system
 // @Produce json
 // @Success 200 {object} SystemInfoResponse
 // @Router /api/system/info [get]
 func (h *SystemHandler) GetSystemInfo(w http.ResponseWriter, r *http.Request) {
-	size, err := utils.GetDirSize("downloads")
-	if err != nil {
-		// If directory doesn't exist yet, it's fine, size is 0
-		size = 0
+	var size int64
+	if usage, err := h.Quota.GetUsage(r.Context()); err == nil {
+		size = usage.LibraryBytes
 	}
 
 	utils.RespondWithJSON(w, http.StatusOK, SystemInfoResponse{
-		Status:        "ok",
+		Status:        h.Health.Status(r.Context()),
 		DiskUsageGB:   float64(size) / (1024 * 1024 * 1024),
 		DownloadsSize: size,
 	})
 }
+
+// GetDiskUsage godoc
+// @Summary Get disk usage
+// @Description Get the library size and free space alongside the configured disk limits
+// @ID getDiskUsage
+// @Tags system
+// @Produce json
+// @Success 200 {object} services.DiskUsageDTO
+// @Failure 500 {object} map[string]string
+// @Router /api/system/disk [get]
+func (h *SystemHandler) GetDiskUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := h.Quota.GetUsage(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, usage)
+}
+
+// ReconcileLibrary godoc
+// @Summary Reconcile files and database
+// @Description Compare the downloads directory with the videos table and fix orphan files, missing files, size mismatches and stale job statuses. With dryRun=true the findings are only reported.
+// @ID reconcileLibrary
+// @Tags system
+// @Produce json
+// @Param dryRun query bool false "Only report, do not fix"
+// @Success 200 {object} services.ReconcileReportDTO
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/system/reconcile [post]
+func (h *SystemHandler) ReconcileLibrary(w http.ResponseWriter, r *http.Request) {
+	dryRun, ok := parseDryRun(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := h.Reconcile.Reconcile(r.Context(), dryRun)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, report)
+}
+
+// parseDryRun reads the optional dryRun query parameter, responding with 400 if it is invalid
+func parseDryRun(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	v := r.URL.Query().Get("dryRun")
+	if v == "" {
+		return false, true
+	}
+	dryRun, err := strconv.ParseBool(v)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid dryRun value")
+		return false, false
+	}
+	return dryRun, true
+}
+
+// ReorganizeLibrary godoc
+// @Summary Reorganize the library
+// @Description Move every completed video into the layout given by the current filename template. With dryRun=true the planned moves are returned without moving anything; otherwise the moves run in the background.
+// @ID reorganizeLibrary
+// @Tags system
+// @Produce json
+// @Param dryRun query bool false "Only plan, do not move"
+// @Success 200 {object} services.ReorganizeStatusDTO
+// @Success 202 {object} services.ReorganizeStatusDTO
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/system/reorganize [post]
+func (h *SystemHandler) ReorganizeLibrary(w http.ResponseWriter, r *http.Request) {
+	dryRun, ok := parseDryRun(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := h.Layout.Reorganize(r.Context(), dryRun)
+	if errors.Is(err, services.ErrReorganizeRunning) {
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	code := http.StatusAccepted
+	if dryRun {
+		code = http.StatusOK
+	}
+	utils.RespondWithJSON(w, code, status)
+}
+
+// GetReorganizeStatus godoc
+// @Summary Get reorganize status
+// @Description Get the progress and moves of the current or last library reorganize
+// @ID getReorganizeStatus
+// @Tags system
+// @Produce json
+// @Success 200 {object} services.ReorganizeStatusDTO
+// @Router /api/system/reorganize [get]
+func (h *SystemHandler) GetReorganizeStatus(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, http.StatusOK, h.Layout.GetReorganizeStatus())
+}
+
+// GeneratePreviews godoc
+// @Summary Generate previews for the library
+// @Description Generate thumbnails and timeline sprite sheets in the background. By default only completed videos missing either are covered; all=true rebuilds every video.
+// @ID generatePreviews
+// @Tags system
+// @Produce json
+// @Param all query bool false "Rebuild previews of every video"
+// @Success 202 {object} services.PreviewStatusDTO
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/system/previews [post]
+func (h *SystemHandler) GeneratePreviews(w http.ResponseWriter, r *http.Request) {
+	all := false
+	if v := r.URL.Query().Get("all"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid all value")
+			return
+		}
+		all = parsed
+	}
+
+	status, err := h.Previews.Start(r.Context(), all)
+	if errors.Is(err, services.ErrPreviewsRunning) {
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusAccepted, status)
+}
+
+// GetPreviewStatus godoc
+// @Summary Get preview generation status
+// @Description Get the progress and failures of the current or last library-wide preview generation
+// @ID getPreviewStatus
+// @Tags system
+// @Produce json
+// @Success 200 {object} services.PreviewStatusDTO
+// @Router /api/system/previews [get]
+func (h *SystemHandler) GetPreviewStatus(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, http.StatusOK, h.Previews.GetStatus())
+}
+
+// BackfillMediaInfo godoc
+// @Summary Probe videos without media info
+// @Description Run ffprobe in the background on every completed video that has no media info yet
+// @ID backfillMediaInfo
+// @Tags system
+// @Produce json
+// @Success 202 {object} services.MediaInfoStatusDTO
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/system/media-info [post]
+func (h *SystemHandler) BackfillMediaInfo(w http.ResponseWriter, r *http.Request) {
+	status, err := h.MediaInfo.Start(r.Context())
+	if errors.Is(err, services.ErrMediaInfoRunning) {
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusAccepted, status)
+}
+
+// GetMediaInfoStatus godoc
+// @Summary Get media info backfill status
+// @Description Get the progress and failures of the current or last media info backfill
+// @ID getMediaInfoStatus
+// @Tags system
+// @Produce json
+// @Success 200 {object} services.MediaInfoStatusDTO
+// @Router /api/system/media-info [get]
+func (h *SystemHandler) GetMediaInfoStatus(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, http.StatusOK, h.MediaInfo.GetStatus())
+}
+
+type PaginatedMaintenanceRunResponse struct {
+	TotalCount  int64                        `json:"totalCount"`
+	TotalPages  int                          `json:"totalPages"`
+	CurrentPage int                          `json:"currentPage"`
+	Limit       int                          `json:"limit"`
+	Runs        []services.MaintenanceRunDTO `json:"runs"`
+}
+
+// ListMaintenanceRuns godoc
+// @Summary List maintenance runs
+// @Description Get a paginated list of yt-dlp updates and rollbacks, newest first, whether started manually or by the automatic update
+// @ID listMaintenanceRuns
+// @Tags system
+// @Produce json
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Number of items per page (default: 10)"
+// @Success 200 {object} PaginatedMaintenanceRunResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/system/maintenance-runs [get]
+func (h *SystemHandler) ListMaintenanceRuns(w http.ResponseWriter, r *http.Request) {
+	page := 1
+	limit := 10
+
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	totalCount, err := h.Queries.CountMaintenanceRuns(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	runs, err := h.Queries.ListMaintenanceRuns(r.Context(), database.ListMaintenanceRunsParams{
+		Limit:  int32(limit),
+		Offset: int32((page - 1) * limit),
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	responses := make([]services.MaintenanceRunDTO, len(runs))
+	for i, run := range runs {
+		responses[i] = services.MapMaintenanceRun(run)
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, PaginatedMaintenanceRunResponse{
+		TotalCount:  totalCount,
+		TotalPages:  int((totalCount + int64(limit) - 1) / int64(limit)),
+		CurrentPage: page,
+		Limit:       limit,
+		Runs:        responses,
+	})
+}
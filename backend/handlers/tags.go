@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/Azmekk/Vidra/backend/services"
+	"github.com/Azmekk/Vidra/backend/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type TagHandler struct {
+	Queries *database.Queries
+	Tags    *services.TagService
+}
+
+func NewTagHandler(queries *database.Queries, tags *services.TagService) *TagHandler {
+	return &TagHandler{
+		Queries: queries,
+		Tags:    tags,
+	}
+}
+
+type TagResponse struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	VideoCount int64  `json:"videoCount"`
+	CreatedAt  string `json:"createdAt"`
+}
+
+func mapTagToResponse(t database.Tag) TagResponse {
+	return TagResponse{
+		ID:        t.ID.String(),
+		Name:      t.Name,
+		CreatedAt: t.CreatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+type TagRequest struct {
+	Name string `json:"name"`
+}
+
+func (r *TagRequest) Validate() error {
+	tags, err := services.NormalizeTags([]string{r.Name})
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return fmt.Errorf("name is required")
+	}
+	r.Name = tags[0]
+	return nil
+}
+
+type BulkTagRequest struct {
+	VideoIDs []string `json:"videoIds"`
+	Add      []string `json:"add"`
+	Remove   []string `json:"remove"`
+}
+
+func (r *BulkTagRequest) Validate() error {
+	if len(r.VideoIDs) == 0 {
+		return fmt.Errorf("videoIds is required")
+	}
+	add, err := services.NormalizeTags(r.Add)
+	if err != nil {
+		return err
+	}
+	remove, err := services.NormalizeTags(r.Remove)
+	if err != nil {
+		return err
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		return fmt.Errorf("add or remove is required")
+	}
+	r.Add = add
+	r.Remove = remove
+	return nil
+}
+
+// ListTags godoc
+// @Summary List tags
+// @Description Get all tags with the number of videos using each
+// @ID listTags
+// @Tags tags
+// @Produce json
+// @Success 200 {array} TagResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/tags [get]
+func (h *TagHandler) ListTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.Queries.ListTags(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	responses := make([]TagResponse, len(tags))
+	for i, t := range tags {
+		responses[i] = TagResponse{
+			ID:         t.ID.String(),
+			Name:       t.Name,
+			VideoCount: t.VideoCount,
+			CreatedAt:  t.CreatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+		}
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, responses)
+}
+
+// CreateTag godoc
+// @Summary Create a tag
+// @Description Create a tag. Names are lowercased; creating an existing tag returns it.
+// @ID createTag
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param tag body TagRequest true "Tag details"
+// @Success 201 {object} TagResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/tags [post]
+func (h *TagHandler) CreateTag(w http.ResponseWriter, r *http.Request) {
+	var req TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tag, err := h.Queries.UpsertTag(r.Context(), req.Name)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, mapTagToResponse(tag))
+}
+
+// RenameTag godoc
+// @Summary Rename a tag
+// @Description Rename a tag on every video that has it
+// @ID renameTag
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param id path string true "Tag ID"
+// @Param tag body TagRequest true "Tag details"
+// @Success 200 {object} TagResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/tags/{id} [put]
+func (h *TagHandler) RenameTag(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid tag ID")
+		return
+	}
+
+	var req TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := h.Queries.GetTag(r.Context(), id); err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Tag not found")
+		return
+	}
+
+	tag, err := h.Queries.RenameTag(r.Context(), database.RenameTagParams{
+		ID:   id,
+		Name: req.Name,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusConflict, "A tag with this name already exists")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, mapTagToResponse(tag))
+}
+
+// DeleteTag godoc
+// @Summary Delete a tag
+// @Description Delete a tag and remove it from every video
+// @ID deleteTag
+// @Tags tags
+// @Param id path string true "Tag ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/tags/{id} [delete]
+func (h *TagHandler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid tag ID")
+		return
+	}
+
+	if err := h.Queries.DeleteTag(r.Context(), id); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BulkUpdateTags godoc
+// @Summary Add and remove tags on many videos
+// @Description Add tags to and remove tags from every listed video in one request
+// @ID bulkUpdateTags
+// @Tags tags
+// @Accept json
+// @Param request body BulkTagRequest true "Videos and tags"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/tags/bulk [post]
+func (h *TagHandler) BulkUpdateTags(w http.ResponseWriter, r *http.Request) {
+	var req BulkTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	videoIDs := make([]pgtype.UUID, len(req.VideoIDs))
+	for i, idStr := range req.VideoIDs {
+		if err := videoIDs[i].Scan(idStr); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid video ID: "+idStr)
+			return
+		}
+	}
+
+	if err := h.Tags.BulkUpdate(r.Context(), videoIDs, req.Add, req.Remove); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/Azmekk/Vidra/backend/services"
+	"github.com/Azmekk/Vidra/backend/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// maxBulkVideos caps how many videos a single bulk request may target
+	maxBulkVideos = 5000
+	// bulkWaitTimeout is how long POST /api/videos/bulk waits for a job before answering with 202
+	bulkWaitTimeout = 5 * time.Second
+)
+
+var bulkActions = map[services.BulkAction]bool{
+	services.BulkActionDelete:           true,
+	services.BulkActionRetry:            true,
+	services.BulkActionReencode:         true,
+	services.BulkActionTag:              true,
+	services.BulkActionMoveToCollection: true,
+	services.BulkActionRename:           true,
+}
+
+type BulkVideosRequest struct {
+	Action           services.BulkAction `json:"action"`                     // delete, retry, reencode, tag, move_to_collection or rename
+	VideoIDs         []string            `json:"videoIds,omitempty"`         // either videoIds or filter is required
+	Filter           string              `json:"filter,omitempty"`           // ListVideos query string, e.g. "status=error&extractor=youtube"
+	AddTags          []string            `json:"addTags,omitempty"`          // tag
+	RemoveTags       []string            `json:"removeTags,omitempty"`       // tag
+	CollectionID     string              `json:"collectionId,omitempty"`     // move_to_collection
+	FromCollectionID string              `json:"fromCollectionId,omitempty"` // move_to_collection, optional
+	NameTemplate     string              `json:"nameTemplate,omitempty"`     // rename, e.g. "{uploader} - {title}"
+	EncodingOptions  *EncodingOptions    `json:"encodingOptions,omitempty"`  // reencode, optional
+	Permanent        bool                `json:"permanent,omitempty"`        // delete, skips the trash
+}
+
+func (r *BulkVideosRequest) Validate() error {
+	if !bulkActions[r.Action] {
+		return fmt.Errorf("invalid action: %s", r.Action)
+	}
+	if len(r.VideoIDs) == 0 && r.Filter == "" {
+		return fmt.Errorf("videoIds or filter is required")
+	}
+	if len(r.VideoIDs) > 0 && r.Filter != "" {
+		return fmt.Errorf("videoIds and filter cannot be combined")
+	}
+	if len(r.VideoIDs) > maxBulkVideos {
+		return fmt.Errorf("at most %d videos can be targeted at once", maxBulkVideos)
+	}
+
+	switch r.Action {
+	case services.BulkActionTag:
+		add, err := services.NormalizeTags(r.AddTags)
+		if err != nil {
+			return err
+		}
+		remove, err := services.NormalizeTags(r.RemoveTags)
+		if err != nil {
+			return err
+		}
+		if len(add) == 0 && len(remove) == 0 {
+			return fmt.Errorf("addTags or removeTags is required")
+		}
+		r.AddTags = add
+		r.RemoveTags = remove
+	case services.BulkActionMoveToCollection:
+		if r.CollectionID == "" {
+			return fmt.Errorf("collectionId is required")
+		}
+	case services.BulkActionRename:
+		if err := services.ValidateNameTemplate(r.NameTemplate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveBulkTargets returns the listed videos, or the videos matching the filter expression
+func (h *VideoHandler) resolveBulkTargets(r *http.Request, req BulkVideosRequest) ([]pgtype.UUID, error) {
+	if req.Filter == "" {
+		ids := make([]pgtype.UUID, 0, len(req.VideoIDs))
+		seen := make(map[string]bool, len(req.VideoIDs))
+		for _, idStr := range req.VideoIDs {
+			var id pgtype.UUID
+			if err := id.Scan(idStr); err != nil {
+				return nil, fmt.Errorf("invalid video ID: %s", idStr)
+			}
+			if seen[id.String()] {
+				continue
+			}
+			seen[id.String()] = true
+			ids = append(ids, id)
+		}
+		return ids, nil
+	}
+
+	q, err := url.ParseQuery(req.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %v", err)
+	}
+	filter, err := parseVideoFilter(q)
+	if err != nil {
+		return nil, err
+	}
+	filter.Viewer = viewerFromRequest(r)
+
+	ids, err := h.Queries.ListFilteredVideoIDs(r.Context(), database.ListFilteredVideoIDsParams{
+		Limit:         maxBulkVideos + 1,
+		Search:        pgtype.Text{String: q.Get("search"), Valid: true},
+		Statuses:      filter.Statuses,
+		CreatedAfter:  filter.CreatedAfter,
+		CreatedBefore: filter.CreatedBefore,
+		MinSize:       filter.MinSize,
+		MaxSize:       filter.MaxSize,
+		MinDuration:   filter.MinDuration,
+		MaxDuration:   filter.MaxDuration,
+		Uploader:      filter.Uploader,
+		Extractor:     filter.Extractor,
+		Codec:         filter.Codec,
+		Tags:          filter.Tags,
+		Watch:         filter.Watch,
+		Viewer:        filter.Viewer,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > maxBulkVideos {
+		return nil, fmt.Errorf("filter matches more than %d videos", maxBulkVideos)
+	}
+	return ids, nil
+}
+
+// BulkVideos godoc
+// @Summary Run an action on many videos
+// @Description Apply delete (to the trash unless permanent is set), retry, reencode, tag, move_to_collection or rename to the listed videos or to every video matching a filter.
+// @Description Jobs finishing within a few seconds answer with 200 and all per-item results; longer jobs answer with 202 and
+// @Description report progress through bulk_progress WebSocket events and GET /api/videos/bulk/{jobId}.
+// @ID bulkVideos
+// @Tags videos
+// @Accept json
+// @Produce json
+// @Param request body BulkVideosRequest true "Action and targets"
+// @Success 200 {object} services.BulkJobDTO
+// @Success 202 {object} services.BulkJobDTO
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/videos/bulk [post]
+func (h *VideoHandler) BulkVideos(w http.ResponseWriter, r *http.Request) {
+	var req BulkVideosRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ids, err := h.resolveBulkTargets(r, req)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	bulkReq := services.BulkRequest{
+		Action:       req.Action,
+		VideoIDs:     ids,
+		AddTags:      req.AddTags,
+		RemoveTags:   req.RemoveTags,
+		NameTemplate: req.NameTemplate,
+		Permanent:    req.Permanent,
+	}
+	if req.Action == services.BulkActionMoveToCollection {
+		if err := bulkReq.CollectionID.Scan(req.CollectionID); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid collection ID")
+			return
+		}
+		if _, err := h.Queries.GetCollection(r.Context(), bulkReq.CollectionID); err != nil {
+			utils.RespondWithError(w, http.StatusNotFound, "Collection not found")
+			return
+		}
+		if req.FromCollectionID != "" {
+			if err := bulkReq.FromCollectionID.Scan(req.FromCollectionID); err != nil {
+				utils.RespondWithError(w, http.StatusBadRequest, "Invalid collection ID")
+				return
+			}
+		}
+	}
+	if req.EncodingOptions != nil {
+		bulkReq.EncodingOptions = &services.EncodingOptions{
+			VideoCodec: req.EncodingOptions.VideoCodec,
+			AudioCodec: req.EncodingOptions.AudioCodec,
+			CRF:        req.EncodingOptions.CRF,
+		}
+	}
+
+	job, done := h.Bulk.Start(bulkReq)
+
+	select {
+	case <-done:
+		job, _ = h.Bulk.GetJob(job.ID)
+		utils.RespondWithJSON(w, http.StatusOK, job)
+	case <-time.After(bulkWaitTimeout):
+		job, _ = h.Bulk.GetJob(job.ID)
+		utils.RespondWithJSON(w, http.StatusAccepted, job)
+	}
+}
+
+// GetBulkJob godoc
+// @Summary Get a bulk operation
+// @Description Get the progress and per-item results of a bulk operation. Finished jobs are kept for an hour.
+// @ID getBulkJob
+// @Tags videos
+// @Produce json
+// @Param jobId path string true "Bulk job ID"
+// @Success 200 {object} services.BulkJobDTO
+// @Failure 404 {object} map[string]string
+// @Router /api/videos/bulk/{jobId} [get]
+func (h *VideoHandler) GetBulkJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.Bulk.GetJob(chi.URLParam(r, "jobId"))
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotFound, "Bulk job not found")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, job)
+}
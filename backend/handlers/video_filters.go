@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/Azmekk/Vidra/backend/services"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const defaultVideoOrder = "created_at_desc"
+
+var videoOrders = map[string]bool{
+	"name_asc": true, "name_desc": true,
+	"created_at_asc": true, "created_at_desc": true,
+	"status_asc": true, "status_desc": true,
+	"size_asc": true, "size_desc": true,
+	"duration_asc": true, "duration_desc": true,
+}
+
+var watchStates = map[string]bool{"unwatched": true, "in_progress": true, "watched": true}
+
+var videoStatuses = map[string]bool{
+	string(services.StatusPending):     true,
+	string(services.StatusDownloading): true,
+	string(services.StatusEncoding):    true,
+	string(services.StatusFinished):    true,
+	string(services.StatusError):       true,
+	string(services.StatusPaused):      true,
+	string(services.StatusScheduled):   true,
+	string(services.StatusImporting):   true,
+}
+
+// videoFilter holds the ListVideos filters. Unset fields are NULL and ignored by the queries.
+type videoFilter struct {
+	Statuses      []string
+	CreatedAfter  pgtype.Timestamptz
+	CreatedBefore pgtype.Timestamptz
+	MinSize       pgtype.Int8
+	MaxSize       pgtype.Int8
+	MinDuration   pgtype.Float8
+	MaxDuration   pgtype.Float8
+	Uploader      pgtype.Text
+	Extractor     pgtype.Text
+	Codec         pgtype.Text
+	Tags          []string
+	Watch         pgtype.Text
+	Viewer        string // whose watch state the Watch filter uses; set by the handler
+}
+
+func parseVideoFilter(q url.Values) (videoFilter, error) {
+	f := videoFilter{Statuses: []string{}, Tags: []string{}}
+
+	if v := q.Get("status"); v != "" {
+		for _, status := range strings.Split(v, ",") {
+			status = strings.TrimSpace(status)
+			if !videoStatuses[status] {
+				return f, fmt.Errorf("invalid status: %s", status)
+			}
+			f.Statuses = append(f.Statuses, status)
+		}
+	}
+
+	var err error
+	if f.CreatedAfter, err = parseDateParam(q, "createdAfter", false); err != nil {
+		return f, err
+	}
+	if f.CreatedBefore, err = parseDateParam(q, "createdBefore", true); err != nil {
+		return f, err
+	}
+	if f.MinSize, err = parseInt8Param(q, "minSize"); err != nil {
+		return f, err
+	}
+	if f.MaxSize, err = parseInt8Param(q, "maxSize"); err != nil {
+		return f, err
+	}
+	if f.MinDuration, err = parseFloat8Param(q, "minDuration"); err != nil {
+		return f, err
+	}
+	if f.MaxDuration, err = parseFloat8Param(q, "maxDuration"); err != nil {
+		return f, err
+	}
+
+	if v := strings.TrimSpace(q.Get("uploader")); v != "" {
+		f.Uploader = pgtype.Text{String: v, Valid: true}
+	}
+	if v := strings.TrimSpace(q.Get("extractor")); v != "" {
+		f.Extractor = pgtype.Text{String: v, Valid: true}
+	}
+	if v := services.NormalizeVideoCodec(q.Get("codec")); v != "" {
+		f.Codec = pgtype.Text{String: v, Valid: true}
+	}
+
+	if v := q.Get("tags"); v != "" {
+		if f.Tags, err = services.NormalizeTags(strings.Split(v, ",")); err != nil {
+			return f, err
+		}
+	}
+
+	if v := q.Get("watch"); v != "" {
+		if !watchStates[v] {
+			return f, fmt.Errorf("invalid watch: must be unwatched, in_progress or watched")
+		}
+		f.Watch = pgtype.Text{String: v, Valid: true}
+	}
+	return f, nil
+}
+
+// parseDateParam accepts RFC 3339 timestamps and YYYY-MM-DD dates. With endOfDay a date
+// means the end of that day, so createdBefore=2024-05-01 includes videos from May 1st.
+func parseDateParam(q url.Values, name string, endOfDay bool) (pgtype.Timestamptz, error) {
+	v := q.Get(name)
+	if v == "" {
+		return pgtype.Timestamptz{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return pgtype.Timestamptz{Time: t, Valid: true}, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return pgtype.Timestamptz{}, fmt.Errorf("invalid %s: must be a date (YYYY-MM-DD) or RFC 3339 timestamp", name)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return pgtype.Timestamptz{Time: t, Valid: true}, nil
+}
+
+func parseInt8Param(q url.Values, name string) (pgtype.Int8, error) {
+	v := q.Get(name)
+	if v == "" {
+		return pgtype.Int8{}, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return pgtype.Int8{}, fmt.Errorf("invalid %s: must be a non-negative integer", name)
+	}
+	return pgtype.Int8{Int64: n, Valid: true}, nil
+}
+
+func parseFloat8Param(q url.Values, name string) (pgtype.Float8, error) {
+	v := q.Get(name)
+	if v == "" {
+		return pgtype.Float8{}, nil
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return pgtype.Float8{}, fmt.Errorf("invalid %s: must be a non-negative number", name)
+	}
+	return pgtype.Float8{Float64: n, Valid: true}, nil
+}
+
+// videoCursor is the position after the last video of a page. It is handed to clients as an opaque
+// base64 token and is only valid for the ordering it was created with.
+type videoCursor struct {
+	Order string   `json:"o"`
+	ID    string   `json:"id"`
+	Time  string   `json:"t,omitempty"`
+	Text  string   `json:"s,omitempty"`
+	Size  *int64   `json:"z,omitempty"`
+	Num   *float64 `json:"n,omitempty"`
+}
+
+// encodeVideoCursor records the sort key of v for the given ordering
+func encodeVideoCursor(order string, v database.Video) string {
+	c := videoCursor{Order: order, ID: v.ID.String()}
+	switch order {
+	case "name_asc", "name_desc":
+		c.Text = v.Name
+	case "status_asc", "status_desc":
+		c.Text = v.DownloadStatus
+	case "size_asc", "size_desc":
+		n := int64(-1)
+		if v.FileSize.Valid {
+			n = v.FileSize.Int64
+		}
+		c.Size = &n
+	case "duration_asc", "duration_desc":
+		n := float64(-1)
+		if v.Duration.Valid {
+			n = v.Duration.Float64
+		}
+		c.Num = &n
+	default:
+		c.Time = v.CreatedAt.Time.Format(time.RFC3339Nano)
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeVideoCursor(token string) (videoCursor, error) {
+	var c videoCursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor")
+	}
+	if err := json.Unmarshal(data, &c); err != nil || !videoOrders[c.Order] {
+		return c, fmt.Errorf("invalid cursor")
+	}
+	return c, nil
+}
+
+// apply sets the cursor arguments of ListVideos
+func (c videoCursor) apply(params *database.ListVideosParams) error {
+	if err := params.CursorID.Scan(c.ID); err != nil {
+		return fmt.Errorf("invalid cursor")
+	}
+	switch {
+	case c.Size != nil:
+		params.CursorSize = pgtype.Int8{Int64: *c.Size, Valid: true}
+	case c.Num != nil:
+		params.CursorNum = pgtype.Float8{Float64: *c.Num, Valid: true}
+	case c.Time != "":
+		t, err := time.Parse(time.RFC3339Nano, c.Time)
+		if err != nil {
+			return fmt.Errorf("invalid cursor")
+		}
+		params.CursorTime = pgtype.Timestamptz{Time: t, Valid: true}
+	default:
+		params.CursorText = pgtype.Text{String: c.Text, Valid: true}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/Azmekk/Vidra/backend/services"
+	"github.com/Azmekk/Vidra/backend/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// GetVideoSprite godoc
+// @Summary Get the timeline sprite sheet
+// @Description Redirect to a URL serving the sprite sheet used by the thumbnail track. With S3 storage this is a short-lived presigned URL.
+// @ID getVideoSprite
+// @Tags videos
+// @Param id path string true "Video ID"
+// @Success 302 "Found"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/videos/{id}/sprite [get]
+func (h *VideoHandler) GetVideoSprite(w http.ResponseWriter, r *http.Request) {
+	h.redirectToStorage(w, r, func(v database.Video) pgtype.Text { return v.SpriteFileName })
+}
+
+// GetThumbnailTrack godoc
+// @Summary Get the thumbnail track
+// @Description Get a WebVTT track for hover previews. Each cue points at a tile of the sprite sheet with a #xywh media fragment.
+// @ID getThumbnailTrack
+// @Tags videos
+// @Produce text/vtt
+// @Param id path string true "Video ID"
+// @Success 200 {string} string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/videos/{id}/thumbnails.vtt [get]
+func (h *VideoHandler) GetThumbnailTrack(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	video, err := h.Queries.GetVideo(r.Context(), id)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Video not found")
+		return
+	}
+
+	sheet, ok := services.SpriteSheetFromVideo(video)
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotFound, "Sprite sheet not available")
+		return
+	}
+
+	// Cue URLs resolve relative to the track, i.e. to GET /api/videos/{id}/sprite
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, services.BuildThumbnailTrack(sheet, video.Duration.Float64, "sprite"))
+}
+
+// RegeneratePreviews godoc
+// @Summary Regenerate previews
+// @Description Rebuild the timeline sprite sheet of a completed video, and grab a thumbnail from the video if it has none
+// @ID regeneratePreviews
+// @Tags videos
+// @Produce json
+// @Param id path string true "Video ID"
+// @Success 200 {object} VideoResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/videos/{id}/previews [post]
+func (h *VideoHandler) RegeneratePreviews(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	video, err := h.Queries.GetVideo(r.Context(), id)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Video not found")
+		return
+	}
+
+	video, err = h.Previews.Generate(r.Context(), video)
+	if errors.Is(err, services.ErrNoPreviewSource) || errors.Is(err, services.ErrJobRunning) {
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, h.mapVideoWithTags(r.Context(), video))
+}
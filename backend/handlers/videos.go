@@ -4,18 +4,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"io"
-	"log"
+	"io/fs"
+	"log/slog"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/Azmekk/Vidra/backend/gen/database"
 	"github.com/Azmekk/Vidra/backend/services"
 	"github.com/Azmekk/Vidra/backend/utils"
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
@@ -23,13 +26,29 @@ type VideoHandler struct {
 	Queries    *database.Queries
 	Downloader *services.DownloaderService
 	Ws         *services.WebSocketService
+	Quota      *services.QuotaService
+	Storage    services.Storage
+	Tags       *services.TagService
+	Bulk       *services.BulkService
+	Trash      *services.TrashService
+	Watch      *services.WatchService
+	Previews   *services.PreviewService
+	Schedule   *services.ScheduleService
 }
 
-func NewVideoHandler(queries *database.Queries, downloader *services.DownloaderService, ws *services.WebSocketService) *VideoHandler {
+func NewVideoHandler(queries *database.Queries, downloader *services.DownloaderService, ws *services.WebSocketService, quota *services.QuotaService, storage services.Storage, tags *services.TagService, bulk *services.BulkService, trash *services.TrashService, watch *services.WatchService, previews *services.PreviewService, schedule *services.ScheduleService) *VideoHandler {
 	return &VideoHandler{
 		Queries:    queries,
 		Downloader: downloader,
 		Ws:         ws,
+		Quota:      quota,
+		Storage:    storage,
+		Tags:       tags,
+		Bulk:       bulk,
+		Trash:      trash,
+		Watch:      watch,
+		Previews:   previews,
+		Schedule:   schedule,
 	}
 }
 
@@ -89,12 +108,23 @@ type EncodingOptions struct {
 	CRF        int    `json:"crf"`
 }
 
+type SponsorBlockOptions struct {
+	Mode       string   `json:"mode"`                 // mark (add segments as chapters) or remove (cut them out)
+	Categories []string `json:"categories,omitempty"` // sponsor, intro, outro, selfpromo, ...; default: all when marking, sponsor when removing
+}
+
 type CreateVideoRequest struct {
-	Name            string           `json:"name"`
-	DownloadURL     string           `json:"downloadUrl"`
-	FormatID        string           `json:"formatId"`
-	ReEncode        bool             `json:"reEncode"`
-	EncodingOptions *EncodingOptions `json:"encodingOptions,omitempty"`
+	Name            string                 `json:"name"`
+	DownloadURL     string                 `json:"downloadUrl"`
+	FormatID        string                 `json:"formatId"`
+	FormatPolicy    *services.FormatPolicy `json:"formatPolicy,omitempty"` // instead of formatId, e.g. {"maxHeight": 1080, "codecs": ["av1", "vp9", "h264"]}; default: the settings' policy
+	ReEncode        bool                   `json:"reEncode"`
+	EncodingOptions *EncodingOptions       `json:"encodingOptions,omitempty"`
+	Tags            []string               `json:"tags,omitempty"`
+	SponsorBlock    *SponsorBlockOptions   `json:"sponsorBlock,omitempty"`
+	YtdlpOptions    []string               `json:"ytdlpOptions,omitempty"` // extra yt-dlp options from the allow-list, e.g. ["--limit-rate", "5M"], added after the global ones
+	RateLimit       string                 `json:"rateLimit,omitempty"`    // download speed limit in bytes per second, e.g. 5M; default: the global rate limit
+	StartNow        bool                   `json:"startNow,omitempty"`     // start right away even outside the download windows
 }
 
 func (r *CreateVideoRequest) Validate() error {
@@ -104,19 +134,60 @@ func (r *CreateVideoRequest) Validate() error {
 	if r.DownloadURL == "" {
 		return fmt.Errorf("downloadUrl is required")
 	}
-	return nil
+	if r.FormatID != "" && r.FormatPolicy != nil {
+		return fmt.Errorf("formatId and formatPolicy cannot both be set")
+	}
+	if r.FormatPolicy != nil {
+		if err := services.ValidateFormatPolicy(*r.FormatPolicy); err != nil {
+			return err
+		}
+	}
+	tags, err := services.NormalizeTags(r.Tags)
+	if err != nil {
+		return err
+	}
+	r.Tags = tags
+	if r.SponsorBlock != nil {
+		if err := services.ValidateSponsorBlock(&services.SponsorBlockOptions{Mode: r.SponsorBlock.Mode, Categories: r.SponsorBlock.Categories}); err != nil {
+			return err
+		}
+	}
+	ytdlpOptions, err := services.NormalizeYtdlpOptions(r.YtdlpOptions)
+	if err != nil {
+		return err
+	}
+	r.YtdlpOptions = ytdlpOptions
+	return services.ValidateRateLimit(r.RateLimit)
 }
 
 type VideoResponse struct {
-	ID                string `json:"id"`
-	Name              string `json:"name"`
-	FileName          string `json:"fileName,omitempty"`
-	ThumbnailFileName string `json:"thumbnailFileName,omitempty"`
-	DownloadURL       string `json:"downloadUrl"`
-	DownloadStatus    string `json:"downloadStatus"`
-	FileSize          *int64 `json:"fileSize,omitempty"`
-	CreatedAt         string `json:"createdAt"`
-	UpdatedAt         string `json:"updatedAt"`
+	ID                string             `json:"id"`
+	Name              string             `json:"name"`
+	FileName          string             `json:"fileName,omitempty"`
+	ThumbnailFileName string             `json:"thumbnailFileName,omitempty"`
+	SpriteFileName    string             `json:"spriteFileName,omitempty"`
+	ThumbnailTrackURL string             `json:"thumbnailTrackUrl,omitempty"` // WebVTT track of sprite sheet tiles for hover previews
+	DownloadURL       string             `json:"downloadUrl"`
+	DownloadStatus    string             `json:"downloadStatus"`
+	FileSize          *int64             `json:"fileSize,omitempty"`
+	Pinned            bool               `json:"pinned"`
+	Uploader          string             `json:"uploader,omitempty"`
+	UploadDate        string             `json:"uploadDate,omitempty"` // YYYY-MM-DD
+	Extractor         string             `json:"extractor,omitempty"`
+	Description       string             `json:"description,omitempty"`
+	Duration          *float64           `json:"duration,omitempty"`   // seconds
+	VideoCodec        string             `json:"videoCodec,omitempty"` // h264, hevc, vp9, av1, ...
+	Tags              []string           `json:"tags,omitempty"`
+	Chapters          []services.Chapter `json:"chapters,omitempty"`
+	SearchRank        *float32           `json:"searchRank,omitempty"` // only set by full-text search
+	Snippet           string             `json:"snippet,omitempty"`    // matched text with <mark> highlights, only set by full-text search
+	CreatedAt         string             `json:"createdAt"`
+	UpdatedAt         string             `json:"updatedAt"`
+	DeletedAt         string             `json:"deletedAt,omitempty"`   // set while the video is in the trash
+	ScheduledAt       string             `json:"scheduledAt,omitempty"` // when a scheduled download will start, i.e. the next download window
+
+	Playback  *services.WatchProgressDTO `json:"playback,omitempty"`  // the viewer's watch state, if they played the video
+	MediaInfo *services.MediaInfo        `json:"mediaInfo,omitempty"` // ffprobe summary, only set by GET /api/videos/{id}
 }
 
 func mapVideoToResponse(v database.Video) VideoResponse {
@@ -127,18 +198,66 @@ func mapVideoToResponse(v database.Video) VideoResponse {
 		ThumbnailFileName: v.ThumbnailFileName.String,
 		DownloadURL:       v.OriginalUrl,
 		DownloadStatus:    v.DownloadStatus,
+		Pinned:            v.Pinned,
+		Uploader:          v.Uploader.String,
+		Extractor:         v.Extractor.String,
+		Description:       v.Description.String,
+		VideoCodec:        v.VideoCodec.String,
 		CreatedAt:         v.CreatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
 		UpdatedAt:         v.UpdatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
 	}
 	if v.FileSize.Valid {
 		resp.FileSize = &v.FileSize.Int64
 	}
+	if v.UploadDate.Valid {
+		resp.UploadDate = v.UploadDate.Time.Format("2006-01-02")
+	}
+	if v.Duration.Valid {
+		resp.Duration = &v.Duration.Float64
+	}
+	if v.DeletedAt.Valid {
+		resp.DeletedAt = v.DeletedAt.Time.Format("2006-01-02T15:04:05Z07:00")
+	}
+	if v.ScheduledAt.Valid && v.DownloadStatus == string(services.StatusScheduled) {
+		resp.ScheduledAt = v.ScheduledAt.Time.Format("2006-01-02T15:04:05Z07:00")
+	}
+	resp.Chapters = services.ParseChapters(v.Chapters)
+	if _, ok := services.SpriteSheetFromVideo(v); ok {
+		resp.SpriteFileName = v.SpriteFileName.String
+		resp.ThumbnailTrackURL = "/api/videos/" + resp.ID + "/thumbnails.vtt"
+	}
 	return resp
 }
 
-// backfillFileSize checks if a video is missing file_size and attempts to read it from disk.
+// mapVideosWithTags maps videos to responses and fills in their tags
+func mapVideosWithTags(ctx context.Context, tags *services.TagService, videos []database.Video) []VideoResponse {
+	responses := make([]VideoResponse, len(videos))
+	ids := make([]pgtype.UUID, len(videos))
+	for i, v := range videos {
+		responses[i] = mapVideoToResponse(v)
+		ids[i] = v.ID
+	}
+
+	videoTags, err := tags.TagsForVideos(ctx, ids)
+	if err != nil {
+		slog.Warn("Failed to load video tags", "error", err)
+		return responses
+	}
+	for i := range responses {
+		if t, ok := videoTags[responses[i].ID]; ok {
+			responses[i].Tags = t
+		}
+	}
+	return responses
+}
+
+func (h *VideoHandler) mapVideoWithTags(ctx context.Context, video database.Video) VideoResponse {
+	return mapVideosWithTags(ctx, h.Tags, []database.Video{video})[0]
+}
+
+// backfillFileSize checks if a video is missing file_size and attempts to read it from storage.
 // If found, it updates the database in the background and sets the size on the video struct.
-func (h *VideoHandler) backfillFileSize(video *database.Video) {
+func (h *VideoHandler) backfillFileSize(ctx context.Context, video *database.Video) {
 	if video.FileSize.Valid && video.FileSize.Int64 > 0 {
 		return // Already has size
 	}
@@ -146,10 +265,9 @@ func (h *VideoHandler) backfillFileSize(video *database.Video) {
 		return // Not ready or no file
 	}
 
-	path := filepath.Join("downloads", video.FileName.String)
-	info, err := os.Stat(path)
+	info, err := h.Storage.Stat(ctx, video.FileName.String)
 	if err != nil {
-		return // File not found
+		return // File not found; reported and fixed by POST /api/system/reconcile
 	}
 
 	// Update in background (don't block response)
@@ -158,12 +276,12 @@ func (h *VideoHandler) backfillFileSize(video *database.Video) {
 			ID:                video.ID,
 			FileName:          video.FileName,
 			ThumbnailFileName: video.ThumbnailFileName,
-			FileSize:          pgtype.Int8{Int64: info.Size(), Valid: true},
+			FileSize:          pgtype.Int8{Int64: info.Size, Valid: true},
 		})
 	}()
 
 	// Set on video for immediate response
-	video.FileSize = pgtype.Int8{Int64: info.Size(), Valid: true}
+	video.FileSize = pgtype.Int8{Int64: info.Size, Valid: true}
 }
 
 // CreateVideo godoc
@@ -177,25 +295,26 @@ func (h *VideoHandler) backfillFileSize(video *database.Video) {
 // @Success 201 {object} VideoResponse
 // @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 507 {object} map[string]string
 // @Router /api/videos [post]
 func (h *VideoHandler) CreateVideo(w http.ResponseWriter, r *http.Request) {
 	// Read body for logging
 	bodyBytes, _ := io.ReadAll(r.Body)
-	log.Printf("DEBUG: CreateVideo raw body: %s\n", string(bodyBytes))
+	slog.Debug("CreateVideo raw body", "body", string(bodyBytes))
 	// Restore body for json decoder
 	r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
 	var req CreateVideoRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("ERROR: Failed to decode CreateVideo request: %v\n", err)
+		slog.Error("Failed to decode CreateVideo request", "error", err)
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
-	log.Printf("DEBUG: CreateVideo parsed request: %+v\n", req)
+	slog.Debug("CreateVideo parsed request", "request", req)
 
 	if err := req.Validate(); err != nil {
-		log.Printf("ERROR: CreateVideo validation failed: %v\n", err)
+		slog.Error("CreateVideo validation failed", "error", err)
 		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -206,37 +325,211 @@ func (h *VideoHandler) CreateVideo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("INFO: Received request to download video: Name='%s', URL='%s', FormatID='%s'\n", req.Name, sanitizedURL, req.FormatID)
+	slog.Info("Received request to download video", "name", req.Name, "url", sanitizedURL, "format_id", req.FormatID)
+
+	downloadReq := services.DownloadRequest{
+		URL:          sanitizedURL,
+		FormatID:     req.FormatID,
+		FormatPolicy: req.FormatPolicy,
+		Name:         req.Name,
+		ReEncode:     req.ReEncode,
+		YtdlpOptions: req.YtdlpOptions,
+		RateLimit:    req.RateLimit,
+	}
+	if req.EncodingOptions != nil {
+		downloadReq.EncodingOptions = &services.EncodingOptions{
+			VideoCodec: req.EncodingOptions.VideoCodec,
+			AudioCodec: req.EncodingOptions.AudioCodec,
+			CRF:        req.EncodingOptions.CRF,
+		}
+	}
+	if req.SponsorBlock != nil {
+		downloadReq.SponsorBlock = &services.SponsorBlockOptions{
+			Mode:       req.SponsorBlock.Mode,
+			Categories: req.SponsorBlock.Categories,
+		}
+	}
+	// Resolves and stores the download size, so later starts of the job need not ask yt-dlp again
+	if !h.checkQuota(w, r, pgtype.UUID{}, &downloadReq) {
+		return
+	}
+	downloadOptions, err := json.Marshal(downloadReq)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Outside the download windows the job waits in the scheduled status unless it should start now
+	startAt, wait := h.Schedule.NextStart(r.Context())
+	wait = wait && !req.StartNow
+	status := services.StatusDownloading
+	if wait {
+		status = services.StatusScheduled
+	}
 
 	video, err := h.Queries.CreateVideo(r.Context(), database.CreateVideoParams{
-		Name:           req.Name,
-		OriginalUrl:    sanitizedURL,
-		DownloadStatus: string(services.StatusDownloading),
+		Name:            req.Name,
+		OriginalUrl:     sanitizedURL,
+		DownloadStatus:  string(status),
+		DownloadOptions: downloadOptions,
 	})
 	if err != nil {
-		log.Printf("ERROR: Failed to create video record in database: %v\n", err)
+		slog.Error("Failed to create video record in database", "error", err)
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	idStr := video.ID.String()
-	log.Printf("INFO: Successfully created video record in database: ID=%s\n", idStr)
+	slog.Info("Created video record in database", "video_id", idStr)
 
-	// Start background download
-	log.Printf("INFO: Starting background download for video ID=%s\n", idStr)
-	var encodingOpts *services.EncodingOptions
-	if req.EncodingOptions != nil {
-		encodingOpts = &services.EncodingOptions{
-			VideoCodec: req.EncodingOptions.VideoCodec,
-			AudioCodec: req.EncodingOptions.AudioCodec,
-			CRF:        req.EncodingOptions.CRF,
+	if len(req.Tags) > 0 {
+		if err := h.Tags.SetVideoTags(r.Context(), video.ID, req.Tags); err != nil {
+			slog.Error("Failed to tag video", "video_id", idStr, "error", err)
 		}
 	}
-	h.Downloader.StartDownload(context.Background(), video.ID, sanitizedURL, req.FormatID, req.Name, req.ReEncode, encodingOpts)
 
+	if wait {
+		if video, err = h.Schedule.Schedule(r.Context(), video.ID, startAt); err != nil {
+			slog.Error("Failed to schedule download", "video_id", idStr, "error", err)
+		}
+	} else {
+		// Start background download
+		slog.Info("Starting background download", "video_id", idStr)
+		h.Downloader.StartDownload(context.Background(), video.ID, downloadReq)
+	}
+
+	h.BroadcastCreated(video)
+
+	resp := mapVideoToResponse(video)
+	resp.Tags = req.Tags
+	utils.RespondWithJSON(w, http.StatusCreated, resp)
+}
+
+// BroadcastCreated notifies connected clients about a new video
+func (h *VideoHandler) BroadcastCreated(video database.Video) {
 	h.Ws.Broadcast(services.WsEventVideoCreated, mapVideoToResponse(video))
+}
+
+// checkQuota refuses the request with 507 if the download would breach the disk limits or its size is
+// unknown while a limit is configured. For a stored video (a valid id) the size estimate is saved with its
+// download options.
+func (h *VideoHandler) checkQuota(w http.ResponseWriter, r *http.Request, id pgtype.UUID, req *services.DownloadRequest) bool {
+	var err error
+	if id.Valid {
+		err = h.Downloader.CheckStoredQuota(r.Context(), id, req)
+	} else {
+		err = h.Downloader.CheckQuota(r.Context(), req)
+	}
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		utils.RespondWithError(w, http.StatusInsufficientStorage, err.Error())
+		return false
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	return true
+}
+
+// ResumeVideo godoc
+// @Summary Resume a paused download
+// @Description Restart a download that was paused because the disk limits were reached. yt-dlp continues from the partial file.
+// @ID resumeVideo
+// @Tags videos
+// @Produce json
+// @Param id path string true "Video ID"
+// @Success 200 {object} VideoResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 507 {object} map[string]string
+// @Router /api/videos/{id}/resume [post]
+func (h *VideoHandler) ResumeVideo(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	var id pgtype.UUID
+	if err := id.Scan(idStr); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	video, err := h.Queries.GetVideo(r.Context(), id)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Video not found")
+		return
+	}
+
+	if video.DownloadStatus != string(services.StatusPaused) {
+		utils.RespondWithError(w, http.StatusConflict, "Only paused downloads can be resumed")
+		return
+	}
+
+	var downloadReq services.DownloadRequest
+	if err := json.Unmarshal(video.DownloadOptions, &downloadReq); err != nil || downloadReq.URL == "" {
+		utils.RespondWithError(w, http.StatusConflict, "Download options were not stored for this video")
+		return
+	}
+
+	if !h.checkQuota(w, r, video.ID, &downloadReq) {
+		return
+	}
+
+	video, err = h.Queries.UpdateVideoStatus(r.Context(), database.UpdateVideoStatusParams{
+		ID:             id,
+		DownloadStatus: string(services.StatusDownloading),
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 
-	utils.RespondWithJSON(w, http.StatusCreated, mapVideoToResponse(video))
+	slog.Info("Resuming paused download", "video_id", idStr)
+	h.Downloader.StartDownload(context.Background(), video.ID, downloadReq)
+
+	utils.RespondWithJSON(w, http.StatusOK, h.mapVideoWithTags(r.Context(), video))
+}
+
+// StartVideo godoc
+// @Summary Start a scheduled download now
+// @Description Start a download that is waiting for the next download window right away
+// @ID startVideo
+// @Tags videos
+// @Produce json
+// @Param id path string true "Video ID"
+// @Success 200 {object} VideoResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 507 {object} map[string]string
+// @Router /api/videos/{id}/start [post]
+func (h *VideoHandler) StartVideo(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	video, err := h.Schedule.StartNow(r.Context(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.RespondWithError(w, http.StatusNotFound, "Video not found")
+		return
+	}
+	if errors.Is(err, services.ErrNotScheduled) {
+		utils.RespondWithError(w, http.StatusConflict, "Only scheduled downloads can be started early")
+		return
+	}
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		utils.RespondWithError(w, http.StatusInsufficientStorage, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	slog.Info("Started scheduled download early", "video_id", id.String())
+	utils.RespondWithJSON(w, http.StatusOK, h.mapVideoWithTags(r.Context(), video))
 }
 
 // GetProgress godoc
@@ -265,6 +558,64 @@ func (h *VideoHandler) GetProgress(w http.ResponseWriter, r *http.Request) {
 	utils.RespondWithJSON(w, http.StatusOK, progress)
 }
 
+type VideoLogResponse struct {
+	Command   string `json:"command"`
+	Output    string `json:"output"`
+	ExitCode  *int   `json:"exitCode"` // nil while the process is still running
+	CreatedAt string `json:"createdAt,omitempty"`
+}
+
+// GetLogs godoc
+// @Summary Get job logs
+// @Description Get the complete yt-dlp, ffprobe and ffmpeg output captured for a video's download job, including the process that is currently running
+// @ID getVideoLogs
+// @Tags videos
+// @Produce json
+// @Param id path string true "Video ID"
+// @Success 200 {array} VideoLogResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/videos/{id}/logs [get]
+func (h *VideoHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	var id pgtype.UUID
+	if err := id.Scan(idStr); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	if _, err := h.Queries.GetVideo(r.Context(), id); err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Video not found")
+		return
+	}
+
+	logs, err := h.Queries.ListVideoLogs(r.Context(), id)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	responses := make([]VideoLogResponse, 0, len(logs)+1)
+	for _, l := range logs {
+		exitCode := int(l.ExitCode)
+		responses = append(responses, VideoLogResponse{
+			Command:   l.Command,
+			Output:    l.Output,
+			ExitCode:  &exitCode,
+			CreatedAt: l.CreatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+	if live, ok := h.Downloader.GetLiveLog(id.String()); ok {
+		responses = append(responses, VideoLogResponse{
+			Command: live.Command,
+			Output:  live.Output,
+		})
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, responses)
+}
+
 // ListAllProgress godoc
 // @Summary List all video download progress
 // @Description Get the current download progress for all active video downloads
@@ -287,6 +638,7 @@ func (h *VideoHandler) ListAllProgress(w http.ResponseWriter, r *http.Request) {
 // @Accept json
 // @Produce json
 // @Param id path string true "Video ID"
+// @Param Remote-User header string false "Viewer whose watch state is returned (default: default)"
 // @Success 200 {object} VideoResponse
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
@@ -305,37 +657,132 @@ func (h *VideoHandler) GetVideo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.backfillFileSize(&video)
-	utils.RespondWithJSON(w, http.StatusOK, mapVideoToResponse(video))
+	h.backfillFileSize(r.Context(), &video)
+	responses := []VideoResponse{h.mapVideoWithTags(r.Context(), video)}
+	h.attachPlayback(r, responses)
+	if len(video.MediaInfo) > 0 {
+		var info services.MediaInfo
+		if err := json.Unmarshal(video.MediaInfo, &info); err == nil {
+			responses[0].MediaInfo = &info
+		}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, responses[0])
+}
+
+// GetVideoFile godoc
+// @Summary Get the video file
+// @Description Redirect to a URL serving the video file. With S3 storage this is a short-lived presigned URL.
+// @ID getVideoFile
+// @Tags videos
+// @Param id path string true "Video ID"
+// @Success 302 "Found"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/videos/{id}/file [get]
+func (h *VideoHandler) GetVideoFile(w http.ResponseWriter, r *http.Request) {
+	h.redirectToStorage(w, r, func(v database.Video) pgtype.Text { return v.FileName })
+}
+
+// GetVideoThumbnail godoc
+// @Summary Get the video thumbnail
+// @Description Redirect to a URL serving the thumbnail. With S3 storage this is a short-lived presigned URL.
+// @ID getVideoThumbnail
+// @Tags videos
+// @Param id path string true "Video ID"
+// @Success 302 "Found"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/videos/{id}/thumbnail [get]
+func (h *VideoHandler) GetVideoThumbnail(w http.ResponseWriter, r *http.Request) {
+	h.redirectToStorage(w, r, func(v database.Video) pgtype.Text { return v.ThumbnailFileName })
+}
+
+func (h *VideoHandler) redirectToStorage(w http.ResponseWriter, r *http.Request, key func(database.Video) pgtype.Text) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	video, err := h.Queries.GetVideo(r.Context(), id)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Video not found")
+		return
+	}
+
+	fileKey := key(video)
+	if !fileKey.Valid || fileKey.String == "" {
+		utils.RespondWithError(w, http.StatusNotFound, "File not available")
+		return
+	}
+	if _, err := h.Storage.Stat(r.Context(), fileKey.String); errors.Is(err, fs.ErrNotExist) {
+		utils.RespondWithError(w, http.StatusNotFound, "File not found in storage")
+		return
+	}
+
+	url, err := h.Storage.URL(r.Context(), fileKey.String)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, url, http.StatusFound)
 }
 
 type PaginatedVideoResponse struct {
-	TotalCount  int64           `json:"totalCount"`
-	TotalPages  int             `json:"totalPages"`
-	CurrentPage int             `json:"currentPage"`
+	TotalCount  *int64          `json:"totalCount,omitempty"`  // not set with cursor pagination
+	TotalPages  *int            `json:"totalPages,omitempty"`  // not set with cursor pagination
+	CurrentPage *int            `json:"currentPage,omitempty"` // not set with cursor pagination
 	Limit       int             `json:"limit"`
+	NextCursor  string          `json:"nextCursor,omitempty"` // set with cursor pagination when there are more videos
+	HasMore     *bool           `json:"hasMore,omitempty"`    // not set with offset pagination
 	Videos      []VideoResponse `json:"videos"`
 }
 
+// searchModeFTS switches the search query param from substring matching on name and URL
+// to ranked full-text search over name, description, uploader, tags and subtitles
+const searchModeFTS = "fts"
+
 // ListVideos godoc
 // @Summary List all videos
-// @Description Get a paginated list of all videos with optional searching and ordering
+// @Description Get a list of videos with optional searching, filtering and ordering. Pages are selected either with page (offset pagination)
+// @Description or with cursor (keyset pagination, stable while new videos are added): pass an empty cursor for the first page and the returned nextCursor for the following ones.
+// @Description Cursor pagination skips the total count and is not available with mode=fts.
 // @ID listVideos
 // @Tags videos
 // @Accept json
 // @Produce json
-// @Param search query string false "Search by name or URL"
-// @Param order query string false "Order by (name_asc, name_desc, created_at_asc, created_at_desc, status_asc, status_desc)"
+// @Param search query string false "Search by name or URL, or with mode=fts a full-text query (supports \"quoted phrases\", OR and -exclusions)"
+// @Param mode query string false "Search mode: empty for substring matching or fts for ranked full-text search with snippets"
+// @Param status query string false "Comma-separated download statuses"
+// @Param createdAfter query string false "Only videos created at or after this date (YYYY-MM-DD) or RFC 3339 timestamp"
+// @Param createdBefore query string false "Only videos created before this RFC 3339 timestamp, or up to the end of this date (YYYY-MM-DD)"
+// @Param minSize query int false "Minimum file size in bytes"
+// @Param maxSize query int false "Maximum file size in bytes"
+// @Param minDuration query number false "Minimum duration in seconds"
+// @Param maxDuration query number false "Maximum duration in seconds"
+// @Param uploader query string false "Uploader (case-insensitive exact match)"
+// @Param extractor query string false "yt-dlp extractor, e.g. youtube (case-insensitive exact match)"
+// @Param codec query string false "Video codec family, e.g. h264, hevc, vp9, av1"
+// @Param tags query string false "Comma-separated tags; only videos with all of them are returned"
+// @Param watch query string false "Watch state of the viewer (unwatched, in_progress, watched)"
+// @Param Remote-User header string false "Viewer whose watch state is used and returned (default: default)"
+// @Param order query string false "Order by (name_asc, name_desc, created_at_asc, created_at_desc, status_asc, status_desc, size_asc, size_desc, duration_asc, duration_desc)"
 // @Param page query int false "Page number (default: 1)"
+// @Param cursor query string false "Cursor from nextCursor; switches to cursor pagination"
 // @Param limit query int false "Number of items per page (default: 10)"
 // @Success 200 {object} PaginatedVideoResponse
+// @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /api/videos [get]
 func (h *VideoHandler) ListVideos(w http.ResponseWriter, r *http.Request) {
-	search := r.URL.Query().Get("search")
-	order := r.URL.Query().Get("order")
-	pageStr := r.URL.Query().Get("page")
-	limitStr := r.URL.Query().Get("limit")
+	query := r.URL.Query()
+	search := query.Get("search")
+	order := query.Get("order")
+	pageStr := query.Get("page")
+	limitStr := query.Get("limit")
 
 	page := 1
 	limit := 10
@@ -347,40 +794,222 @@ func (h *VideoHandler) ListVideos(w http.ResponseWriter, r *http.Request) {
 		limit = l
 	}
 
-	offset := (page - 1) * limit
+	if order == "" {
+		order = defaultVideoOrder
+	}
+	if !videoOrders[order] {
+		utils.RespondWithError(w, http.StatusBadRequest, "invalid order: "+order)
+		return
+	}
 
-	searchParam := pgtype.Text{String: search, Valid: true}
-	orderParam := pgtype.Text{String: order, Valid: true}
+	filter, err := parseVideoFilter(query)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.Viewer = viewerFromRequest(r)
 
-	totalCount, err := h.Queries.CountVideos(r.Context(), searchParam)
+	mode := query.Get("mode")
+	if mode != "" && mode != searchModeFTS {
+		utils.RespondWithError(w, http.StatusBadRequest, "invalid mode: must be fts")
+		return
+	}
+	useCursor := query.Has("cursor")
+	if mode == searchModeFTS && strings.TrimSpace(search) != "" {
+		if useCursor {
+			utils.RespondWithError(w, http.StatusBadRequest, "cursor pagination is not supported with mode=fts")
+			return
+		}
+		h.searchVideos(w, r, search, filter, page, limit)
+		return
+	}
+
+	params := database.ListVideosParams{
+		Search:        pgtype.Text{String: search, Valid: true},
+		Ordering:      pgtype.Text{String: order, Valid: true},
+		Statuses:      filter.Statuses,
+		CreatedAfter:  filter.CreatedAfter,
+		CreatedBefore: filter.CreatedBefore,
+		MinSize:       filter.MinSize,
+		MaxSize:       filter.MaxSize,
+		MinDuration:   filter.MinDuration,
+		MaxDuration:   filter.MaxDuration,
+		Uploader:      filter.Uploader,
+		Extractor:     filter.Extractor,
+		Codec:         filter.Codec,
+		Tags:          filter.Tags,
+		Watch:         filter.Watch,
+		Viewer:        filter.Viewer,
+		Limit:         int32(limit),
+		Offset:        int32((page - 1) * limit),
+	}
+
+	if useCursor {
+		h.listVideosByCursor(w, r, params, query.Get("cursor"))
+		return
+	}
+
+	totalCount, err := h.Queries.CountVideos(r.Context(), database.CountVideosParams{
+		Search:        params.Search,
+		Statuses:      filter.Statuses,
+		CreatedAfter:  filter.CreatedAfter,
+		CreatedBefore: filter.CreatedBefore,
+		MinSize:       filter.MinSize,
+		MaxSize:       filter.MaxSize,
+		MinDuration:   filter.MinDuration,
+		MaxDuration:   filter.MaxDuration,
+		Uploader:      filter.Uploader,
+		Extractor:     filter.Extractor,
+		Codec:         filter.Codec,
+		Tags:          filter.Tags,
+		Watch:         filter.Watch,
+		Viewer:        filter.Viewer,
+	})
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	videos, err := h.Queries.ListVideos(r.Context(), database.ListVideosParams{
-		Search:   searchParam,
-		Ordering: orderParam,
-		Limit:    int32(limit),
-		Offset:   int32(offset),
-	})
+	videos, err := h.Queries.ListVideos(r.Context(), params)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	responses := make([]VideoResponse, len(videos))
 	for i := range videos {
-		h.backfillFileSize(&videos[i])
-		responses[i] = mapVideoToResponse(videos[i])
+		h.backfillFileSize(r.Context(), &videos[i])
+	}
+	responses := mapVideosWithTags(r.Context(), h.Tags, videos)
+	h.attachPlayback(r, responses)
+
+	respondWithVideoPage(w, responses, totalCount, page, limit)
+}
+
+// listVideosByCursor answers ListVideos with keyset pagination. One extra row is fetched to know whether there is a next page.
+func (h *VideoHandler) listVideosByCursor(w http.ResponseWriter, r *http.Request, params database.ListVideosParams, token string) {
+	order := params.Ordering.String
+	if token != "" {
+		cursor, err := decodeVideoCursor(token)
+		if err == nil && cursor.Order != order {
+			err = fmt.Errorf("cursor was created for order %s", cursor.Order)
+		}
+		if err == nil {
+			err = cursor.apply(&params)
+		}
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	limit := int(params.Limit)
+	params.Limit++
+	params.Offset = 0
+
+	videos, err := h.Queries.ListVideos(r.Context(), params)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	nextCursor := ""
+	hasMore := len(videos) > limit
+	if hasMore {
+		videos = videos[:limit]
+		nextCursor = encodeVideoCursor(order, videos[limit-1])
+	}
+
+	for i := range videos {
+		h.backfillFileSize(r.Context(), &videos[i])
+	}
+
+	responses := mapVideosWithTags(r.Context(), h.Tags, videos)
+	h.attachPlayback(r, responses)
+
+	utils.RespondWithJSON(w, http.StatusOK, PaginatedVideoResponse{
+		Limit:      limit,
+		NextCursor: nextCursor,
+		HasMore:    &hasMore,
+		Videos:     responses,
+	})
+}
+
+// searchVideos answers ListVideos with mode=fts: videos matching the full-text query, best match first
+func (h *VideoHandler) searchVideos(w http.ResponseWriter, r *http.Request, query string, filter videoFilter, page, limit int) {
+	totalCount, err := h.Queries.CountSearchVideos(r.Context(), database.CountSearchVideosParams{
+		Query:         query,
+		Statuses:      filter.Statuses,
+		CreatedAfter:  filter.CreatedAfter,
+		CreatedBefore: filter.CreatedBefore,
+		MinSize:       filter.MinSize,
+		MaxSize:       filter.MaxSize,
+		MinDuration:   filter.MinDuration,
+		MaxDuration:   filter.MaxDuration,
+		Uploader:      filter.Uploader,
+		Extractor:     filter.Extractor,
+		Codec:         filter.Codec,
+		Tags:          filter.Tags,
+		Watch:         filter.Watch,
+		Viewer:        filter.Viewer,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
+	rows, err := h.Queries.SearchVideos(r.Context(), database.SearchVideosParams{
+		Query:         query,
+		Statuses:      filter.Statuses,
+		CreatedAfter:  filter.CreatedAfter,
+		CreatedBefore: filter.CreatedBefore,
+		MinSize:       filter.MinSize,
+		MaxSize:       filter.MaxSize,
+		MinDuration:   filter.MinDuration,
+		MaxDuration:   filter.MaxDuration,
+		Uploader:      filter.Uploader,
+		Extractor:     filter.Extractor,
+		Codec:         filter.Codec,
+		Tags:          filter.Tags,
+		Watch:         filter.Watch,
+		Viewer:        filter.Viewer,
+		Limit:         int32(limit),
+		Offset:        int32((page - 1) * limit),
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	videos := make([]database.Video, len(rows))
+	for i := range rows {
+		h.backfillFileSize(r.Context(), &rows[i].Video)
+		videos[i] = rows[i].Video
+	}
+	responses := mapVideosWithTags(r.Context(), h.Tags, videos)
+	for i, row := range rows {
+		rank := row.Rank
+		responses[i].SearchRank = &rank
+		responses[i].Snippet = escapeSnippet(row.Snippet)
+	}
+	h.attachPlayback(r, responses)
+
+	respondWithVideoPage(w, responses, totalCount, page, limit)
+}
+
+// escapeSnippet HTML-escapes a ts_headline snippet while keeping its <mark> highlights, so clients can render it as HTML
+func escapeSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, "&lt;mark&gt;", "<mark>")
+	return strings.ReplaceAll(escaped, "&lt;/mark&gt;", "</mark>")
+}
+
+func respondWithVideoPage(w http.ResponseWriter, responses []VideoResponse, totalCount int64, page, limit int) {
 	totalPages := int((totalCount + int64(limit) - 1) / int64(limit))
 
 	utils.RespondWithJSON(w, http.StatusOK, PaginatedVideoResponse{
-		TotalCount:  totalCount,
-		TotalPages:  totalPages,
-		CurrentPage: page,
+		TotalCount:  &totalCount,
+		TotalPages:  &totalPages,
+		CurrentPage: &page,
 		Limit:       limit,
 		Videos:      responses,
 	})
@@ -439,20 +1068,126 @@ func (h *VideoHandler) UpdateVideo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusOK, mapVideoToResponse(video))
+	utils.RespondWithJSON(w, http.StatusOK, h.mapVideoWithTags(r.Context(), video))
+}
+
+type PinVideoRequest struct {
+	Pinned bool `json:"pinned"`
+}
+
+// PinVideo godoc
+// @Summary Pin or unpin a video
+// @Description Pinned videos are exempt from retention rules
+// @ID pinVideo
+// @Tags videos
+// @Accept json
+// @Produce json
+// @Param id path string true "Video ID"
+// @Param request body PinVideoRequest true "Pin state"
+// @Success 200 {object} VideoResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/videos/{id}/pin [put]
+func (h *VideoHandler) PinVideo(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	var id pgtype.UUID
+	if err := id.Scan(idStr); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	var req PinVideoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	video, err := h.Queries.UpdateVideoPinned(r.Context(), database.UpdateVideoPinnedParams{
+		ID:     id,
+		Pinned: req.Pinned,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Video not found")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, h.mapVideoWithTags(r.Context(), video))
+}
+
+type SetVideoTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+func (r *SetVideoTagsRequest) Validate() error {
+	tags, err := services.NormalizeTags(r.Tags)
+	if err != nil {
+		return err
+	}
+	r.Tags = tags
+	return nil
+}
+
+// SetVideoTags godoc
+// @Summary Set the tags of a video
+// @Description Replace all tags of a video. Tags that do not exist yet are created.
+// @ID setVideoTags
+// @Tags videos
+// @Accept json
+// @Produce json
+// @Param id path string true "Video ID"
+// @Param request body SetVideoTagsRequest true "Tags"
+// @Success 200 {object} VideoResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/videos/{id}/tags [put]
+func (h *VideoHandler) SetVideoTags(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	var req SetVideoTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	video, err := h.Queries.GetVideo(r.Context(), id)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Video not found")
+		return
+	}
+
+	if err := h.Tags.SetVideoTags(r.Context(), id, req.Tags); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := mapVideoToResponse(video)
+	resp.Tags = req.Tags
+	utils.RespondWithJSON(w, http.StatusOK, resp)
 }
 
 // DeleteVideo godoc
 // @Summary Delete a video
-// @Description Delete a video record by ID and its associated files
+// @Description Move a video and its files to the trash. With permanent=true, or for a video already in the trash, the record and files are deleted for good.
 // @ID deleteVideo
 // @Tags videos
 // @Accept json
 // @Produce json
 // @Param id path string true "Video ID"
+// @Param permanent query bool false "Skip the trash"
 // @Success 204 "No Content"
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /api/videos/{id} [delete]
 func (h *VideoHandler) DeleteVideo(w http.ResponseWriter, r *http.Request) {
@@ -470,17 +1205,104 @@ func (h *VideoHandler) DeleteVideo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete from database first
-	err = h.Queries.DeleteVideo(r.Context(), id)
+	if r.URL.Query().Get("permanent") == "true" || video.DeletedAt.Valid {
+		// Delete from database first, then files from filesystem
+		if err := h.Downloader.DeleteVideo(r.Context(), video); err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if _, err := h.Trash.Trash(r.Context(), video); err != nil {
+		if errors.Is(err, services.ErrJobRunning) {
+			utils.RespondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListTrash godoc
+// @Summary List trashed videos
+// @Description Get the videos in the trash, most recently deleted first
+// @ID listTrash
+// @Tags videos
+// @Produce json
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Number of items per page (default: 10)"
+// @Success 200 {object} PaginatedVideoResponse
+// @Failure 500 {object} map[string]string
+// @Router /api/videos/trash [get]
+func (h *VideoHandler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	page := 1
+	limit := 10
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	videos, err := h.Queries.ListTrashedVideos(r.Context(), database.ListTrashedVideosParams{
+		Limit:  int32(limit),
+		Offset: int32((page - 1) * limit),
+	})
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	// Delete files from filesystem
-	h.Downloader.DeleteVideoFiles(video.FileName.String, video.ThumbnailFileName.String)
+	totalCount, err := h.Queries.CountTrashedVideos(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 
-	h.Ws.Broadcast(services.WsEventVideoDeleted, map[string]string{"id": idStr})
+	respondWithVideoPage(w, mapVideosWithTags(r.Context(), h.Tags, videos), totalCount, page, limit)
+}
 
-	w.WriteHeader(http.StatusNoContent)
+// RestoreVideo godoc
+// @Summary Restore a trashed video
+// @Description Move a video out of the trash. Its files return to their previous paths, with a " (n)" suffix if the path was taken since.
+// @ID restoreVideo
+// @Tags videos
+// @Produce json
+// @Param id path string true "Video ID"
+// @Success 200 {object} VideoResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/videos/{id}/restore [post]
+func (h *VideoHandler) RestoreVideo(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	video, err := h.Queries.GetVideo(r.Context(), id)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Video not found")
+		return
+	}
+
+	restored, err := h.Trash.Restore(r.Context(), video)
+	if err != nil {
+		if errors.Is(err, services.ErrNotTrashed) {
+			utils.RespondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := h.mapVideoWithTags(r.Context(), restored)
+	h.Ws.Broadcast(services.WsEventVideoRestored, resp)
+	utils.RespondWithJSON(w, http.StatusOK, resp)
 }
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/Azmekk/Vidra/backend/services"
+	"github.com/Azmekk/Vidra/backend/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// viewerHeader names the viewer. Auth proxies in front of Vidra (Authelia, authentik, oauth2-proxy) set it
+// to the signed-in user; without one every request shares the default viewer.
+const viewerHeader = "Remote-User"
+
+const maxViewerLength = 128
+
+func viewerFromRequest(r *http.Request) string {
+	viewer := strings.TrimSpace(r.Header.Get(viewerHeader))
+	if viewer == "" || len(viewer) > maxViewerLength {
+		return services.DefaultViewer
+	}
+	return viewer
+}
+
+// attachPlayback fills in the requesting viewer's watch state. Failures only leave it out.
+func (h *VideoHandler) attachPlayback(r *http.Request, responses []VideoResponse) {
+	ids := make([]pgtype.UUID, 0, len(responses))
+	for _, resp := range responses {
+		var id pgtype.UUID
+		if err := id.Scan(resp.ID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	progress, err := h.Watch.ProgressForVideos(r.Context(), viewerFromRequest(r), ids)
+	if err != nil {
+		slog.Warn("Failed to load watch progress", "error", err)
+		return
+	}
+	for i := range responses {
+		if p, ok := progress[responses[i].ID]; ok {
+			responses[i].Playback = &p
+		}
+	}
+}
+
+type UpdatePlaybackRequest struct {
+	Position float64 `json:"position"`          // seconds
+	Watched  *bool   `json:"watched,omitempty"` // set to mark the video watched or unwatched explicitly
+}
+
+func (r *UpdatePlaybackRequest) Validate() error {
+	if r.Position < 0 || math.IsNaN(r.Position) || math.IsInf(r.Position, 0) {
+		return fmt.Errorf("position must be a non-negative number of seconds")
+	}
+	return nil
+}
+
+// GetPlayback godoc
+// @Summary Get playback state
+// @Description Get the viewer's playback position and watched state for a video
+// @ID getPlayback
+// @Tags videos
+// @Produce json
+// @Param id path string true "Video ID"
+// @Param Remote-User header string false "Viewer (default: default)"
+// @Success 200 {object} services.WatchProgressDTO
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/videos/{id}/playback [get]
+func (h *VideoHandler) GetPlayback(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	if _, err := h.Queries.GetVideo(r.Context(), id); err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Video not found")
+		return
+	}
+
+	progress, err := h.Queries.GetWatchProgress(r.Context(), database.GetWatchProgressParams{
+		VideoID: id,
+		Viewer:  viewerFromRequest(r),
+	})
+	if err != nil {
+		// Never played
+		utils.RespondWithJSON(w, http.StatusOK, services.WatchProgressDTO{})
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, services.MapWatchProgress(progress))
+}
+
+// UpdatePlayback godoc
+// @Summary Save playback state
+// @Description Save the viewer's playback position. The video is marked watched once 90% of it has been played, unless watched is given explicitly.
+// @ID updatePlayback
+// @Tags videos
+// @Accept json
+// @Produce json
+// @Param id path string true "Video ID"
+// @Param Remote-User header string false "Viewer (default: default)"
+// @Param playback body UpdatePlaybackRequest true "Playback position"
+// @Success 200 {object} services.WatchProgressDTO
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/videos/{id}/playback [put]
+func (h *VideoHandler) UpdatePlayback(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	var req UpdatePlaybackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	video, err := h.Queries.GetVideo(r.Context(), id)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Video not found")
+		return
+	}
+
+	progress, err := h.Watch.Save(r.Context(), viewerFromRequest(r), video, req.Position, req.Watched)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, services.MapWatchProgress(progress))
+}
+
+// ResetPlayback godoc
+// @Summary Reset playback state
+// @Description Forget the viewer's playback position and mark the video unwatched
+// @ID resetPlayback
+// @Tags videos
+// @Param id path string true "Video ID"
+// @Param Remote-User header string false "Viewer (default: default)"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/videos/{id}/playback [delete]
+func (h *VideoHandler) ResetPlayback(w http.ResponseWriter, r *http.Request) {
+	var id pgtype.UUID
+	if err := id.Scan(chi.URLParam(r, "id")); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid video ID")
+		return
+	}
+
+	if err := h.Queries.DeleteWatchProgress(r.Context(), database.DeleteWatchProgressParams{
+		VideoID: id,
+		Viewer:  viewerFromRequest(r),
+	}); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListHistory godoc
+// @Summary List watch history
+// @Description Get the videos the viewer played, most recent first. state=in_progress gives the "continue watching" list.
+// @ID listHistory
+// @Tags videos
+// @Produce json
+// @Param Remote-User header string false "Viewer (default: default)"
+// @Param state query string false "Only in_progress or watched videos"
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Number of items per page (default: 10)"
+// @Success 200 {object} PaginatedVideoResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/videos/history [get]
+func (h *VideoHandler) ListHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page := 1
+	limit := 10
+	if p, err := strconv.Atoi(query.Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	var state pgtype.Text
+	switch v := query.Get("state"); v {
+	case "":
+	case "in_progress", "watched":
+		state = pgtype.Text{String: v, Valid: true}
+	default:
+		utils.RespondWithError(w, http.StatusBadRequest, "invalid state: must be in_progress or watched")
+		return
+	}
+	viewer := viewerFromRequest(r)
+
+	totalCount, err := h.Queries.CountWatchHistory(r.Context(), database.CountWatchHistoryParams{
+		Viewer: viewer,
+		State:  state,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rows, err := h.Queries.ListWatchHistory(r.Context(), database.ListWatchHistoryParams{
+		Viewer: viewer,
+		State:  state,
+		Limit:  int32(limit),
+		Offset: int32((page - 1) * limit),
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	videos := make([]database.Video, len(rows))
+	for i := range rows {
+		videos[i] = rows[i].Video
+	}
+	responses := mapVideosWithTags(r.Context(), h.Tags, videos)
+	for i, row := range rows {
+		progress := services.MapWatchProgress(row.WatchProgress)
+		responses[i].Playback = &progress
+	}
+
+	respondWithVideoPage(w, responses, totalCount, page, limit)
+}
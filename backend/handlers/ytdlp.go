@@ -1,7 +1,8 @@
 package handlers
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/Azmekk/Vidra/backend/gen/database"
@@ -10,29 +11,134 @@ import (
 )
 
 type YtDlpHandler struct {
-	Queries    *database.Queries
-	Downloader *services.DownloaderService
+	Queries  *database.Queries
+	Settings *services.SettingsService
+	Updates  *services.YtdlpUpdateService
 }
 
-func NewYtDlpHandler(queries *database.Queries, downloader *services.DownloaderService) *YtDlpHandler {
-	return &YtDlpHandler{Queries: queries, Downloader: downloader}
+func NewYtDlpHandler(queries *database.Queries, settings *services.SettingsService, updates *services.YtdlpUpdateService) *YtDlpHandler {
+	return &YtDlpHandler{Queries: queries, Settings: settings, Updates: updates}
+}
+
+type UpdateYtdlpVersionRequest struct {
+	Channel       string `json:"channel"`                 // stable, nightly or master
+	PinnedVersion string `json:"pinnedVersion,omitempty"` // e.g. 2025.01.15; empty follows the latest release of the channel
+}
+
+func (r *UpdateYtdlpVersionRequest) Validate() error {
+	return services.ValidateYtdlpVersionSettings(r.Channel, r.PinnedVersion)
+}
+
+// GetYtdlpVersion godoc
+// @Summary Get the yt-dlp version
+// @Description Get the installed yt-dlp version, the release channel and pinned version updates install, and the version a rollback restores
+// @ID getYtdlpVersion
+// @Tags ytdlp
+// @Produce json
+// @Success 200 {object} services.YtdlpVersionDTO
+// @Failure 500 {object} map[string]string
+// @Router /api/yt-dlp/version [get]
+func (h *YtDlpHandler) GetYtdlpVersion(w http.ResponseWriter, r *http.Request) {
+	version, err := h.Updates.Version(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, version)
+}
+
+// UpdateYtdlpVersion godoc
+// @Summary Choose the yt-dlp channel and version
+// @Description Set the release channel and optionally pin a version. This only affects what the next update installs.
+// @ID updateYtdlpVersion
+// @Tags ytdlp
+// @Accept json
+// @Produce json
+// @Param version body UpdateYtdlpVersionRequest true "Channel and pinned version"
+// @Success 200 {object} services.YtdlpVersionDTO
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/yt-dlp/version [put]
+func (h *YtDlpHandler) UpdateYtdlpVersion(w http.ResponseWriter, r *http.Request) {
+	var req UpdateYtdlpVersionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := h.Settings.UpdateYtdlpVersionSettings(r.Context(), services.SettingsDTO{
+		YtdlpChannel: req.Channel,
+		YtdlpVersion: req.PinnedVersion,
+	}); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.GetYtdlpVersion(w, r)
 }
 
 // UpdateYtdlp godoc
 // @Summary Update yt-dlp
-// @Description Execute yt-dlp -U to update the binary
+// @Description Install the pinned version, or the latest release of the channel, in the background. Output is streamed as ytdlp_update WebSocket events. If the new binary fails a --version smoke test the previous one is restored.
 // @ID updateYtdlp
 // @Tags ytdlp
 // @Produce json
-// @Success 200 {object} map[string]string
+// @Success 202 {object} services.YtdlpUpdateStatusDTO
+// @Failure 409 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /api/yt-dlp/update [post]
 func (h *YtDlpHandler) UpdateYtdlp(w http.ResponseWriter, r *http.Request) {
-	output, err := h.Downloader.UpdateYtdlp(r.Context())
+	status, err := h.Updates.Start(r.Context())
+	if errors.Is(err, services.ErrYtdlpUpdateRunning) {
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusAccepted, status)
+}
+
+// GetYtdlpUpdateStatus godoc
+// @Summary Get yt-dlp update status
+// @Description Get the output and result of the current or last yt-dlp update or rollback
+// @ID getYtdlpUpdateStatus
+// @Tags ytdlp
+// @Produce json
+// @Success 200 {object} services.YtdlpUpdateStatusDTO
+// @Router /api/yt-dlp/update [get]
+func (h *YtDlpHandler) GetYtdlpUpdateStatus(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, http.StatusOK, h.Updates.GetStatus())
+}
+
+// RollbackYtdlp godoc
+// @Summary Roll back yt-dlp
+// @Description Restore the yt-dlp version that was installed before the last update, in the background. Rolling back twice returns to the newer version.
+// @ID rollbackYtdlp
+// @Tags ytdlp
+// @Produce json
+// @Success 202 {object} services.YtdlpUpdateStatusDTO
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/yt-dlp/rollback [post]
+func (h *YtDlpHandler) RollbackYtdlp(w http.ResponseWriter, r *http.Request) {
+	status, err := h.Updates.Rollback(r.Context())
+	if errors.Is(err, services.ErrYtdlpUpdateRunning) || errors.Is(err, services.ErrNoPreviousYtdlp) {
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Update failed: %v\nOutput: %s", err, output))
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"output": output})
+	utils.RespondWithJSON(w, http.StatusAccepted, status)
 }
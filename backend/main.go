@@ -10,7 +10,7 @@ package main
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -19,6 +19,7 @@ import (
 	"github.com/Azmekk/Vidra/backend/handlers"
 	"github.com/Azmekk/Vidra/backend/routers"
 	"github.com/Azmekk/Vidra/backend/services"
+	"github.com/Azmekk/Vidra/backend/utils"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
@@ -35,24 +36,69 @@ func main() {
 	wsService := services.NewWebSocketService()
 	go wsService.Run()
 
+	storage, err := services.NewStorageFromEnv(ctx)
+	if err != nil {
+		slog.Error("❌ Failed to initialize storage", "error", err)
+		os.Exit(1)
+	}
+
+	metrics := services.NewMetricsService(pool, wsService)
 	settingsService := services.NewSettingsService(queries)
-	ytdlpService := services.NewYtdlpService(settingsService)
-	downloader := services.NewDownloaderService(queries, wsService, ytdlpService)
-	videoHandler := handlers.NewVideoHandler(queries, downloader, wsService)
+	proxyService := services.NewProxyService(pool, queries, settingsService)
+	credentialService := services.NewCredentialService(queries)
+	ytdlpService := services.NewYtdlpService(settingsService, proxyService, credentialService)
+	quotaService := services.NewQuotaService(settingsService, wsService, storage)
+	go quotaService.Run()
+	layout := services.NewLibraryLayout(queries, settingsService, storage)
+	downloader := services.NewDownloaderService(queries, wsService, ytdlpService, metrics, quotaService, storage, layout, proxyService)
+	metrics.RegisterJobs(downloader)
+	metrics.RegisterLibrarySize(quotaService)
+	tagService := services.NewTagService(queries)
+	trashService := services.NewTrashService(queries, settingsService, downloader)
+	go trashService.Run()
+	bulkService := services.NewBulkService(pool, queries, downloader, tagService, trashService, wsService)
+	watchService := services.NewWatchService(queries)
+	previewService := services.NewPreviewService(queries, downloader)
+	scheduleService := services.NewScheduleService(queries, settingsService, downloader)
+	go scheduleService.Run()
+	videoHandler := handlers.NewVideoHandler(queries, downloader, wsService, quotaService, storage, tagService, bulkService, trashService, watchService, previewService, scheduleService)
 	errorHandler := handlers.NewErrorHandler(queries)
-	ytdlpHandler := handlers.NewYtDlpHandler(queries, downloader)
-	systemHandler := handlers.NewSystemHandler()
-	settingsHandler := handlers.NewSettingsHandler(settingsService)
+	ytdlpUpdateService := services.NewYtdlpUpdateService(queries, ytdlpService, settingsService, downloader, wsService, metrics)
+	go ytdlpUpdateService.Run()
+	ytdlpHandler := handlers.NewYtDlpHandler(queries, settingsService, ytdlpUpdateService)
+	healthService := services.NewHealthService(pool, wsService)
+	importService := services.NewImportService(queries, quotaService, metrics, storage, layout, videoHandler.BroadcastCreated)
+	go importService.Run()
+	reconcileService := services.NewReconcileService(queries, downloader, importService, storage)
+	mediaInfoService := services.NewMediaInfoService(queries, metrics, storage)
+	systemHandler := handlers.NewSystemHandler(queries, healthService, quotaService, reconcileService, layout, previewService, mediaInfoService)
+	healthHandler := handlers.NewHealthHandler(healthService)
+	settingsHandler := handlers.NewSettingsHandler(settingsService, scheduleService)
+	retentionService := services.NewRetentionService(queries, downloader, tagService, trashService)
+	go retentionService.Run()
+	retentionHandler := handlers.NewRetentionHandler(queries, retentionService)
+	importHandler := handlers.NewImportHandler(importService)
+	tagHandler := handlers.NewTagHandler(queries, tagService)
+	collectionHandler := handlers.NewCollectionHandler(queries, tagService)
+	proxyHandler := handlers.NewProxyHandler(queries, proxyService)
+	credentialHandler := handlers.NewCredentialHandler(queries, credentialService)
 
 	r := chi.NewRouter()
 
 	// Middleware
-	//r.Use(middleware.Logger)
+	r.Use(utils.RequestLogger)
 	r.Use(middleware.Recoverer)
 
 	// WebSocket endpoint
 	r.Get("/api/ws", wsService.HandleConnections)
 
+	// Health probes
+	r.Get("/healthz", healthHandler.Liveness)
+	r.Get("/readyz", healthHandler.Readiness)
+
+	// Prometheus metrics
+	r.Handle("/metrics", metrics.Handler())
+
 	// Swagger documentation
 	r.Get("/swagger/*", httpSwagger.WrapHandler)
 
@@ -62,21 +108,28 @@ func main() {
 	r.Mount("/api/yt-dlp", routers.YtDlpRouter(ytdlpHandler))
 	r.Mount("/api/system", routers.SystemRouter(systemHandler))
 	r.Mount("/api/settings", routers.SettingsRouter(settingsHandler))
+	r.Mount("/api/retention", routers.RetentionRouter(retentionHandler))
+	r.Mount("/api/import", routers.ImportRouter(importHandler))
+	r.Mount("/api/tags", routers.TagRouter(tagHandler))
+	r.Mount("/api/collections", routers.CollectionRouter(collectionHandler))
+	r.Mount("/api/proxies", routers.ProxyRouter(proxyHandler))
+	r.Mount("/api/credentials", routers.CredentialRouter(credentialHandler))
 
 	// Serve downloads folder locally if VIDRA_DEV_ENVIRONMENT=true
 	if os.Getenv("VIDRA_DEV_ENVIRONMENT") == "true" {
 		workDir, _ := os.Getwd()
 		filesDir := http.Dir(filepath.Join(workDir, "downloads"))
 		r.Handle("/downloads/*", http.StripPrefix("/downloads/", http.FileServer(filesDir)))
-		log.Println("📂 Serving /downloads locally (DEV mode)")
+		slog.Info("📂 Serving /downloads locally (DEV mode)")
 	}
 
 	// Start server
 	addr := ":" + port
-	log.Printf("🌐 Server is running on http://localhost%s\n", addr)
-	log.Println("✨ Ready to handle requests!")
+	slog.Info("🌐 Server is running", "url", "http://localhost"+addr)
+	slog.Info("✨ Ready to handle requests!")
 
 	if err := http.ListenAndServe(addr, r); err != nil {
-		log.Fatalf("❌ Server failed to start: %v", err)
+		slog.Error("❌ Server failed to start", "error", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,19 @@
+package routers
+
+import (
+	"github.com/Azmekk/Vidra/backend/handlers"
+	"github.com/go-chi/chi/v5"
+)
+
+func CollectionRouter(h *handlers.CollectionHandler) chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", h.ListCollections)
+	r.Post("/", h.CreateCollection)
+	r.Get("/{id}", h.GetCollection)
+	r.Put("/{id}", h.UpdateCollection)
+	r.Delete("/{id}", h.DeleteCollection)
+	r.Post("/{id}/videos", h.AddCollectionVideo)
+	r.Delete("/{id}/videos/{videoId}", h.RemoveCollectionVideo)
+	r.Put("/{id}/order", h.ReorderCollection)
+	return r
+}
@@ -0,0 +1,15 @@
+package routers
+
+import (
+	"github.com/Azmekk/Vidra/backend/handlers"
+	"github.com/go-chi/chi/v5"
+)
+
+func CredentialRouter(h *handlers.CredentialHandler) chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", h.ListSiteCredentials)
+	r.Post("/", h.CreateSiteCredential)
+	r.Put("/{id}", h.UpdateSiteCredential)
+	r.Delete("/{id}", h.DeleteSiteCredential)
+	return r
+}
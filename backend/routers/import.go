@@ -0,0 +1,13 @@
+package routers
+
+import (
+	"github.com/Azmekk/Vidra/backend/handlers"
+	"github.com/go-chi/chi/v5"
+)
+
+func ImportRouter(h *handlers.ImportHandler) chi.Router {
+	r := chi.NewRouter()
+	r.Post("/", h.StartImport)
+	r.Get("/status", h.GetImportStatus)
+	return r
+}
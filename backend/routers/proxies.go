@@ -0,0 +1,20 @@
+package routers
+
+import (
+	"github.com/Azmekk/Vidra/backend/handlers"
+	"github.com/go-chi/chi/v5"
+)
+
+func ProxyRouter(h *handlers.ProxyHandler) chi.Router {
+	r := chi.NewRouter()
+	r.Get("/pools", h.ListProxyPools)
+	r.Post("/pools", h.CreateProxyPool)
+	r.Put("/pools/{id}", h.UpdateProxyPool)
+	r.Delete("/pools/{id}", h.DeleteProxyPool)
+	r.Get("/rules", h.ListProxyRules)
+	r.Post("/rules", h.CreateProxyRule)
+	r.Put("/rules/{id}", h.UpdateProxyRule)
+	r.Delete("/rules/{id}", h.DeleteProxyRule)
+	r.Post("/check", h.CheckProxies)
+	return r
+}
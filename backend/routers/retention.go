@@ -0,0 +1,17 @@
+package routers
+
+import (
+	"github.com/Azmekk/Vidra/backend/handlers"
+	"github.com/go-chi/chi/v5"
+)
+
+func RetentionRouter(h *handlers.RetentionHandler) chi.Router {
+	r := chi.NewRouter()
+	r.Get("/rules", h.ListRetentionRules)
+	r.Post("/rules", h.CreateRetentionRule)
+	r.Put("/rules/{id}", h.UpdateRetentionRule)
+	r.Delete("/rules/{id}", h.DeleteRetentionRule)
+	r.Get("/preview", h.PreviewRetention)
+	r.Post("/run", h.RunRetention)
+	return r
+}
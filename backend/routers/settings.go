@@ -9,5 +9,21 @@ func SettingsRouter(h *handlers.SettingsHandler) chi.Router {
 	r := chi.NewRouter()
 	r.Get("/", h.GetSettings)
 	r.Put("/", h.UpdateSettings)
+	r.Get("/storage", h.GetStorageSettings)
+	r.Put("/storage", h.UpdateStorageSettings)
+	r.Get("/library", h.GetLibrarySettings)
+	r.Put("/library", h.UpdateLibrarySettings)
+	r.Get("/trash", h.GetTrashSettings)
+	r.Put("/trash", h.UpdateTrashSettings)
+	r.Get("/sponsorblock", h.GetSponsorBlockSettings)
+	r.Put("/sponsorblock", h.UpdateSponsorBlockSettings)
+	r.Get("/yt-dlp-options", h.GetYtdlpOptionsSettings)
+	r.Put("/yt-dlp-options", h.UpdateYtdlpOptionsSettings)
+	r.Get("/downloads", h.GetDownloadSettings)
+	r.Put("/downloads", h.UpdateDownloadSettings)
+	r.Get("/yt-dlp-updates", h.GetYtdlpUpdateSettings)
+	r.Put("/yt-dlp-updates", h.UpdateYtdlpUpdateSettings)
+	r.Get("/format-policy", h.GetFormatPolicySettings)
+	r.Put("/format-policy", h.UpdateFormatPolicySettings)
 	return r
 }
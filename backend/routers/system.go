@@ -8,5 +8,14 @@ import (
 func SystemRouter(h *handlers.SystemHandler) chi.Router {
 	r := chi.NewRouter()
 	r.Get("/info", h.GetSystemInfo)
+	r.Get("/disk", h.GetDiskUsage)
+	r.Post("/reconcile", h.ReconcileLibrary)
+	r.Post("/reorganize", h.ReorganizeLibrary)
+	r.Get("/reorganize", h.GetReorganizeStatus)
+	r.Post("/previews", h.GeneratePreviews)
+	r.Get("/previews", h.GetPreviewStatus)
+	r.Post("/media-info", h.BackfillMediaInfo)
+	r.Get("/media-info", h.GetMediaInfoStatus)
+	r.Get("/maintenance-runs", h.ListMaintenanceRuns)
 	return r
 }
@@ -0,0 +1,16 @@
+package routers
+
+import (
+	"github.com/Azmekk/Vidra/backend/handlers"
+	"github.com/go-chi/chi/v5"
+)
+
+func TagRouter(h *handlers.TagHandler) chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", h.ListTags)
+	r.Post("/", h.CreateTag)
+	r.Post("/bulk", h.BulkUpdateTags)
+	r.Put("/{id}", h.RenameTag)
+	r.Delete("/{id}", h.DeleteTag)
+	return r
+}
@@ -11,9 +11,27 @@ func VideoRouter(h *handlers.VideoHandler) chi.Router {
 	r.Get("/", h.ListVideos)
 	r.Post("/metadata", h.GetMetadata)
 	r.Get("/progress", h.ListAllProgress)
+	r.Post("/bulk", h.BulkVideos)
+	r.Get("/bulk/{jobId}", h.GetBulkJob)
+	r.Get("/trash", h.ListTrash)
+	r.Get("/history", h.ListHistory)
 	r.Get("/{id}", h.GetVideo)
 	r.Put("/{id}", h.UpdateVideo)
 	r.Get("/{id}/progress", h.GetProgress)
+	r.Get("/{id}/playback", h.GetPlayback)
+	r.Put("/{id}/playback", h.UpdatePlayback)
+	r.Delete("/{id}/playback", h.ResetPlayback)
+	r.Get("/{id}/logs", h.GetLogs)
+	r.Get("/{id}/file", h.GetVideoFile)
+	r.Get("/{id}/thumbnail", h.GetVideoThumbnail)
+	r.Get("/{id}/sprite", h.GetVideoSprite)
+	r.Get("/{id}/thumbnails.vtt", h.GetThumbnailTrack)
+	r.Post("/{id}/previews", h.RegeneratePreviews)
+	r.Post("/{id}/resume", h.ResumeVideo)
+	r.Post("/{id}/start", h.StartVideo)
+	r.Post("/{id}/restore", h.RestoreVideo)
+	r.Put("/{id}/pin", h.PinVideo)
+	r.Put("/{id}/tags", h.SetVideoTags)
 	r.Delete("/{id}", h.DeleteVideo)
 	return r
 }
@@ -8,7 +8,11 @@ import (
 func YtDlpRouter(h *handlers.YtDlpHandler) chi.Router {
 	r := chi.NewRouter()
 
+	r.Get("/version", h.GetYtdlpVersion)
+	r.Put("/version", h.UpdateYtdlpVersion)
 	r.Post("/update", h.UpdateYtdlp)
+	r.Get("/update", h.GetYtdlpUpdateStatus)
+	r.Post("/rollback", h.RollbackYtdlp)
 
 	return r
 }
@@ -2,7 +2,8 @@ package services
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
 	"os"
 
 	"github.com/jackc/pgx/v5"
@@ -16,8 +17,10 @@ import (
 )
 
 func Bootstrap(ctx context.Context) (*pgxpool.Pool, string) {
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using system environment variables")
+	envErr := godotenv.Load()
+	SetupLogging()
+	if envErr != nil {
+		slog.Info("No .env file found, using system environment variables")
 	}
 
 	dbUrl := os.Getenv("DATABASE_URL")
@@ -28,7 +31,7 @@ func Bootstrap(ctx context.Context) (*pgxpool.Pool, string) {
 	// Parse the URL to get the database name and a connection string to the 'postgres' database
 	config, err := pgx.ParseConfig(dbUrl)
 	if err != nil {
-		log.Fatalf("Unable to parse DATABASE_URL: %v", err)
+		fatal("Unable to parse DATABASE_URL", err)
 	}
 	targetDB := config.Database
 	config.Database = "postgres"
@@ -37,28 +40,28 @@ func Bootstrap(ctx context.Context) (*pgxpool.Pool, string) {
 	// Connect to 'postgres' database to ensure the target database exists
 	pgConn, err := pgx.Connect(ctx, postgresURL)
 	if err != nil {
-		log.Fatalf("Unable to connect to postgres database: %v", err)
+		fatal("Unable to connect to postgres database", err)
 	}
 
 	var exists bool
 	err = pgConn.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM pg_database WHERE datname = $1)", targetDB).Scan(&exists)
 	if err != nil {
-		log.Fatalf("Error checking if database exists: %v", err)
+		fatal("Error checking if database exists", err)
 	}
 
 	if !exists {
-		log.Printf("Database %s does not exist, creating it...\n", targetDB)
+		slog.Info("Database does not exist, creating it", "database", targetDB)
 		_, err = pgConn.Exec(ctx, "CREATE DATABASE "+targetDB)
 		if err != nil {
-			log.Fatalf("Error creating database: %v", err)
+			fatal("Error creating database", err)
 		}
-		log.Printf("Database %s created successfully.\n", targetDB)
+		slog.Info("Database created successfully", "database", targetDB)
 	}
 	pgConn.Close(ctx)
 
 	// Ensure downloads directory exists
 	if err := os.MkdirAll("downloads", 0755); err != nil {
-		log.Fatalf("Error creating downloads directory: %v", err)
+		fatal("Error creating downloads directory", err)
 	}
 
 	// Run migrations
@@ -67,7 +70,7 @@ func Bootstrap(ctx context.Context) (*pgxpool.Pool, string) {
 	// Now connect to the target database with pgxpool
 	pool, err := pgxpool.New(ctx, dbUrl)
 	if err != nil {
-		log.Fatalf("Unable to connect to database pool: %v", err)
+		fatal("Unable to connect to database pool", err)
 	}
 
 	port := os.Getenv("PORT")
@@ -84,12 +87,18 @@ func runMigrations(dbUrl string) {
 		dbUrl,
 	)
 	if err != nil {
-		log.Fatalf("could not create migrate instance: %v", err)
+		fatal("Could not create migrate instance", err)
 	}
 
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		log.Fatalf("could not run up migrations: %v", err)
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		fatal("Could not run up migrations", err)
 	}
 
-	log.Println("Migrations applied successfully!")
+	slog.Info("Migrations applied successfully")
+}
+
+// fatal logs an unrecoverable startup error and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type BulkAction string
+
+const (
+	BulkActionDelete           BulkAction = "delete"
+	BulkActionRetry            BulkAction = "retry"
+	BulkActionReencode         BulkAction = "reencode"
+	BulkActionTag              BulkAction = "tag"
+	BulkActionMoveToCollection BulkAction = "move_to_collection"
+	BulkActionRename           BulkAction = "rename"
+)
+
+const (
+	BulkResultOK      = "ok"
+	BulkResultFailed  = "failed"
+	BulkResultSkipped = "skipped"
+
+	// bulkJobRetention is how long finished jobs stay available to GET /api/videos/bulk/{id}
+	bulkJobRetention = time.Hour
+)
+
+// BulkRequest is a validated bulk operation. Only the fields of the chosen action are used.
+type BulkRequest struct {
+	Action           BulkAction
+	VideoIDs         []pgtype.UUID
+	AddTags          []string
+	RemoveTags       []string
+	CollectionID     pgtype.UUID
+	FromCollectionID pgtype.UUID // optional for move_to_collection
+	NameTemplate     string
+	EncodingOptions  *EncodingOptions
+	Permanent        bool // delete skips the trash
+}
+
+type BulkItemResultDTO struct {
+	VideoID string `json:"videoId"`
+	Status  string `json:"status"` // ok, failed or skipped
+	Message string `json:"message,omitempty"`
+}
+
+type BulkJobDTO struct {
+	ID         string              `json:"id"`
+	Action     BulkAction          `json:"action"`
+	Running    bool                `json:"running"`
+	Total      int                 `json:"total"`
+	Processed  int                 `json:"processed"`
+	Succeeded  int                 `json:"succeeded"`
+	Failed     int                 `json:"failed"`
+	StartedAt  string              `json:"startedAt"`
+	FinishedAt string              `json:"finishedAt,omitempty"`
+	Results    []BulkItemResultDTO `json:"results"`
+}
+
+// BulkProgressDTO is broadcast over the WebSocket after every processed item
+type BulkProgressDTO struct {
+	JobID     string            `json:"jobId"`
+	Action    BulkAction        `json:"action"`
+	Running   bool              `json:"running"`
+	Total     int               `json:"total"`
+	Processed int               `json:"processed"`
+	Result    BulkItemResultDTO `json:"result"`
+}
+
+type bulkJob struct {
+	status   BulkJobDTO
+	done     chan struct{}
+	finished time.Time
+}
+
+type BulkService struct {
+	pool       *pgxpool.Pool
+	queries    *database.Queries
+	downloader *DownloaderService
+	tags       *TagService
+	trash      *TrashService
+	ws         *WebSocketService
+
+	mu   sync.Mutex
+	jobs map[string]*bulkJob
+}
+
+func NewBulkService(pool *pgxpool.Pool, queries *database.Queries, downloader *DownloaderService, tags *TagService, trash *TrashService, ws *WebSocketService) *BulkService {
+	return &BulkService{
+		pool:       pool,
+		queries:    queries,
+		downloader: downloader,
+		tags:       tags,
+		trash:      trash,
+		ws:         ws,
+		jobs:       make(map[string]*bulkJob),
+	}
+}
+
+// Start runs a bulk operation in the background and returns the job and a channel that is closed when it finishes
+func (s *BulkService) Start(req BulkRequest) (BulkJobDTO, <-chan struct{}) {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	job := &bulkJob{
+		status: BulkJobDTO{
+			ID:        hex.EncodeToString(id),
+			Action:    req.Action,
+			Running:   true,
+			Total:     len(req.VideoIDs),
+			StartedAt: time.Now().Format("2006-01-02T15:04:05Z07:00"),
+			Results:   []BulkItemResultDTO{},
+		},
+		done: make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	for jobID, j := range s.jobs {
+		if !j.finished.IsZero() && time.Since(j.finished) > bulkJobRetention {
+			delete(s.jobs, jobID)
+		}
+	}
+	s.jobs[job.status.ID] = job
+	status := job.status
+	s.mu.Unlock()
+
+	go s.run(job, req)
+	return status, job.done
+}
+
+// GetJob returns the state of a running or recently finished job
+func (s *BulkService) GetJob(id string) (BulkJobDTO, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return BulkJobDTO{}, false
+	}
+	status := job.status
+	status.Results = append([]BulkItemResultDTO{}, job.status.Results...)
+	return status, true
+}
+
+func (s *BulkService) run(job *bulkJob, req BulkRequest) {
+	ctx := context.Background()
+	logger := slog.With("bulk_job", job.status.ID, "action", req.Action)
+	logger.Info("Starting bulk operation", "videos", len(req.VideoIDs))
+
+	defer func() {
+		s.mu.Lock()
+		job.status.Running = false
+		job.status.FinishedAt = time.Now().Format("2006-01-02T15:04:05Z07:00")
+		job.finished = time.Now()
+		s.mu.Unlock()
+		close(job.done)
+		logger.Info("Bulk operation finished", "succeeded", job.status.Succeeded, "failed", job.status.Failed)
+	}()
+
+	switch req.Action {
+	case BulkActionDelete:
+		if req.Permanent {
+			s.runDelete(ctx, job, req.VideoIDs)
+		} else {
+			s.runPerVideo(ctx, job, req)
+		}
+	case BulkActionTag:
+		// A single pair of statements covers all videos
+		status, message := BulkResultOK, ""
+		if err := s.tags.BulkUpdate(ctx, req.VideoIDs, req.AddTags, req.RemoveTags); err != nil {
+			status, message = BulkResultFailed, err.Error()
+		}
+		for _, id := range req.VideoIDs {
+			s.record(job, BulkItemResultDTO{VideoID: id.String(), Status: status, Message: message})
+		}
+	default:
+		s.runPerVideo(ctx, job, req)
+	}
+}
+
+// runPerVideo loads the videos and applies the action to each one in turn
+func (s *BulkService) runPerVideo(ctx context.Context, job *bulkJob, req BulkRequest) {
+	videos, err := s.queries.GetVideosByIDs(ctx, req.VideoIDs)
+	if err != nil {
+		for _, id := range req.VideoIDs {
+			s.record(job, BulkItemResultDTO{VideoID: id.String(), Status: BulkResultFailed, Message: err.Error()})
+		}
+		return
+	}
+	byID := make(map[string]database.Video, len(videos))
+	for _, v := range videos {
+		byID[v.ID.String()] = v
+	}
+
+	for _, id := range req.VideoIDs {
+		video, ok := byID[id.String()]
+		if !ok {
+			s.record(job, BulkItemResultDTO{VideoID: id.String(), Status: BulkResultFailed, Message: "video not found"})
+			continue
+		}
+		s.record(job, s.apply(ctx, req, video))
+	}
+}
+
+// apply runs a per-video action
+func (s *BulkService) apply(ctx context.Context, req BulkRequest, video database.Video) BulkItemResultDTO {
+	result := BulkItemResultDTO{VideoID: video.ID.String(), Status: BulkResultOK}
+	var err error
+
+	switch req.Action {
+	case BulkActionDelete:
+		_, err = s.trash.Trash(ctx, video)
+		if errors.Is(err, ErrAlreadyTrashed) || errors.Is(err, ErrJobRunning) {
+			result.Status, result.Message = BulkResultSkipped, err.Error()
+			return result
+		}
+	case BulkActionRetry:
+		err = s.downloader.Retry(ctx, video)
+		if errors.Is(err, ErrNotRetryable) || errors.Is(err, ErrJobRunning) {
+			result.Status, result.Message = BulkResultSkipped, err.Error()
+			return result
+		}
+	case BulkActionReencode:
+		err = s.downloader.Reencode(ctx, video, req.EncodingOptions)
+		if errors.Is(err, ErrNotReencodable) || errors.Is(err, ErrJobRunning) {
+			result.Status, result.Message = BulkResultSkipped, err.Error()
+			return result
+		}
+	case BulkActionMoveToCollection:
+		if req.FromCollectionID.Valid {
+			err = s.queries.RemoveCollectionVideo(ctx, database.RemoveCollectionVideoParams{
+				CollectionID: req.FromCollectionID,
+				VideoID:      video.ID,
+			})
+		}
+		if err == nil {
+			err = s.queries.AddCollectionVideo(ctx, database.AddCollectionVideoParams{
+				CollectionID: req.CollectionID,
+				VideoID:      video.ID,
+			})
+		}
+	case BulkActionRename:
+		name := RenderNameTemplate(req.NameTemplate, LayoutMetadataFromVideo(video))
+		_, err = s.queries.UpdateVideoName(ctx, database.UpdateVideoNameParams{ID: video.ID, Name: name})
+		result.Message = name
+	default:
+		err = fmt.Errorf("unknown action %s", req.Action)
+	}
+
+	if err != nil {
+		result.Status, result.Message = BulkResultFailed, err.Error()
+	}
+	return result
+}
+
+// runDelete permanently removes all rows in one transaction, so either every video is deleted or none is. Files are
+// removed afterwards; videos with an active job are skipped.
+func (s *BulkService) runDelete(ctx context.Context, job *bulkJob, ids []pgtype.UUID) {
+	var deletable []pgtype.UUID
+	for _, id := range ids {
+		if s.downloader.IsRunning(id.String()) {
+			s.record(job, BulkItemResultDTO{VideoID: id.String(), Status: BulkResultSkipped, Message: ErrJobRunning.Error()})
+			continue
+		}
+		deletable = append(deletable, id)
+	}
+	if len(deletable) == 0 {
+		return
+	}
+
+	failAll := func(err error) {
+		for _, id := range deletable {
+			s.record(job, BulkItemResultDTO{VideoID: id.String(), Status: BulkResultFailed, Message: err.Error()})
+		}
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		failAll(err)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	deleted, err := s.queries.WithTx(tx).DeleteVideos(ctx, deletable)
+	if err != nil {
+		failAll(err)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		failAll(err)
+		return
+	}
+
+	deletedByID := make(map[string]database.Video, len(deleted))
+	for _, v := range deleted {
+		deletedByID[v.ID.String()] = v
+	}
+	for _, id := range deletable {
+		idStr := id.String()
+		video, ok := deletedByID[idStr]
+		if !ok {
+			s.record(job, BulkItemResultDTO{VideoID: idStr, Status: BulkResultFailed, Message: "video not found"})
+			continue
+		}
+		s.downloader.DeleteVideoFiles(ctx, video.FileName.String, video.ThumbnailFileName.String, video.SpriteFileName.String)
+		s.ws.Broadcast(WsEventVideoDeleted, map[string]interface{}{"id": idStr, "permanent": true})
+		s.record(job, BulkItemResultDTO{VideoID: idStr, Status: BulkResultOK})
+	}
+	s.downloader.quota.InvalidateLibrarySize()
+}
+
+// record stores an item result and broadcasts the job's progress
+func (s *BulkService) record(job *bulkJob, result BulkItemResultDTO) {
+	s.mu.Lock()
+	job.status.Results = append(job.status.Results, result)
+	job.status.Processed++
+	switch result.Status {
+	case BulkResultOK:
+		job.status.Succeeded++
+	case BulkResultFailed:
+		job.status.Failed++
+	}
+	progress := BulkProgressDTO{
+		JobID:     job.status.ID,
+		Action:    job.status.Action,
+		Running:   job.status.Processed < job.status.Total,
+		Total:     job.status.Total,
+		Processed: job.status.Processed,
+		Result:    result,
+	}
+	s.mu.Unlock()
+
+	s.ws.Broadcast(WsEventBulkProgress, progress)
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// SponsorBlockMark adds the segments as chapters; SponsorBlockRemove cuts them out of the file
+	SponsorBlockMark   = "mark"
+	SponsorBlockRemove = "remove"
+
+	// sponsorBlockTitlePrefix starts the title of every chapter yt-dlp creates for a SponsorBlock segment
+	sponsorBlockTitlePrefix = "[SponsorBlock]: "
+)
+
+// SponsorBlockCategories are the segment categories yt-dlp accepts, see https://wiki.sponsor.ajay.app/w/Segment_Categories
+var SponsorBlockCategories = map[string]bool{
+	"sponsor": true, "intro": true, "outro": true, "selfpromo": true, "preview": true,
+	"filler": true, "interaction": true, "music_offtopic": true, "poi_highlight": true, "chapter": true,
+}
+
+// defaultSponsorBlockCategories are used when a download does not list any. Marking is harmless, so it
+// covers every category; removing only cuts sponsor segments.
+var defaultSponsorBlockCategories = map[string][]string{
+	SponsorBlockMark:   {"all"},
+	SponsorBlockRemove: {"sponsor"},
+}
+
+// SponsorBlockOptions is the per-download SponsorBlock handling
+type SponsorBlockOptions struct {
+	Mode       string   `json:"mode"`                 // mark or remove
+	Categories []string `json:"categories,omitempty"` // default: all when marking, sponsor when removing
+}
+
+// ValidateSponsorBlock checks the mode and categories of SponsorBlock options
+func ValidateSponsorBlock(opts *SponsorBlockOptions) error {
+	if opts.Mode != SponsorBlockMark && opts.Mode != SponsorBlockRemove {
+		return fmt.Errorf("invalid sponsorBlock mode: must be mark or remove")
+	}
+	for _, category := range opts.Categories {
+		if !SponsorBlockCategories[category] && category != "all" {
+			return fmt.Errorf("unknown sponsorBlock category: %s", category)
+		}
+	}
+	return nil
+}
+
+// categoryList returns the categories as yt-dlp expects them, comma separated
+func (o *SponsorBlockOptions) categoryList() string {
+	if len(o.Categories) == 0 {
+		return strings.Join(defaultSponsorBlockCategories[o.Mode], ",")
+	}
+	return strings.Join(o.Categories, ",")
+}
+
+// Chapter is a chapter of a stored video. SponsorBlock marks SponsorBlock segments added by yt-dlp.
+type Chapter struct {
+	Start        float64 `json:"start"` // seconds
+	End          float64 `json:"end"`   // seconds
+	Title        string  `json:"title"`
+	SponsorBlock bool    `json:"sponsorBlock,omitempty"`
+}
+
+func newChapter(start, end float64, title string) Chapter {
+	chapter := Chapter{Start: start, End: end, Title: title}
+	if rest, ok := strings.CutPrefix(title, sponsorBlockTitlePrefix); ok {
+		chapter.Title = rest
+		chapter.SponsorBlock = true
+	}
+	return chapter
+}
+
+// ParseChapters reads the chapters stored on a video row
+func ParseChapters(raw []byte) []Chapter {
+	if len(raw) == 0 {
+		return nil
+	}
+	var chapters []Chapter
+	if err := json.Unmarshal(raw, &chapters); err != nil {
+		return nil
+	}
+	return chapters
+}
+
+// chaptersFromInfo returns the chapters listed in a yt-dlp .info.json file
+func chaptersFromInfo(info *YtdlpInfo) []Chapter {
+	chapters := make([]Chapter, 0, len(info.Chapters))
+	for _, c := range info.Chapters {
+		chapters = append(chapters, newChapter(c.StartTime, c.EndTime, c.Title))
+	}
+	return chapters
+}
+
+func storeChapters(ctx context.Context, queries *database.Queries, id pgtype.UUID, chapters []Chapter) error {
+	raw, err := json.Marshal(chapters)
+	if err != nil {
+		return err
+	}
+	return queries.UpdateVideoChapters(ctx, database.UpdateVideoChaptersParams{ID: id, Chapters: raw})
+}
@@ -0,0 +1,298 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// secretKeyEnv names the variable the credential encryption key is derived from. Changing it makes the
+// stored credentials unreadable.
+const secretKeyEnv = "VIDRA_SECRET_KEY"
+
+// netscapeCookieHeader is the first line of a Netscape cookie file, which yt-dlp expects
+const netscapeCookieHeader = "# Netscape HTTP Cookie File"
+
+var (
+	ErrSecretKeyMissing = errors.New(secretKeyEnv + " is not set, so site credentials cannot be stored")
+	ErrSecretUnreadable = errors.New("stored credentials cannot be decrypted, was " + secretKeyEnv + " changed?")
+)
+
+// SiteLogin is a username and password passed to yt-dlp
+type SiteLogin struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// CredentialInput is a site credential being created or updated. Nil fields keep their stored value;
+// an empty cookie file or username removes it.
+type CredentialInput struct {
+	Domain  string
+	Cookies *string
+	Login   *SiteLogin
+}
+
+type SiteCredentialDTO struct {
+	ID         string `json:"id"`
+	Domain     string `json:"domain"`
+	HasCookies bool   `json:"hasCookies"`
+	HasLogin   bool   `json:"hasLogin"`
+	CreatedAt  string `json:"createdAt"`
+	UpdatedAt  string `json:"updatedAt"`
+}
+
+// CredentialService stores per-site cookie files and logins encrypted at rest and hands them to yt-dlp
+// for URLs on their domain. Without VIDRA_SECRET_KEY it stores nothing and yt-dlp runs without credentials.
+type CredentialService struct {
+	queries *database.Queries
+	aead    cipher.AEAD
+}
+
+func NewCredentialService(queries *database.Queries) *CredentialService {
+	s := &CredentialService{queries: queries}
+
+	secret := os.Getenv(secretKeyEnv)
+	if secret == "" {
+		slog.Info("🔒 " + secretKeyEnv + " is not set, site credentials are disabled")
+		return s
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		fatal("Unable to initialize credential encryption", err)
+	}
+	if s.aead, err = cipher.NewGCM(block); err != nil {
+		fatal("Unable to initialize credential encryption", err)
+	}
+	return s
+}
+
+// Enabled reports whether a secret key is configured
+func (s *CredentialService) Enabled() bool {
+	return s.aead != nil
+}
+
+// seal encrypts plain as nonce followed by ciphertext
+func (s *CredentialService) seal(plain []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+func (s *CredentialService) open(sealed []byte) ([]byte, error) {
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, ErrSecretUnreadable
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plain, err := s.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrSecretUnreadable
+	}
+	return plain, nil
+}
+
+// NormalizeCredentialDomain lowercases a domain and rejects anything that is not a bare host name
+func NormalizeCredentialDomain(domain string) (string, error) {
+	domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" {
+		return "", fmt.Errorf("domain is required")
+	}
+	if strings.ContainsAny(domain, "/:@ \t") {
+		return "", fmt.Errorf("invalid domain %q: use a bare host name such as youtube.com", domain)
+	}
+	return domain, nil
+}
+
+// ValidateCookies checks that a cookie file is in the Netscape format: one cookie per line with seven
+// tab-separated fields
+func ValidateCookies(cookies string) error {
+	for i, line := range strings.Split(strings.ReplaceAll(cookies, "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(line) == "" || (strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "#HttpOnly_")) {
+			continue
+		}
+		if len(strings.Split(line, "\t")) != 7 {
+			return fmt.Errorf("invalid cookies: line %d is not a Netscape cookie file entry", i+1)
+		}
+	}
+	return nil
+}
+
+func MapSiteCredential(c database.SiteCredential) SiteCredentialDTO {
+	return SiteCredentialDTO{
+		ID:         c.ID.String(),
+		Domain:     c.Domain,
+		HasCookies: len(c.Cookies) > 0,
+		HasLogin:   len(c.Login) > 0,
+		CreatedAt:  c.CreatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:  c.UpdatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+// Save creates a credential, or updates it if id is valid, encrypting the cookies and login
+func (s *CredentialService) Save(ctx context.Context, id pgtype.UUID, input CredentialInput) (SiteCredentialDTO, error) {
+	if !s.Enabled() {
+		return SiteCredentialDTO{}, ErrSecretKeyMissing
+	}
+
+	var current database.SiteCredential
+	if id.Valid {
+		var err error
+		if current, err = s.queries.GetSiteCredential(ctx, id); err != nil {
+			return SiteCredentialDTO{}, err
+		}
+	}
+
+	cookies := current.Cookies
+	if input.Cookies != nil {
+		cookies = nil
+		if *input.Cookies != "" {
+			text := *input.Cookies
+			if !strings.HasPrefix(text, netscapeCookieHeader) {
+				text = netscapeCookieHeader + "\n" + text
+			}
+			sealed, err := s.seal([]byte(text))
+			if err != nil {
+				return SiteCredentialDTO{}, err
+			}
+			cookies = sealed
+		}
+	}
+
+	login := current.Login
+	if input.Login != nil {
+		login = nil
+		if input.Login.Username != "" {
+			raw, err := json.Marshal(input.Login)
+			if err != nil {
+				return SiteCredentialDTO{}, err
+			}
+			if login, err = s.seal(raw); err != nil {
+				return SiteCredentialDTO{}, err
+			}
+		}
+	}
+
+	var saved database.SiteCredential
+	var err error
+	if id.Valid {
+		saved, err = s.queries.UpdateSiteCredential(ctx, database.UpdateSiteCredentialParams{
+			ID:      id,
+			Domain:  input.Domain,
+			Cookies: cookies,
+			Login:   login,
+		})
+	} else {
+		saved, err = s.queries.CreateSiteCredential(ctx, database.CreateSiteCredentialParams{
+			Domain:  input.Domain,
+			Cookies: cookies,
+			Login:   login,
+		})
+	}
+	if err != nil {
+		return SiteCredentialDTO{}, err
+	}
+	return MapSiteCredential(saved), nil
+}
+
+// match returns the credential of the most specific domain covering the URL's host
+func (s *CredentialService) match(ctx context.Context, rawURL string) (database.SiteCredential, bool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return database.SiteCredential{}, false, nil
+	}
+	host := strings.ToLower(u.Hostname())
+
+	credentials, err := s.queries.ListSiteCredentials(ctx)
+	if err != nil {
+		return database.SiteCredential{}, false, err
+	}
+	var best database.SiteCredential
+	found := false
+	for _, c := range credentials {
+		if matchDomain(host, c.Domain) && len(c.Domain) > len(best.Domain) {
+			best, found = c, true
+		}
+	}
+	return best, found, nil
+}
+
+// Prepare writes the cookies and login for a URL to owner-only temp files and returns the yt-dlp arguments
+// that use them, with a cleanup that deletes the files. Call the cleanup once the command has finished.
+func (s *CredentialService) Prepare(ctx context.Context, rawURL string) ([]string, func(), error) {
+	noop := func() {}
+	if !s.Enabled() {
+		return nil, noop, nil
+	}
+
+	credential, found, err := s.match(ctx, rawURL)
+	if err != nil || !found || (len(credential.Cookies) == 0 && len(credential.Login) == 0) {
+		return nil, noop, err
+	}
+
+	// MkdirTemp creates the directory with mode 0700
+	dir, err := os.MkdirTemp("", "vidra-credentials-*")
+	if err != nil {
+		return nil, noop, err
+	}
+	cleanup := func() {
+		if err := os.RemoveAll(dir); err != nil {
+			slog.Warn("Failed to remove credential files", "path", dir, "error", err)
+		}
+	}
+
+	var args []string
+	if len(credential.Cookies) > 0 {
+		cookies, err := s.open(credential.Cookies)
+		if err != nil {
+			cleanup()
+			return nil, noop, err
+		}
+		path := filepath.Join(dir, "cookies.txt")
+		if err := os.WriteFile(path, cookies, 0600); err != nil {
+			cleanup()
+			return nil, noop, err
+		}
+		args = append(args, "--cookies", path)
+	}
+	if len(credential.Login) > 0 {
+		raw, err := s.open(credential.Login)
+		if err != nil {
+			cleanup()
+			return nil, noop, err
+		}
+		var login SiteLogin
+		if err := json.Unmarshal(raw, &login); err != nil {
+			cleanup()
+			return nil, noop, ErrSecretUnreadable
+		}
+		// --username/--password go through a config file so the password does not show up in the process list
+		config := "--username " + configQuote(login.Username) + "\n--password " + configQuote(login.Password) + "\n"
+		path := filepath.Join(dir, "login.conf")
+		if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+			cleanup()
+			return nil, noop, err
+		}
+		args = append(args, "--config-locations", path)
+	}
+	return args, cleanup, nil
+}
+
+// configQuote quotes a value for a yt-dlp config file, which is split like a POSIX shell command line
+func configQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'"'"'`) + "'"
+}
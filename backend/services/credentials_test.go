@@ -0,0 +1,74 @@
+package services
+
+import "testing"
+
+func TestValidateCookies(t *testing.T) {
+	tests := []struct {
+		name    string
+		cookies string
+		wantErr bool
+	}{
+		{"empty", "", false},
+		{"header and entries", "# Netscape HTTP Cookie File\n.youtube.com\tTRUE\t/\tTRUE\t1767225600\tSID\tabc\n", false},
+		{"http only entry", "#HttpOnly_.example.com\tTRUE\t/\tTRUE\t0\tsession\txyz", false},
+		{"windows line endings", "# comment\r\n.example.com\tTRUE\t/\tFALSE\t0\tname\tvalue\r\n", false},
+		{"blank lines", "\n\n.example.com\tTRUE\t/\tFALSE\t0\tname\tvalue\n\n", false},
+		{"empty value", ".example.com\tTRUE\t/\tFALSE\t0\tname\t", false},
+		{"spaces instead of tabs", ".example.com TRUE / FALSE 0 name value", true},
+		{"too few fields", ".example.com\tTRUE\t/\tFALSE\t0\tname", true},
+		{"too many fields", ".example.com\tTRUE\t/\tFALSE\t0\tname\tvalue\textra", true},
+		{"header string", "SID=abc; HSID=def", true},
+		{"malformed http only entry", "#HttpOnly_.example.com\tTRUE", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateCookies(tt.cookies); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCookies(%q) = %v, want error: %v", tt.cookies, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigQuote(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", `''`},
+		{"user@example.com", `'user@example.com'`},
+		{"pass word", `'pass word'`},
+		{`$HOME "x" \n`, `'$HOME "x" \n'`},
+		{"it's", `'it'"'"'s'`},
+		{"''", `''"'"''"'"''`},
+		{"--exec rm", `'--exec rm'`},
+	}
+
+	for _, tt := range tests {
+		if got := configQuote(tt.value); got != tt.want {
+			t.Errorf("configQuote(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeCredentialDomain(t *testing.T) {
+	tests := []struct {
+		domain  string
+		want    string
+		wantErr bool
+	}{
+		{"youtube.com", "youtube.com", false},
+		{" .YouTube.com ", "youtube.com", false},
+		{"", "", true},
+		{"https://youtube.com", "", true},
+		{"youtube.com:443", "", true},
+		{"user@youtube.com", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeCredentialDomain(tt.domain)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizeCredentialDomain(%q) = %q, %v, want %q, error: %v", tt.domain, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -5,19 +5,23 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"io/fs"
+	"log/slog"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Azmekk/Vidra/backend/gen/database"
-	"github.com/Azmekk/Vidra/backend/utils"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
@@ -47,6 +51,7 @@ const (
 	StatusEncoding    DownloadStatus = "encoding"
 	StatusFinished    DownloadStatus = "completed"
 	StatusError       DownloadStatus = "error"
+	StatusPaused      DownloadStatus = "paused"
 )
 
 type DownloadProgressDTO struct {
@@ -105,23 +110,56 @@ func (p *DownloadProgress) GetSnapshot() DownloadProgressDTO {
 }
 
 type EncodingOptions struct {
-	VideoCodec string // libx264, libvpx-vp9, vp9_qsv
-	AudioCodec string // aac, libopus
-	CRF        int
+	VideoCodec string `json:"videoCodec"` // libx264, libvpx-vp9, vp9_qsv
+	AudioCodec string `json:"audioCodec"` // aac, libopus
+	CRF        int    `json:"crf"`
 }
 
+// DownloadRequest describes a download job. It is stored on the video row so a job can be resumed later.
+type DownloadRequest struct {
+	URL             string               `json:"url"`
+	FormatID        string               `json:"formatId"`
+	FormatPolicy    *FormatPolicy        `json:"formatPolicy,omitempty"` // used without a format ID; default: the settings' policy
+	Name            string               `json:"name"`
+	ReEncode        bool                 `json:"reEncode"`
+	EncodingOptions *EncodingOptions     `json:"encodingOptions,omitempty"`
+	EstimatedSize   int64                `json:"estimatedSize,omitempty"`
+	EstimatedFormat string               `json:"estimatedFormat,omitempty"` // the format selection EstimatedSize was resolved for
+	SponsorBlock    *SponsorBlockOptions `json:"sponsorBlock,omitempty"`
+	YtdlpOptions    []string             `json:"ytdlpOptions,omitempty"` // normalized by NormalizeYtdlpOptions
+	RateLimit       string               `json:"rateLimit,omitempty"`
+}
+
+// quotaCheckInterval is how often a running download re-checks the disk limits
+const quotaCheckInterval = 10 * time.Second
+
 type DownloaderService struct {
 	progress sync.Map // map[string]*DownloadProgress
+	liveLogs sync.Map // map[string]*processLog
 	queries  *database.Queries
 	ws       *WebSocketService
 	ytdlp    *YtdlpService
+	metrics  *MetricsService
+	quota    *QuotaService
+	storage  Storage
+	layout   *LibraryLayout
+	proxies  *ProxyService
+
+	// ytdlpGate is held for reading while a download runs yt-dlp and for writing while yt-dlp is replaced
+	ytdlpGate     sync.RWMutex
+	ytdlpUpdating atomic.Bool
 }
 
-func NewDownloaderService(queries *database.Queries, ws *WebSocketService, ytdlp *YtdlpService) *DownloaderService {
+func NewDownloaderService(queries *database.Queries, ws *WebSocketService, ytdlp *YtdlpService, metrics *MetricsService, quota *QuotaService, storage Storage, layout *LibraryLayout, proxies *ProxyService) *DownloaderService {
 	return &DownloaderService{
 		queries: queries,
 		ws:      ws,
 		ytdlp:   ytdlp,
+		proxies: proxies,
+		metrics: metrics,
+		quota:   quota,
+		storage: storage,
+		layout:  layout,
 	}
 }
 
@@ -144,38 +182,369 @@ func (s *DownloaderService) GetAllProgress() map[string]DownloadProgressDTO {
 	return allProgress
 }
 
-func (s *DownloaderService) DeleteVideoFiles(fileName, thumbnailFileName string) {
-	if fileName != "" {
-		path := filepath.Join("downloads", fileName)
-		log.Printf("INFO: Deleting video file: %s\n", path)
-		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
-			log.Printf("WARN: Failed to delete video file %s: %v\n", path, err)
+// IsRunning reports whether a job for the video is currently active in this process
+func (s *DownloaderService) IsRunning(id string) bool {
+	prog, ok := s.GetProgress(id)
+	if !ok {
+		return false
+	}
+	return prog.Status == StatusPending || prog.Status == StatusDownloading || prog.Status == StatusEncoding
+}
+
+// ActiveJobs returns the number of jobs currently active in this process
+func (s *DownloaderService) ActiveJobs() int {
+	active := 0
+	for id := range s.GetAllProgress() {
+		if s.IsRunning(id) {
+			active++
 		}
 	}
-	if thumbnailFileName != "" {
-		path := filepath.Join("downloads", thumbnailFileName)
-		log.Printf("INFO: Deleting thumbnail file: %s\n", path)
-		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
-			log.Printf("WARN: Failed to delete thumbnail file %s: %v\n", path, err)
+	return active
+}
+
+// HoldYtdlp waits for running yt-dlp downloads to finish and keeps new ones waiting until release is called,
+// so the binary can be replaced safely
+func (s *DownloaderService) HoldYtdlp() (release func()) {
+	s.ytdlpUpdating.Store(true)
+	s.ytdlpGate.Lock()
+	return func() {
+		s.ytdlpGate.Unlock()
+		s.ytdlpUpdating.Store(false)
+	}
+}
+
+// YtdlpUpdating reports whether yt-dlp is being replaced, in which case new downloads wait
+func (s *DownloaderService) YtdlpUpdating() bool {
+	return s.ytdlpUpdating.Load()
+}
+
+// acquireYtdlp blocks a job while yt-dlp is being replaced. The returned release may be called more than once.
+func (s *DownloaderService) acquireYtdlp(id string, prog *DownloadProgress) func() {
+	if !s.ytdlpGate.TryRLock() {
+		prog.Update(s.ws, id, 0, 0, "", "", StatusPending, "Waiting for the yt-dlp update to finish...")
+		s.ytdlpGate.RLock()
+	}
+	var once sync.Once
+	return func() { once.Do(s.ytdlpGate.RUnlock) }
+}
+
+// DeleteVideoFiles removes the given keys from storage. Empty keys and missing files are skipped.
+func (s *DownloaderService) DeleteVideoFiles(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if key == "" {
+			continue
 		}
+		slog.Info("Deleting file", "key", key)
+		if err := s.storage.Delete(ctx, key); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("Failed to delete file", "key", key, "error", err)
+		}
+	}
+}
+
+// DeleteVideo permanently removes the video row first and then its files, and notifies connected clients
+func (s *DownloaderService) DeleteVideo(ctx context.Context, video database.Video) error {
+	if err := s.queries.DeleteVideo(ctx, video.ID); err != nil {
+		return err
+	}
+
+	s.DeleteVideoFiles(ctx, video.FileName.String, video.ThumbnailFileName.String, video.SpriteFileName.String)
+	s.quota.InvalidateLibrarySize()
+	s.ws.Broadcast(WsEventVideoDeleted, map[string]interface{}{"id": video.ID.String(), "permanent": true})
+	return nil
+}
+
+var (
+	// ErrNotRetryable is returned when retrying a video that did not fail or pause
+	ErrNotRetryable = errors.New("only failed or paused downloads can be retried")
+	// ErrNotReencodable is returned when re-encoding a video that has not finished downloading
+	ErrNotReencodable = errors.New("only completed videos can be re-encoded")
+	// ErrJobRunning is returned when a video already has an active job
+	ErrJobRunning = errors.New("a job is already running for this video")
+)
+
+// Retry restarts the download of a failed or paused video from its stored download options
+func (s *DownloaderService) Retry(ctx context.Context, video database.Video) error {
+	status := DownloadStatus(video.DownloadStatus)
+	if status != StatusError && status != StatusPaused {
+		return ErrNotRetryable
+	}
+	if s.IsRunning(video.ID.String()) {
+		return ErrJobRunning
+	}
+
+	var req DownloadRequest
+	if err := json.Unmarshal(video.DownloadOptions, &req); err != nil || req.URL == "" {
+		return fmt.Errorf("download options were not stored for this video")
+	}
+	if err := s.CheckStoredQuota(ctx, video.ID, &req); err != nil {
+		return err
+	}
+
+	if _, err := s.queries.UpdateVideoStatus(ctx, database.UpdateVideoStatusParams{
+		ID:             video.ID,
+		DownloadStatus: string(StatusDownloading),
+	}); err != nil {
+		return err
+	}
+
+	s.StartDownload(context.Background(), video.ID, req)
+	return nil
+}
+
+// Reencode re-encodes the stored file of a completed video and replaces it. It blocks until encoding is done.
+// If encoding fails the error is recorded and the original file is kept.
+func (s *DownloaderService) Reencode(ctx context.Context, video database.Video, opts *EncodingOptions) error {
+	idStr := video.ID.String()
+	if video.DownloadStatus != string(StatusFinished) || !video.FileName.Valid || video.FileName.String == "" {
+		return ErrNotReencodable
+	}
+	if s.IsRunning(idStr) {
+		return ErrJobRunning
+	}
+
+	current := video.FileName.String
+	info, err := s.storage.Stat(ctx, current)
+	if err != nil {
+		return err
+	}
+	// The local copy and the encoded file exist at the same time
+	if err := s.quota.CheckDownload(ctx, 2*info.Size); err != nil {
+		return err
+	}
+
+	opts = withDefaultEncodingOptions(opts)
+	logger := slog.With("video_id", idStr)
+	logger.Info("Re-encoding video", "file", current, "codec", opts.VideoCodec)
+
+	prog := &DownloadProgress{Status: StatusEncoding}
+	s.progress.Store(idStr, prog)
+	prog.Update(s.ws, idStr, 100, 0, "", "", StatusEncoding, "Fetching file from storage...")
+	if _, err := s.queries.UpdateVideoStatus(ctx, database.UpdateVideoStatusParams{
+		ID:             video.ID,
+		DownloadStatus: string(StatusEncoding),
+	}); err != nil {
+		return err
+	}
+
+	// restore records the failure and puts the video back to completed; its original file is untouched
+	restore := func(failure jobFailure) error {
+		logger.Error("Re-encode failed", "command", failure.command, "error", failure.message)
+		if _, err := s.queries.CreateError(context.Background(), database.CreateErrorParams{
+			VideoID:      video.ID,
+			ErrorMessage: "Re-encode failed: " + failure.message,
+			Command:      failure.command,
+			Output:       failure.output,
+		}); err != nil {
+			logger.Error("Failed to record error", "error", err)
+		}
+		if _, err := s.queries.UpdateVideoStatus(context.Background(), database.UpdateVideoStatusParams{
+			ID:             video.ID,
+			DownloadStatus: string(StatusFinished),
+		}); err != nil {
+			logger.Error("Failed to update video status", "error", err)
+		}
+		prog.Update(s.ws, idStr, 100, 0, "", "", StatusFinished, "Re-encode failed: "+failure.message)
+		return errors.New(failure.message)
+	}
+
+	localSource := filepath.Join(DownloadsDir, idStr+path.Ext(current))
+	if err := s.fetchFromStorage(ctx, current, localSource); err != nil {
+		return restore(jobFailure{command: "storage", message: "Failed to fetch video file: " + err.Error()})
+	}
+	defer os.Remove(localSource)
+
+	encoded, failure := s.encodeVideo(logger, video.ID, prog, localSource, opts)
+	if failure != nil {
+		return restore(*failure)
+	}
+	defer os.Remove(encoded)
+
+	var size int64
+	if encodedInfo, err := os.Stat(encoded); err == nil {
+		size = encodedInfo.Size()
+	}
+	if _, err := recordMediaInfo(ctx, s.queries, s.metrics, video.ID, encoded); err != nil {
+		logger.Warn("Failed to record media info", "error", err)
+	}
+
+	key, release := s.layout.ReserveReplacement(ctx, current, strings.TrimPrefix(filepath.Ext(encoded), "."))
+	defer release()
+	if err := s.storage.Put(ctx, key, encoded); err != nil {
+		return restore(jobFailure{command: "storage", message: "Failed to store encoded file: " + err.Error()})
+	}
+	if key != current {
+		s.DeleteVideoFiles(ctx, current)
+	}
+
+	if _, err := s.queries.UpdateVideoFiles(ctx, database.UpdateVideoFilesParams{
+		ID:                video.ID,
+		FileName:          pgtype.Text{String: key, Valid: true},
+		ThumbnailFileName: video.ThumbnailFileName,
+		FileSize:          pgtype.Int8{Int64: size, Valid: size > 0},
+	}); err != nil {
+		logger.Error("Failed to update video file names in database", "error", err)
+	}
+	if err := s.queries.UpdateVideoCodec(ctx, database.UpdateVideoCodecParams{
+		ID:         video.ID,
+		VideoCodec: pgtype.Text{String: NormalizeVideoCodec(opts.VideoCodec), Valid: true},
+	}); err != nil {
+		logger.Warn("Failed to store video codec", "error", err)
+	}
+	if _, err := s.queries.UpdateVideoStatus(ctx, database.UpdateVideoStatusParams{
+		ID:             video.ID,
+		DownloadStatus: string(StatusFinished),
+	}); err != nil {
+		logger.Error("Failed to update video status in database", "error", err)
 	}
+
+	prog.Update(s.ws, idStr, 100, 100, "", "", StatusFinished, "Re-encode complete")
+	s.quota.InvalidateLibrarySize()
+	logger.Info("Re-encode finished", "file", key)
+	return nil
 }
 
-func (s *DownloaderService) UpdateYtdlp(ctx context.Context) (string, error) {
-	cmd := s.ytdlp.UpdateCommand(ctx)
-	output, err := cmd.CombinedOutput()
-	return string(output), err
+// fetchFromStorage copies a stored object to a local path
+func (s *DownloaderService) fetchFromStorage(ctx context.Context, key, dst string) error {
+	src, err := s.storage.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// estimateSize asks yt-dlp for the size of what a format selector and sort would fetch. It returns 0 if the
+// site does not tell.
+func (s *DownloaderService) estimateSize(ctx context.Context, url, format, sort string) (int64, error) {
+	cmd, cleanup, err := s.ytdlp.SizeCommand(ctx, url, format, sort)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare credentials: %w", err)
+	}
+	defer cleanup()
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	s.metrics.ObserveExit("yt-dlp", err)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the download size: %w (stderr: %s)", err, stderr.String())
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	if err != nil {
+		return 0, nil
+	}
+	return size, nil
+}
+
+// downloadSize returns the estimated size of a download, or 0 if it is unknown. The estimate is kept in req
+// with the format selection it was resolved for, and yt-dlp is only asked again once the selection changed,
+// e.g. because the default format policy was edited. Failed probes are not kept.
+func (s *DownloaderService) downloadSize(ctx context.Context, req *DownloadRequest) int64 {
+	format, sort := formatSelection(*req, s.ytdlp.settings.GetDefaultFormatPolicy(ctx))
+	selection := format + " " + sort
+	if req.EstimatedFormat == selection {
+		return req.EstimatedSize
+	}
+
+	size, err := s.estimateSize(ctx, req.URL, format, sort)
+	if err != nil {
+		slog.Warn("Failed to estimate download size", "url", req.URL, "error", err)
+		return 0
+	}
+	req.EstimatedSize = size
+	req.EstimatedFormat = selection
+	return size
+}
+
+// CheckQuota checks a download against the disk limits. The size is resolved with yt-dlp rather than taken
+// from the client and stored in req.EstimatedSize. While a limit is configured, downloads whose size yt-dlp
+// cannot tell are refused, since nothing would stop them from exceeding it.
+func (s *DownloaderService) CheckQuota(ctx context.Context, req *DownloadRequest) error {
+	limited, err := s.quota.Limited(ctx)
+	if err != nil {
+		return err
+	}
+	if !limited {
+		return nil
+	}
+
+	size := s.downloadSize(ctx, req)
+	if size <= 0 {
+		return fmt.Errorf("%w: the size of this download is unknown, so it cannot be checked against the disk limits", ErrQuotaExceeded)
+	}
+	return s.quota.CheckDownload(ctx, size)
+}
+
+// CheckStoredQuota is CheckQuota for the stored download options of a video. A new size estimate is saved
+// with them even if the download is refused, so that retries and scheduled starts do not ask yt-dlp again.
+func (s *DownloaderService) CheckStoredQuota(ctx context.Context, id pgtype.UUID, req *DownloadRequest) error {
+	selection := req.EstimatedFormat
+	err := s.CheckQuota(ctx, req)
+	if req.EstimatedFormat != selection {
+		s.storeDownloadOptions(ctx, id, *req)
+	}
+	return err
+}
+
+// storeDownloadOptions saves the download options of a video, e.g. after its size estimate changed
+func (s *DownloaderService) storeDownloadOptions(ctx context.Context, id pgtype.UUID, req DownloadRequest) {
+	options, err := json.Marshal(req)
+	if err == nil {
+		err = s.queries.UpdateVideoDownloadOptions(ctx, database.UpdateVideoDownloadOptionsParams{
+			ID:              id,
+			DownloadOptions: options,
+		})
+	}
+	if err != nil {
+		slog.Warn("Failed to store download options", "video_id", id.String(), "error", err)
+	}
+}
+
+// checkMaxSize refuses a download whose estimated size, video and audio together, is above the max size of
+// its format policy. Like formats in the selector, downloads of unknown size are allowed.
+func (s *DownloaderService) checkMaxSize(ctx context.Context, id pgtype.UUID, req *DownloadRequest) error {
+	policy := requestFormatPolicy(*req, s.ytdlp.settings.GetDefaultFormatPolicy(ctx))
+	if policy.MaxSize == "" {
+		return nil
+	}
+
+	selection := req.EstimatedFormat
+	size := s.downloadSize(ctx, req)
+	if req.EstimatedFormat != selection {
+		s.storeDownloadOptions(ctx, id, *req)
+	}
+	if limit := parseFormatSize(policy.MaxSize); size > limit {
+		// Decimal gigabytes, like the size suffixes
+		return fmt.Errorf("download is estimated at %.2f GB, above the %s max size of the format policy",
+			float64(size)/1e9, policy.MaxSize)
+	}
+	return nil
 }
 
 func (s *DownloaderService) GetVideoMetadata(ctx context.Context, url string) (*VideoMetadata, error) {
-	cmd := s.ytdlp.MetadataCommand(ctx, url)
-	log.Printf("DEBUG: Getting metadata with command: %s\n", cmd.String())
+	cmd, cleanup, err := s.ytdlp.MetadataCommand(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare credentials: %w", err)
+	}
+	defer cleanup()
+	slog.Debug("Getting metadata", "command", cmd.String())
 
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 	output, err := cmd.Output()
+	s.metrics.ObserveExit("yt-dlp", err)
 	if err != nil {
-		log.Printf("ERROR: yt-dlp metadata failed: %v, stderr: %s\n", err, stderr.String())
+		slog.Error("yt-dlp metadata failed", "error", err, "stderr", stderr.String())
 		return nil, fmt.Errorf("failed to get metadata: %w (stderr: %s)", err, stderr.String())
 	}
 
@@ -223,6 +592,9 @@ func (s *DownloaderService) GetVideoMetadata(ctx context.Context, url string) (*
 	return metadata, nil
 }
 
+// extractorRegex matches yt-dlp's "[youtube] Extracting URL: ..." line to learn which extractor handles the URL
+var extractorRegex = regexp.MustCompile(`^\[([\w:]+)\] Extracting URL`)
+
 func getOutputExtension(codec string) string {
 	if codec == "libvpx-vp9" || codec == "vp9_qsv" {
 		return ".webm"
@@ -230,6 +602,18 @@ func getOutputExtension(codec string) string {
 	return ".mp4"
 }
 
+// withDefaultEncodingOptions returns opts, or H.264/AAC at CRF 23 if none were given
+func withDefaultEncodingOptions(opts *EncodingOptions) *EncodingOptions {
+	if opts != nil {
+		return opts
+	}
+	return &EncodingOptions{
+		VideoCodec: "libx264",
+		AudioCodec: "aac",
+		CRF:        23,
+	}
+}
+
 func buildFFmpegCommand(input, output string, opts *EncodingOptions) *exec.Cmd {
 	args := []string{"-i", input}
 
@@ -249,126 +633,157 @@ func buildFFmpegCommand(input, output string, opts *EncodingOptions) *exec.Cmd {
 		args = append(args, "-c:a", "aac")
 	}
 
+	// Keep the chapters embedded by yt-dlp
+	args = append(args, "-map_chapters", "0")
+
 	args = append(args, "-progress", "-", "-y", output)
 	return exec.Command("ffmpeg", args...)
 }
 
-func (s *DownloaderService) StartDownload(ctx context.Context, id pgtype.UUID, url string, formatID string, finalBaseName string, reEncode bool, encodingOptions *EncodingOptions) {
+// failJob marks a job as failed: it records the error, updates progress and persists the error status
+func (s *DownloaderService) failJob(logger *slog.Logger, id pgtype.UUID, prog *DownloadProgress, command, message, output string) {
+	logger.Error("Job failed", "command", command, "error", message)
+	snapshot := prog.GetSnapshot()
+	prog.Update(s.ws, id.String(), snapshot.Percent, snapshot.EncodingPercent, "", "", StatusError, message)
+
+	if _, err := s.queries.CreateError(context.Background(), database.CreateErrorParams{
+		VideoID:      id,
+		ErrorMessage: message,
+		Command:      command,
+		Output:       output,
+	}); err != nil {
+		logger.Error("Failed to record error", "error", err)
+	}
+	if _, err := s.queries.UpdateVideoStatus(context.Background(), database.UpdateVideoStatusParams{
+		ID:             id,
+		DownloadStatus: string(StatusError),
+	}); err != nil {
+		logger.Error("Failed to update video status", "error", err)
+	}
+}
+
+// pauseJob stops a job without treating it as an error. The partial download is kept so it can be resumed.
+func (s *DownloaderService) pauseJob(logger *slog.Logger, id pgtype.UUID, prog *DownloadProgress, reason string) {
+	logger.Warn("Job paused", "reason", reason)
+	snapshot := prog.GetSnapshot()
+	prog.Update(s.ws, id.String(), snapshot.Percent, 0, "", "", StatusPaused, "Paused: "+reason)
+
+	if _, err := s.queries.UpdateVideoStatus(context.Background(), database.UpdateVideoStatusParams{
+		ID:             id,
+		DownloadStatus: string(StatusPaused),
+	}); err != nil {
+		logger.Error("Failed to update video status", "error", err)
+	}
+}
+
+func (s *DownloaderService) StartDownload(ctx context.Context, id pgtype.UUID, req DownloadRequest) {
 	idStr := id.String()
-	finalBaseName = utils.SanitizeFilename(finalBaseName)
+	logger := slog.With("video_id", idStr)
 
-	log.Printf("INFO [%s]: Initializing download task for URL: %s (final name: %s)\n", idStr, url, finalBaseName)
+	logger.Info("Initializing download task", "url", req.URL, "name", req.Name)
 
 	prog := &DownloadProgress{Status: StatusPending}
 	s.progress.Store(idStr, prog)
 
 	go func() {
+		// The extractor is parsed from yt-dlp's output; the download counts as started once it is known
+		extractor := ""
+		succeeded := false
+		paused := false
+		defer func() {
+			if extractor == "" {
+				extractor = "unknown"
+				s.metrics.DownloadStarted(extractor)
+			}
+			if succeeded {
+				s.metrics.DownloadCompleted(extractor)
+			} else if !paused {
+				s.metrics.DownloadFailed(extractor)
+			}
+		}()
+
 		// 1. Download as guid.ext
-		f := formatID
-		if f == "" {
-			f = "bestvideo+bestaudio/best"
-		} else {
-			f = f + "+bestaudio/best"
+		f, sort := formatSelection(req, s.ytdlp.settings.GetDefaultFormatPolicy(context.Background()))
+
+		tempPathPattern := filepath.Join(DownloadsDir, idStr+".%(ext)s")
+		logger.Info("Starting yt-dlp download", "format", f, "format_sort", sort)
+		releaseYtdlp := s.acquireYtdlp(idStr, prog)
+		defer releaseYtdlp()
+		if err := s.checkMaxSize(context.Background(), id, &req); err != nil {
+			s.failJob(logger, id, prog, "max-size", err.Error(), "")
+			return
 		}
-
-		tempPathPattern := filepath.Join("downloads", idStr+".%(ext)s")
-		log.Printf("INFO [%s]: Starting yt-dlp download with format: %s\n", idStr, f)
 		prog.Update(s.ws, idStr, 0, 0, "", "", StatusDownloading, "Starting download...")
 
-		cmd := s.ytdlp.DownloadCommand(context.Background(), url, YtdlpDownloadOptions{
+		opts := YtdlpDownloadOptions{
 			FormatID:          f,
+			FormatSort:        sort,
 			OutputPattern:     tempPathPattern,
 			WriteThumbnail:    true,
 			ConvertThumbnails: "jpg",
-		})
-		log.Printf("DEBUG [%s]: Executing command: %s\n", idStr, cmd.String())
-		var fullOutput bytes.Buffer
-
-		stdout, err := cmd.StdoutPipe()
-		if err != nil {
-			log.Printf("ERROR [%s]: Failed to create stdout pipe: %v\n", idStr, err)
-			prog.Update(s.ws, idStr, 0, 0, "", "", StatusError, "Failed to create stdout pipe: "+err.Error())
-			return
+			WriteInfoJSON:     true,
+			EmbedChapters:     true,
+			SponsorBlock:      req.SponsorBlock,
+			ExtraArgs:         req.YtdlpOptions,
+			RateLimit:         req.RateLimit,
 		}
-		cmd.Stderr = &fullOutput
 
-		if err := cmd.Start(); err != nil {
-			log.Printf("ERROR [%s]: Failed to start yt-dlp: %v\n", idStr, err)
-			prog.Update(s.ws, idStr, 0, 0, "", "", StatusError, "Failed to start yt-dlp: "+err.Error())
-			s.queries.CreateError(context.Background(), database.CreateErrorParams{
-				VideoID:      id,
-				ErrorMessage: err.Error(),
-				Command:      "yt-dlp (start)",
-				Output:       "",
-			})
-			s.queries.UpdateVideoStatus(context.Background(), database.UpdateVideoStatusParams{
-				ID:             id,
-				DownloadStatus: string(StatusError),
-			})
+		// Retries know the extractor from the first attempt, which lets extractor proxy rules match exactly
+		knownExtractor := ""
+		if video, err := s.queries.GetVideo(context.Background(), id); err == nil {
+			knownExtractor = video.Extractor.String
+		}
+		candidates, err := s.proxies.Candidates(context.Background(), req.URL, knownExtractor)
+		if err != nil {
+			s.failJob(logger, id, prog, "proxy-select", err.Error(), "")
 			return
 		}
 
-		// Use TeeReader to capture stdout while scanning
-		multiReader := io.TeeReader(stdout, &fullOutput)
-		scanner := bufio.NewScanner(multiReader)
-		progressRegex := regexp.MustCompile(`\[download\]\s+(\d+\.?\d*)%\s+of\s+.*\s+at\s+(.*)\s+ETA\s+(.*)`)
-
-		for scanner.Scan() {
-			line := scanner.Text()
-			matches := progressRegex.FindStringSubmatch(line)
-			if len(matches) == 4 {
-				percent, _ := strconv.ParseFloat(matches[1], 64)
-				prog.Update(s.ws, idStr, percent, 0, matches[2], matches[3], StatusDownloading, line)
-			} else {
-				prog.mu.Lock()
-				prog.LastOutput = line
-				prog.mu.Unlock()
+		// Rotate through the candidate proxies while the site refuses them
+		downloadStart := time.Now()
+		for attempt := 0; ; attempt++ {
+			var proxy ProxyChoice
+			if attempt < len(candidates) {
+				proxy = candidates[attempt]
 			}
-		}
+			opts.Proxy = proxy.URL
 
-		if err := cmd.Wait(); err != nil {
-			outputStr := fullOutput.String()
-			log.Printf("ERROR [%s]: yt-dlp download failed: %v\nOutput: %s\n", idStr, err, outputStr)
-			prog.Update(s.ws, idStr, prog.Percent, 0, prog.Speed, prog.ETA, StatusError, fmt.Sprintf("Download failed: %v", err))
-
-			s.queries.CreateError(context.Background(), database.CreateErrorParams{
-				VideoID:      id,
-				ErrorMessage: err.Error(),
-				Command:      "yt-dlp",
-				Output:       outputStr,
-			})
-			s.queries.UpdateVideoStatus(context.Background(), database.UpdateVideoStatusParams{
-				ID:             id,
-				DownloadStatus: string(StatusError),
-			})
-			return
+			reason, failure := s.runYtdlpDownload(logger, id, prog, req.URL, opts, &extractor)
+			if reason != "" {
+				paused = true
+				s.pauseJob(logger, id, prog, reason)
+				return
+			}
+			if failure == nil {
+				break
+			}
+			if !ProxyBlocked(failure.output) {
+				s.failJob(logger, id, prog, failure.command, failure.message, failure.output)
+				return
+			}
+			s.proxies.ReportBlocked(proxy)
+			if attempt+1 >= len(candidates) {
+				s.failJob(logger, id, prog, failure.command, failure.message, failure.output)
+				return
+			}
+			logger.Warn("Proxy refused, retrying with the next one", "proxy_id", proxy.ID, "attempt", attempt+1)
+			prog.Update(s.ws, idStr, 0, 0, "", "", StatusDownloading, "Proxy refused, retrying with the next one...")
 		}
 
-		log.Printf("INFO [%s]: Download completed. Searching for downloaded file...\n", idStr)
+		releaseYtdlp()
+		logger.Info("Download completed, searching for downloaded file")
 
 		// 2. Find the downloaded file
-		files, _ := filepath.Glob(filepath.Join("downloads", idStr+".*"))
+		files, _ := filepath.Glob(filepath.Join(DownloadsDir, idStr+".*"))
 		if len(files) == 0 {
-			msg := "Downloaded file not found in downloads directory"
-			log.Printf("ERROR [%s]: %s\n", idStr, msg)
-			prog.Update(s.ws, idStr, 100, 0, "", "", StatusError, msg)
-			s.queries.CreateError(context.Background(), database.CreateErrorParams{
-				VideoID:      id,
-				ErrorMessage: msg,
-				Command:      "file-glob",
-				Output:       "",
-			})
-			s.queries.UpdateVideoStatus(context.Background(), database.UpdateVideoStatusParams{
-				ID:             id,
-				DownloadStatus: string(StatusError),
-			})
+			s.failJob(logger, id, prog, "file-glob", "Downloaded file not found in downloads directory", "")
 			return
 		}
 		var tempFile string
 		for _, f := range files {
 			ext := strings.ToLower(filepath.Ext(f))
-			// Skip thumbnails and temporary files
-			if ext == ".jpg" || ext == ".jpeg" || ext == ".png" || ext == ".webp" || ext == ".part" || ext == ".ytdl" {
+			// Skip thumbnails, subtitles and temporary files
+			if ext == ".jpg" || ext == ".jpeg" || ext == ".png" || ext == ".webp" || ext == ".part" || ext == ".ytdl" || ext == ".json" || subtitleExtensions[ext] {
 				continue
 			}
 			tempFile = f
@@ -376,172 +791,154 @@ func (s *DownloaderService) StartDownload(ctx context.Context, id pgtype.UUID, u
 		}
 
 		if tempFile == "" {
-			msg := "Downloaded video file not found in downloads directory (only found thumbnails)"
-			log.Printf("ERROR [%s]: %s\n", idStr, msg)
-			prog.Update(s.ws, idStr, 100, 0, "", "", StatusError, msg)
-			s.queries.CreateError(context.Background(), database.CreateErrorParams{
-				VideoID:      id,
-				ErrorMessage: msg,
-				Command:      "file-glob-check",
-				Output:       "",
-			})
-			s.queries.UpdateVideoStatus(context.Background(), database.UpdateVideoStatusParams{
-				ID:             id,
-				DownloadStatus: string(StatusError),
-			})
+			s.failJob(logger, id, prog, "file-glob-check", "Downloaded video file not found in downloads directory (only found thumbnails)", "")
 			return
 		}
-		log.Printf("INFO [%s]: Found temporary video file: %s\n", idStr, tempFile)
-
-		// 3. Process video (Encode or Rename)
-		var finalFileName string
-		if reEncode {
-			// Set default encoding options if not provided
-			opts := encodingOptions
-			if opts == nil {
-				opts = &EncodingOptions{
-					VideoCodec: "libx264",
-					AudioCodec: "aac",
-					CRF:        23,
-				}
-			}
-
-			outputExt := getOutputExtension(opts.VideoCodec)
-			finalFileName = finalBaseName + outputExt
-			finalPath := filepath.Join("downloads", finalFileName)
-			tempEncodePath := filepath.Join("downloads", idStr+"_encoded"+outputExt)
-
-			log.Printf("INFO [%s]: Starting ffmpeg encoding with codec %s: %s\n", idStr, opts.VideoCodec, tempEncodePath)
-			prog.Update(s.ws, idStr, 100, 0, "", "", StatusEncoding, "Getting video duration...")
-
-			// Get duration for progress calculation
-			durationCmd := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", tempFile)
-			durationOut, err := durationCmd.Output()
-			duration := 0.0
-			if err == nil {
-				duration, _ = strconv.ParseFloat(strings.TrimSpace(string(durationOut)), 64)
-			}
-			log.Printf("INFO [%s]: Video duration: %.2fs\n", idStr, duration)
-
-			prog.Update(s.ws, idStr, 100, 0, "", "", StatusEncoding, fmt.Sprintf("Encoding with %s...", opts.VideoCodec))
+		logger.Info("Found temporary video file", "path", tempFile)
 
-			encodeCmd := buildFFmpegCommand(tempFile, tempEncodePath, opts)
-			log.Printf("DEBUG [%s]: ffmpeg command: %s\n", idStr, encodeCmd.String())
-
-			var encodeOutput bytes.Buffer
-			encodeStdout, err := encodeCmd.StdoutPipe()
-			if err != nil {
-				log.Printf("ERROR [%s]: Failed to create ffmpeg stdout pipe: %v\n", idStr, err)
-				prog.Update(s.ws, idStr, 100, 0, "", "", StatusError, "Failed to create ffmpeg stdout pipe: "+err.Error())
-				return
-			}
-			encodeCmd.Stderr = &encodeOutput
-
-			if err := encodeCmd.Start(); err != nil {
-				log.Printf("ERROR [%s]: Failed to start ffmpeg: %v\n", idStr, err)
-				prog.Update(s.ws, idStr, 100, 0, "", "", StatusError, "Failed to start ffmpeg: "+err.Error())
-				return
+		var downloadedBytes int64
+		if info, err := os.Stat(tempFile); err == nil {
+			downloadedBytes = info.Size()
+		}
+		s.metrics.ObserveDownload(extractor, time.Since(downloadStart).Seconds(), downloadedBytes)
+
+		// 3. Read the metadata yt-dlp wrote next to the video
+		meta := LayoutMetadata{Title: req.Name, UUID: idStr}
+		videoCodec := ""
+		duration := 0.0
+		if info, err := ReadInfoJSON(filepath.Join(DownloadsDir, idStr+".info.json")); err != nil {
+			logger.Warn("Failed to read info.json", "error", err)
+		} else {
+			meta.ID = info.ID
+			meta.Uploader = info.Uploader
+			meta.UploadDate = info.UploadDate
+			meta.Extractor = info.Extractor
+			videoCodec = NormalizeVideoCodec(info.VCodec)
+			duration = info.Duration
+			if _, err := s.queries.UpdateVideoMetadata(context.Background(), database.UpdateVideoMetadataParams{
+				ID:          id,
+				ExternalID:  pgtype.Text{String: info.ID, Valid: info.ID != ""},
+				Uploader:    pgtype.Text{String: info.Uploader, Valid: info.Uploader != ""},
+				UploadDate:  info.UploadDateValue(),
+				Extractor:   pgtype.Text{String: info.Extractor, Valid: info.Extractor != ""},
+				Description: pgtype.Text{String: info.Description, Valid: info.Description != ""},
+				Duration:    pgtype.Float8{Float64: info.Duration, Valid: info.Duration > 0},
+			}); err != nil {
+				logger.Error("Failed to store video metadata", "error", err)
 			}
-
-			encodeScanner := bufio.NewScanner(encodeStdout)
-			for encodeScanner.Scan() {
-				line := encodeScanner.Text()
-				if after, ok := strings.CutPrefix(line, "out_time_ms="); ok {
-					timeUsStr := after
-					timeUs, _ := strconv.ParseFloat(timeUsStr, 64)
-					if duration > 0 {
-						encodingPercent := (timeUs / 1000000.0 / duration) * 100.0
-						if encodingPercent > 100 {
-							encodingPercent = 100
-						}
-						prog.Update(s.ws, idStr, 100, encodingPercent, "", "", StatusEncoding, "Encoding in progress...")
-					}
+			// Cut segments shift the timestamps, so those chapters only come from probing the final file
+			if chapters := chaptersFromInfo(info); len(chapters) > 0 && (req.SponsorBlock == nil || req.SponsorBlock.Mode != SponsorBlockRemove) {
+				if err := storeChapters(context.Background(), s.queries, id, chapters); err != nil {
+					logger.Warn("Failed to store chapters", "error", err)
 				}
 			}
+		}
 
-			if err := encodeCmd.Wait(); err != nil {
-				outputStr := encodeOutput.String()
-				log.Printf("ERROR [%s]: ffmpeg encoding failed: %v\nOutput: %s\n", idStr, err, outputStr)
-				prog.Update(s.ws, idStr, 100, 0, "", "", StatusError, fmt.Sprintf("Encoding failed: %v\nOutput: %s", err, outputStr))
-				os.Remove(tempEncodePath) // Clean up partial encoded file
-
-				s.queries.CreateError(context.Background(), database.CreateErrorParams{
-					VideoID:      id,
-					ErrorMessage: err.Error(),
-					Command:      "ffmpeg",
-					Output:       outputStr,
-				})
-				s.queries.UpdateVideoStatus(context.Background(), database.UpdateVideoStatusParams{
-					ID:             id,
-					DownloadStatus: string(StatusError),
-				})
-				return
+		// Index subtitles for search if yt-dlp wrote any; they are removed with the other temp files
+		if text := ReadSubtitleText(FindSubtitleFiles(filepath.Join(DownloadsDir, idStr))); text != "" {
+			if err := s.queries.SetVideoSubtitles(context.Background(), database.SetVideoSubtitlesParams{
+				VideoID:      id,
+				SubtitleText: text,
+			}); err != nil {
+				logger.Warn("Failed to store subtitle text", "error", err)
 			}
+		}
 
-			// Move encoded file to final path
-			if err := os.Rename(tempEncodePath, finalPath); err != nil {
-				log.Printf("ERROR [%s]: Failed to rename encoded file: %v\n", idStr, err)
-				prog.Update(s.ws, idStr, 100, 0, "", "", StatusError, "Failed to rename encoded file: "+err.Error())
+		// 4. Process video (Encode or keep as downloaded)
+		finalSource := tempFile
+		if req.ReEncode {
+			opts := withDefaultEncodingOptions(req.EncodingOptions)
+			tempEncodePath, failure := s.encodeVideo(logger, id, prog, tempFile, opts)
+			if failure != nil {
+				s.failJob(logger, id, prog, failure.command, failure.message, failure.output)
 				return
 			}
-			log.Printf("INFO [%s]: Encoding successful. Cleaning up temporary file: %s\n", idStr, tempFile)
+
+			finalSource = tempEncodePath
+			videoCodec = NormalizeVideoCodec(opts.VideoCodec)
+			logger.Info("Encoding successful", "path", tempEncodePath)
 		} else {
-			log.Printf("INFO [%s]: Skipping re-encoding as requested.\n", idStr)
+			logger.Info("Skipping re-encoding as requested")
 			prog.Update(s.ws, idStr, 100, 100, "", "", StatusEncoding, "Skipping encoding...")
+		}
 
-			finalFileName = finalBaseName + filepath.Ext(tempFile)
-			finalPath := filepath.Join("downloads", finalFileName)
+		// 5. Pick the final location from the filename template
+		ext := strings.TrimPrefix(filepath.Ext(finalSource), ".")
+		finalFileName, finalThumbnailName, release := s.layout.Reserve(context.Background(), meta, ext)
+		defer release()
+		logger.Info("Resolved library path", "file", finalFileName)
 
-			if err := os.Rename(tempFile, finalPath); err != nil {
-				log.Printf("ERROR [%s]: Failed to rename downloaded file: %v\n", idStr, err)
-				prog.Update(s.ws, idStr, 100, 0, "", "", StatusError, "Failed to rename downloaded file: "+err.Error())
-				return
+		var fileSize int64
+		if fileInfo, err := os.Stat(finalSource); err == nil {
+			fileSize = fileInfo.Size()
+			logger.Info("Final file size", "bytes", fileSize)
+		} else {
+			logger.Warn("Failed to get file size", "error", err)
+		}
+
+		// 6. Probe the final file, grab a frame if yt-dlp did not write a thumbnail (saved as idStr.jpg due to
+		// --convert-thumbnails jpg and our -o pattern), and render the timeline sprite sheet, while the file is still local
+		prog.Update(s.ws, idStr, 100, 100, "", "", StatusEncoding, "Generating previews...")
+		if mediaInfo, err := recordMediaInfo(context.Background(), s.queries, s.metrics, id, finalSource); err != nil {
+			logger.Warn("Failed to record media info", "error", err)
+		} else if duration <= 0 {
+			duration = mediaInfo.Duration
+		}
+		tempThumbnailPath := filepath.Join(DownloadsDir, idStr+".jpg")
+		if _, err := os.Stat(tempThumbnailPath); err != nil {
+			logger.Info("Thumbnail not found, grabbing a frame from the video", "path", tempThumbnailPath)
+			if err := generateThumbnail(context.Background(), s.metrics, finalSource, tempThumbnailPath, duration); err != nil {
+				logger.Warn("Failed to generate thumbnail", "error", err)
 			}
-			log.Printf("INFO [%s]: Rename successful: %s -> %s\n", idStr, tempFile, finalPath)
+		}
+		tempSpritePath := filepath.Join(DownloadsDir, idStr+spriteSuffix)
+		sprite, spriteErr := generateSprite(context.Background(), s.metrics, finalSource, tempSpritePath, duration)
+		if spriteErr != nil {
+			logger.Warn("Failed to generate sprite sheet", "error", spriteErr)
 		}
 
-		// 4. Handle thumbnail
-		finalThumbnailName := finalBaseName + ".jpg"
-		finalThumbnailPath := filepath.Join("downloads", finalThumbnailName)
+		// 7. Hand the finished files to storage
+		if err := s.storage.Put(context.Background(), finalFileName, finalSource); err != nil {
+			s.failJob(logger, id, prog, "storage", "Failed to store video file: "+err.Error(), "")
+			return
+		}
 
-		// yt-dlp saves thumbnail as idStr.jpg due to --convert-thumbnails jpg and our -o pattern
-		tempThumbnailPath := filepath.Join("downloads", idStr+".jpg")
 		if _, err := os.Stat(tempThumbnailPath); err == nil {
-			log.Printf("INFO [%s]: Found thumbnail: %s, renaming to: %s\n", idStr, tempThumbnailPath, finalThumbnailPath)
-			if err := os.Rename(tempThumbnailPath, finalThumbnailPath); err != nil {
-				log.Printf("WARN [%s]: Failed to rename thumbnail: %v\n", idStr, err)
-				finalThumbnailName = "" // Reset if rename failed
+			logger.Info("Storing thumbnail", "from", tempThumbnailPath, "to", finalThumbnailName)
+			if err := s.storage.Put(context.Background(), finalThumbnailName, tempThumbnailPath); err != nil {
+				logger.Warn("Failed to store thumbnail", "error", err)
+				finalThumbnailName = ""
 			}
 		} else {
-			log.Printf("WARN [%s]: Thumbnail not found at %s\n", idStr, tempThumbnailPath)
 			finalThumbnailName = ""
 		}
 
-		// 5. Cleanup all remaining temporary files for this ID
-		log.Printf("INFO [%s]: Cleaning up temporary files matching %s.*\n", idStr, idStr)
-		remainingFiles, _ := filepath.Glob(filepath.Join("downloads", idStr+".*"))
+		spriteKey := ""
+		if spriteErr == nil {
+			key, releaseSprite := s.layout.ReserveKey(context.Background(), SpriteKey(finalFileName))
+			defer releaseSprite()
+			if err := s.storage.Put(context.Background(), key, tempSpritePath); err != nil {
+				logger.Warn("Failed to store sprite sheet", "error", err)
+			} else {
+				spriteKey = key
+			}
+		}
+
+		// 8. Cleanup all remaining temporary files for this ID
+		logger.Info("Cleaning up temporary files", "pattern", idStr+".*")
+		remainingFiles, _ := filepath.Glob(filepath.Join(DownloadsDir, idStr+".*"))
 		for _, f := range remainingFiles {
 			if err := os.Remove(f); err != nil {
 				if !os.IsNotExist(err) {
-					log.Printf("WARN [%s]: Failed to remove temporary file %s: %v\n", idStr, f, err)
+					logger.Warn("Failed to remove temporary file", "path", f, "error", err)
 				}
 			} else {
-				log.Printf("INFO [%s]: Removed temporary file: %s\n", idStr, f)
+				logger.Debug("Removed temporary file", "path", f)
 			}
 		}
 
-		// 6. Get file size
-		var fileSize int64
-		finalPath := filepath.Join("downloads", finalFileName)
-		if fileInfo, err := os.Stat(finalPath); err == nil {
-			fileSize = fileInfo.Size()
-			log.Printf("INFO [%s]: Final file size: %d bytes\n", idStr, fileSize)
-		} else {
-			log.Printf("WARN [%s]: Failed to get file size: %v\n", idStr, err)
-		}
-
-		// 7. Update database
-		log.Printf("INFO [%s]: Updating database with final file names and status.\n", idStr)
+		// 9. Update database
+		logger.Info("Updating database with final file names and status")
 		prog.Update(s.ws, idStr, 100, 100, "", "", StatusFinished, "Processing complete")
 
 		_, err = s.queries.UpdateVideoFiles(context.Background(), database.UpdateVideoFilesParams{
@@ -551,7 +948,22 @@ func (s *DownloaderService) StartDownload(ctx context.Context, id pgtype.UUID, u
 			FileSize:          pgtype.Int8{Int64: fileSize, Valid: fileSize > 0},
 		})
 		if err != nil {
-			log.Printf("ERROR [%s]: Failed to update video file names in database: %v\n", idStr, err)
+			logger.Error("Failed to update video file names in database", "error", err)
+		}
+
+		if spriteKey != "" {
+			if err := s.queries.UpdateVideoSprite(context.Background(), sprite.params(id, spriteKey)); err != nil {
+				logger.Warn("Failed to store sprite sheet details", "error", err)
+			}
+		}
+
+		if videoCodec != "" {
+			if err := s.queries.UpdateVideoCodec(context.Background(), database.UpdateVideoCodecParams{
+				ID:         id,
+				VideoCodec: pgtype.Text{String: videoCodec, Valid: true},
+			}); err != nil {
+				logger.Warn("Failed to store video codec", "error", err)
+			}
 		}
 
 		_, err = s.queries.UpdateVideoStatus(context.Background(), database.UpdateVideoStatusParams{
@@ -559,10 +971,12 @@ func (s *DownloaderService) StartDownload(ctx context.Context, id pgtype.UUID, u
 			DownloadStatus: string(StatusFinished),
 		})
 		if err != nil {
-			log.Printf("ERROR [%s]: Failed to update video status in database: %v\n", idStr, err)
+			logger.Error("Failed to update video status in database", "error", err)
 		}
 
-		log.Printf("SUCCESS [%s]: Video download and processing finished successfully.\n", idStr)
+		s.quota.InvalidateLibrarySize()
+		succeeded = true
+		logger.Info("Video download and processing finished successfully")
 	}()
 }
 
@@ -579,3 +993,165 @@ func getFloat(m map[string]interface{}, key string) float64 {
 	}
 	return 0
 }
+
+// jobFailure describes the step of a job that failed, as recorded in the errors table
+type jobFailure struct {
+	command string
+	message string
+	output  string
+}
+
+// runYtdlpDownload runs one yt-dlp download attempt, reporting progress and setting *extractor once yt-dlp
+// names it. It returns a non-empty reason if the download was paused for the disk limits.
+func (s *DownloaderService) runYtdlpDownload(logger *slog.Logger, id pgtype.UUID, prog *DownloadProgress, url string, opts YtdlpDownloadOptions, extractor *string) (string, *jobFailure) {
+	idStr := id.String()
+	cmd, cleanup, err := s.ytdlp.DownloadCommand(context.Background(), url, opts)
+	if err != nil {
+		return "", &jobFailure{command: "yt-dlp (credentials)", message: "Failed to prepare credentials: " + err.Error()}
+	}
+	defer cleanup()
+	logger.Debug("Executing command", "command", cmd.String())
+	fullOutput := s.beginProcessLog(idStr, cmd)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", &jobFailure{command: "yt-dlp (pipe)", message: "Failed to create stdout pipe: " + err.Error()}
+	}
+	cmd.Stderr = fullOutput
+
+	if err := cmd.Start(); err != nil {
+		s.metrics.ObserveExit("yt-dlp", err)
+		s.finishProcessLog(logger, id, fullOutput, err)
+		return "", &jobFailure{command: "yt-dlp (start)", message: "Failed to start yt-dlp: " + err.Error()}
+	}
+
+	// Pause the download if the disk limits are breached while it is running
+	pauseReason := make(chan string, 1)
+	monitorDone := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(quotaCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-monitorDone:
+				return
+			case <-ticker.C:
+				if err := s.quota.CheckDownload(context.Background(), 0); errors.Is(err, ErrQuotaExceeded) {
+					pauseReason <- err.Error()
+					cmd.Process.Kill()
+					return
+				}
+			}
+		}
+	}()
+
+	// Use TeeReader to capture stdout while scanning
+	multiReader := io.TeeReader(stdout, fullOutput)
+	scanner := bufio.NewScanner(multiReader)
+	progressRegex := regexp.MustCompile(`\[download\]\s+(\d+\.?\d*)%\s+of\s+.*\s+at\s+(.*)\s+ETA\s+(.*)`)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if *extractor == "" {
+			if m := extractorRegex.FindStringSubmatch(line); m != nil {
+				*extractor = m[1]
+				s.metrics.DownloadStarted(*extractor)
+				logger.Debug("Detected extractor", "extractor", *extractor)
+			}
+		}
+		matches := progressRegex.FindStringSubmatch(line)
+		if len(matches) == 4 {
+			percent, _ := strconv.ParseFloat(matches[1], 64)
+			prog.Update(s.ws, idStr, percent, 0, matches[2], matches[3], StatusDownloading, line)
+		} else {
+			prog.mu.Lock()
+			prog.LastOutput = line
+			prog.mu.Unlock()
+		}
+	}
+
+	err = cmd.Wait()
+	close(monitorDone)
+	s.metrics.ObserveExit("yt-dlp", err)
+	s.finishProcessLog(logger, id, fullOutput, err)
+	select {
+	case reason := <-pauseReason:
+		return reason, nil
+	default:
+	}
+	if err != nil {
+		return "", &jobFailure{command: "yt-dlp", message: fmt.Sprintf("Download failed: %v", err), output: fullOutput.String()}
+	}
+	return "", nil
+}
+
+// encodeVideo re-encodes input with ffmpeg to "<uuid>_encoded.<ext>" in the downloads directory,
+// reporting progress, and returns the path of the encoded file
+func (s *DownloaderService) encodeVideo(logger *slog.Logger, id pgtype.UUID, prog *DownloadProgress, input string, opts *EncodingOptions) (string, *jobFailure) {
+	idStr := id.String()
+	outputExt := getOutputExtension(opts.VideoCodec)
+	tempEncodePath := filepath.Join(DownloadsDir, idStr+"_encoded"+outputExt)
+
+	logger.Info("Starting ffmpeg encoding", "codec", opts.VideoCodec, "output", tempEncodePath)
+	prog.Update(s.ws, idStr, 100, 0, "", "", StatusEncoding, "Getting video duration...")
+
+	// Get duration for progress calculation
+	durationCmd := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", input)
+	durationLog := s.beginProcessLog(idStr, durationCmd)
+	durationCmd.Stdout = durationLog
+	durationCmd.Stderr = durationLog
+	err := durationCmd.Run()
+	s.metrics.ObserveExit("ffprobe", err)
+	s.finishProcessLog(logger, id, durationLog, err)
+	duration := 0.0
+	if err == nil {
+		duration, _ = strconv.ParseFloat(strings.TrimSpace(durationLog.String()), 64)
+	}
+	logger.Info("Probed video duration", "seconds", duration)
+
+	prog.Update(s.ws, idStr, 100, 0, "", "", StatusEncoding, fmt.Sprintf("Encoding with %s...", opts.VideoCodec))
+
+	encodeCmd := buildFFmpegCommand(input, tempEncodePath, opts)
+	logger.Debug("Executing command", "command", encodeCmd.String())
+	encodeOutput := s.beginProcessLog(idStr, encodeCmd)
+
+	encodeStdout, err := encodeCmd.StdoutPipe()
+	if err != nil {
+		return "", &jobFailure{command: "ffmpeg (pipe)", message: "Failed to create ffmpeg stdout pipe: " + err.Error()}
+	}
+	encodeCmd.Stderr = encodeOutput
+
+	encodeStart := time.Now()
+	if err := encodeCmd.Start(); err != nil {
+		s.metrics.ObserveExit("ffmpeg", err)
+		s.finishProcessLog(logger, id, encodeOutput, err)
+		return "", &jobFailure{command: "ffmpeg (start)", message: "Failed to start ffmpeg: " + err.Error()}
+	}
+
+	encodeScanner := bufio.NewScanner(io.TeeReader(encodeStdout, encodeOutput))
+	for encodeScanner.Scan() {
+		line := encodeScanner.Text()
+		if after, ok := strings.CutPrefix(line, "out_time_ms="); ok {
+			timeUsStr := after
+			timeUs, _ := strconv.ParseFloat(timeUsStr, 64)
+			if duration > 0 {
+				encodingPercent := (timeUs / 1000000.0 / duration) * 100.0
+				if encodingPercent > 100 {
+					encodingPercent = 100
+				}
+				prog.Update(s.ws, idStr, 100, encodingPercent, "", "", StatusEncoding, "Encoding in progress...")
+			}
+		}
+	}
+
+	err = encodeCmd.Wait()
+	s.metrics.ObserveExit("ffmpeg", err)
+	s.finishProcessLog(logger, id, encodeOutput, err)
+	if err != nil {
+		os.Remove(tempEncodePath) // Clean up partial encoded file
+		return "", &jobFailure{command: "ffmpeg", message: fmt.Sprintf("Encoding failed: %v", err), output: encodeOutput.String()}
+	}
+
+	s.metrics.ObserveEncode(opts.VideoCodec, time.Since(encodeStart).Seconds())
+	return tempEncodePath, nil
+}
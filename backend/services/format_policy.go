@@ -0,0 +1,168 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultFormatSelector is used when a download has neither a format ID nor a format policy
+const defaultFormatSelector = "bestvideo+bestaudio/best"
+
+// formatCodecs maps the video codec names of a format policy to a regex on yt-dlp's vcodec field
+var formatCodecs = map[string]string{
+	"av1":  "^av0?1",
+	"vp9":  "^vp0?9",
+	"h265": "^(hev|hvc|h265)",
+	"h264": "^(avc|h264)",
+}
+
+// formatSizeRegex matches a file size with an optional K, M or G suffix: 500M, 2G, 1.5G, ...
+var formatSizeRegex = regexp.MustCompile(`^\d+(\.\d+)?[KkMmGg]?$`)
+
+// formatSizeUnits are the multipliers of the size suffixes. yt-dlp's format filters read "2G" as 2GB,
+// so they are decimal.
+var formatSizeUnits = map[byte]float64{'K': 1e3, 'M': 1e6, 'G': 1e9}
+
+// FormatPolicy describes which format to download instead of naming a format ID. Limits are hard: if no
+// format satisfies them the download fails. Preferences only order the formats that do.
+type FormatPolicy struct {
+	MaxHeight     int      `json:"maxHeight,omitempty"`     // e.g. 1080; 0 for no limit
+	Codecs        []string `json:"codecs,omitempty"`        // preferred video codecs, best first: av1, vp9, h265, h264; others are used when none is available
+	PreferHighFPS bool     `json:"preferHighFps,omitempty"` // prefer formats above 30fps, even over the codec preference
+	MaxSize       string   `json:"maxSize,omitempty"`       // e.g. 2G for video and audio together; downloads of unknown size are allowed
+	AudioOnly     bool     `json:"audioOnly,omitempty"`     // download only the best audio stream
+}
+
+func parseFormatPolicy(raw []byte) FormatPolicy {
+	var policy FormatPolicy
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &policy); err != nil {
+			slog.Warn("Failed to parse format policy", "error", err)
+		}
+	}
+	return policy
+}
+
+// IsZero reports whether the policy sets nothing, in which case yt-dlp picks the best format
+func (p FormatPolicy) IsZero() bool {
+	return p.MaxHeight == 0 && len(p.Codecs) == 0 && !p.PreferHighFPS && p.MaxSize == "" && !p.AudioOnly
+}
+
+// ValidateFormatPolicy checks the limits and codec names of a format policy
+func ValidateFormatPolicy(p FormatPolicy) error {
+	if p.MaxHeight < 0 {
+		return fmt.Errorf("invalid format policy: maxHeight must not be negative")
+	}
+	if p.MaxSize != "" && !formatSizeRegex.MatchString(p.MaxSize) {
+		return fmt.Errorf("invalid format policy: maxSize %q must be a size with an optional K, M or G suffix, e.g. 2G", p.MaxSize)
+	}
+	seen := map[string]bool{}
+	for _, codec := range p.Codecs {
+		if _, ok := formatCodecs[codec]; !ok {
+			return fmt.Errorf("invalid format policy: unknown codec %q, must be av1, vp9, h265 or h264", codec)
+		}
+		if seen[codec] {
+			return fmt.Errorf("invalid format policy: codec %q is listed twice", codec)
+		}
+		seen[codec] = true
+	}
+	if p.AudioOnly && (p.MaxHeight > 0 || len(p.Codecs) > 0 || p.PreferHighFPS) {
+		return fmt.Errorf("invalid format policy: audioOnly cannot be combined with video limits or preferences")
+	}
+	return nil
+}
+
+// Compile turns the policy into a yt-dlp format selector for -f and a format sort for -S, which is empty if
+// yt-dlp's default order should be used. The selector tries the preferred codecs in order, high frame rate
+// formats first if preferred, before falling back to any codec; within each the highest resolution up to MaxHeight wins.
+func (p FormatPolicy) Compile() (selector, sort string) {
+	sizeFilter := ""
+	if p.MaxSize != "" {
+		// yt-dlp filters single formats, so this only drops streams that are too big on their own. The
+		// merged total is checked against yt-dlp's estimate before the download starts.
+		size := strings.ToUpper(p.MaxSize)
+		sizeFilter = "[filesize<?" + size + "][filesize_approx<?" + size + "]"
+	}
+	if p.AudioOnly {
+		return "ba" + sizeFilter, ""
+	}
+	filters := sizeFilter
+	if p.MaxHeight > 0 {
+		filters += "[height<=?" + strconv.Itoa(p.MaxHeight) + "]"
+		sort = "res:" + strconv.Itoa(p.MaxHeight)
+	}
+
+	var codecs []string
+	for _, codec := range p.Codecs {
+		codecs = append(codecs, "[vcodec~='"+formatCodecs[codec]+"']")
+	}
+	codecs = append(codecs, "")
+
+	var variants []string
+	if p.PreferHighFPS {
+		for _, codec := range codecs {
+			variants = append(variants, codec+"[fps>30]")
+		}
+	}
+	variants = append(variants, codecs...)
+
+	alternatives := make([]string, 0, 2*len(variants))
+	for _, variant := range variants {
+		alternatives = append(alternatives, "bv*"+variant+filters+"+ba"+sizeFilter, "b"+variant+filters)
+	}
+	return strings.Join(alternatives, "/"), sort
+}
+
+// CompileFormatPolicy compiles a policy, or returns the default selection for an empty one
+func CompileFormatPolicy(p FormatPolicy) (selector, sort string) {
+	if p.IsZero() {
+		return defaultFormatSelector, ""
+	}
+	return p.Compile()
+}
+
+// formatIDSelector selects a format ID chosen from VideoMetadata.Options. A video-only format is merged
+// with the best audio; combined and audio-only formats are downloaded as they are. A full selector such
+// as 137+140 is passed through.
+func formatIDSelector(formatID string) string {
+	if strings.ContainsAny(formatID, "+/,[]()") {
+		return formatID
+	}
+	return formatID + "[vcodec!=none][acodec=none]+ba/" + formatID
+}
+
+// parseFormatSize returns the size in bytes of a size validated by ValidateFormatPolicy
+func parseFormatSize(size string) int64 {
+	multiplier := 1.0
+	if unit, ok := formatSizeUnits[strings.ToUpper(size[len(size)-1:])[0]]; ok {
+		multiplier = unit
+		size = size[:len(size)-1]
+	}
+	n, _ := strconv.ParseFloat(size, 64)
+	return int64(n * multiplier)
+}
+
+// requestFormatPolicy returns the policy a download uses: its own, else the default policy from the
+// settings. Downloads of a format ID have none.
+func requestFormatPolicy(req DownloadRequest, defaultPolicy FormatPolicy) FormatPolicy {
+	if req.FormatID != "" {
+		return FormatPolicy{}
+	}
+	if req.FormatPolicy != nil {
+		return *req.FormatPolicy
+	}
+	return defaultPolicy
+}
+
+// formatSelection picks the yt-dlp format selector and sort for a download: its format ID, else its format
+// policy, else the default policy from the settings
+func formatSelection(req DownloadRequest, defaultPolicy FormatPolicy) (selector, sort string) {
+	if req.FormatID != "" {
+		return formatIDSelector(req.FormatID), ""
+	}
+	return CompileFormatPolicy(requestFormatPolicy(req, defaultPolicy))
+}
@@ -0,0 +1,157 @@
+package services
+
+import "testing"
+
+func TestFormatPolicyCompile(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       FormatPolicy
+		wantSelector string
+		wantSort     string
+	}{
+		{
+			name:         "max height",
+			policy:       FormatPolicy{MaxHeight: 1080},
+			wantSelector: "bv*[height<=?1080]+ba/b[height<=?1080]",
+			wantSort:     "res:1080",
+		},
+		{
+			name:         "codecs in order, then any codec",
+			policy:       FormatPolicy{Codecs: []string{"av1", "h264"}},
+			wantSelector: "bv*[vcodec~='^av0?1']+ba/b[vcodec~='^av0?1']/bv*[vcodec~='^(avc|h264)']+ba/b[vcodec~='^(avc|h264)']/bv*+ba/b",
+		},
+		{
+			name:         "high frame rate first",
+			policy:       FormatPolicy{PreferHighFPS: true},
+			wantSelector: "bv*[fps>30]+ba/b[fps>30]/bv*+ba/b",
+		},
+		{
+			name:         "size limits video and audio streams",
+			policy:       FormatPolicy{MaxSize: "2g"},
+			wantSelector: "bv*[filesize<?2G][filesize_approx<?2G]+ba[filesize<?2G][filesize_approx<?2G]/b[filesize<?2G][filesize_approx<?2G]",
+		},
+		{
+			name:         "audio only",
+			policy:       FormatPolicy{AudioOnly: true, MaxSize: "100M"},
+			wantSelector: "ba[filesize<?100M][filesize_approx<?100M]",
+		},
+		{
+			name:   "frame rate before codec, limits on every alternative",
+			policy: FormatPolicy{MaxHeight: 720, Codecs: []string{"vp9"}, PreferHighFPS: true},
+			wantSelector: "bv*[vcodec~='^vp0?9'][fps>30][height<=?720]+ba/b[vcodec~='^vp0?9'][fps>30][height<=?720]/" +
+				"bv*[fps>30][height<=?720]+ba/b[fps>30][height<=?720]/" +
+				"bv*[vcodec~='^vp0?9'][height<=?720]+ba/b[vcodec~='^vp0?9'][height<=?720]/" +
+				"bv*[height<=?720]+ba/b[height<=?720]",
+			wantSort: "res:720",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, sort := tt.policy.Compile()
+			if selector != tt.wantSelector {
+				t.Errorf("selector = %q, want %q", selector, tt.wantSelector)
+			}
+			if sort != tt.wantSort {
+				t.Errorf("sort = %q, want %q", sort, tt.wantSort)
+			}
+		})
+	}
+}
+
+func TestCompileFormatPolicyEmpty(t *testing.T) {
+	selector, sort := CompileFormatPolicy(FormatPolicy{})
+	if selector != defaultFormatSelector || sort != "" {
+		t.Errorf("CompileFormatPolicy(empty) = %q, %q, want %q, \"\"", selector, sort, defaultFormatSelector)
+	}
+}
+
+func TestValidateFormatPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  FormatPolicy
+		wantErr bool
+	}{
+		{"empty", FormatPolicy{}, false},
+		{"full video policy", FormatPolicy{MaxHeight: 1080, Codecs: []string{"av1", "vp9", "h265", "h264"}, PreferHighFPS: true, MaxSize: "1.5G"}, false},
+		{"audio only with size", FormatPolicy{AudioOnly: true, MaxSize: "500k"}, false},
+		{"size in bytes", FormatPolicy{MaxSize: "1048576"}, false},
+		{"negative height", FormatPolicy{MaxHeight: -1}, true},
+		{"size with unit word", FormatPolicy{MaxSize: "2GB"}, true},
+		{"size with selector syntax", FormatPolicy{MaxSize: "2G]/b"}, true},
+		{"unknown codec", FormatPolicy{Codecs: []string{"mpeg2"}}, true},
+		{"codec listed twice", FormatPolicy{Codecs: []string{"vp9", "vp9"}}, true},
+		{"audio only with height", FormatPolicy{AudioOnly: true, MaxHeight: 720}, true},
+		{"audio only with codecs", FormatPolicy{AudioOnly: true, Codecs: []string{"av1"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateFormatPolicy(tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateFormatPolicy(%+v) = %v, want error: %v", tt.policy, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFormatIDSelector(t *testing.T) {
+	tests := []struct {
+		formatID string
+		want     string
+	}{
+		{"137", "137[vcodec!=none][acodec=none]+ba/137"},
+		{"hls-1080p", "hls-1080p[vcodec!=none][acodec=none]+ba/hls-1080p"},
+		{"137+140", "137+140"},
+		{"137/best", "137/best"},
+		{"bv*[height<=720]", "bv*[height<=720]"},
+		{"(137,140)", "(137,140)"},
+	}
+
+	for _, tt := range tests {
+		if got := formatIDSelector(tt.formatID); got != tt.want {
+			t.Errorf("formatIDSelector(%q) = %q, want %q", tt.formatID, got, tt.want)
+		}
+	}
+}
+
+func TestFormatSelection(t *testing.T) {
+	defaultPolicy := FormatPolicy{MaxHeight: 480}
+	tests := []struct {
+		name         string
+		req          DownloadRequest
+		wantSelector string
+	}{
+		{"format ID wins", DownloadRequest{FormatID: "22", FormatPolicy: &FormatPolicy{AudioOnly: true}}, "22[vcodec!=none][acodec=none]+ba/22"},
+		{"request policy", DownloadRequest{FormatPolicy: &FormatPolicy{AudioOnly: true}}, "ba"},
+		{"empty request policy ignores the default", DownloadRequest{FormatPolicy: &FormatPolicy{}}, defaultFormatSelector},
+		{"settings default", DownloadRequest{}, "bv*[height<=?480]+ba/b[height<=?480]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if selector, _ := formatSelection(tt.req, defaultPolicy); selector != tt.wantSelector {
+				t.Errorf("selector = %q, want %q", selector, tt.wantSelector)
+			}
+		})
+	}
+}
+
+func TestParseFormatSize(t *testing.T) {
+	tests := []struct {
+		size string
+		want int64
+	}{
+		{"1048576", 1048576},
+		{"500k", 500_000},
+		{"1.5G", 1_500_000_000},
+		{"2g", 2_000_000_000},
+		{"100M", 100_000_000},
+	}
+
+	for _, tt := range tests {
+		if got := parseFormatSize(tt.size); got != tt.want {
+			t.Errorf("parseFormatSize(%q) = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
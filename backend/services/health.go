@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azmekk/Vidra/backend/utils"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	HealthStatusOK   = "ok"
+	HealthStatusFail = "fail"
+
+	// minReadyFreeBytes is the free space below which the downloads directory is reported as not ready
+	minReadyFreeBytes = 100 * 1024 * 1024
+	// versionCacheTTL avoids spawning yt-dlp/ffmpeg on every readiness probe
+	versionCacheTTL = 5 * time.Minute
+	// readinessReuseTTL is how long Status reuses the result of the last readiness check
+	readinessReuseTTL = time.Minute
+	checkTimeout      = 5 * time.Second
+)
+
+type HealthCheckDTO struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+type ReadinessDTO struct {
+	Status string           `json:"status"`
+	Checks []HealthCheckDTO `json:"checks"`
+}
+
+type cachedVersion struct {
+	path      string
+	version   string
+	checkedAt time.Time
+}
+
+type HealthService struct {
+	pool *pgxpool.Pool
+	ws   *WebSocketService
+
+	mu          sync.Mutex
+	versions    map[string]cachedVersion
+	lastStatus  string
+	lastCheckAt time.Time
+}
+
+func NewHealthService(pool *pgxpool.Pool, ws *WebSocketService) *HealthService {
+	return &HealthService{
+		pool:     pool,
+		ws:       ws,
+		versions: make(map[string]cachedVersion),
+	}
+}
+
+// CheckReadiness runs all dependency checks. The overall status is ok only if every check passes.
+func (s *HealthService) CheckReadiness(ctx context.Context) ReadinessDTO {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	checks := []HealthCheckDTO{
+		s.checkDatabase(ctx),
+		s.checkBinary(ctx, "yt-dlp", "--version"),
+		s.checkBinary(ctx, "ffmpeg", "-version"),
+		s.checkBinary(ctx, "ffprobe", "-version"),
+		s.checkDownloadsDir(),
+		s.checkWebSocketHub(ctx),
+	}
+
+	status := HealthStatusOK
+	for _, c := range checks {
+		if c.Status != HealthStatusOK {
+			status = HealthStatusFail
+			break
+		}
+	}
+
+	s.mu.Lock()
+	s.lastStatus, s.lastCheckAt = status, time.Now()
+	s.mu.Unlock()
+
+	return ReadinessDTO{Status: status, Checks: checks}
+}
+
+// Status returns the result of the last readiness check if it is recent, and otherwise only pings the
+// database. Unlike CheckReadiness it runs no binaries and writes no files.
+func (s *HealthService) Status(ctx context.Context) string {
+	s.mu.Lock()
+	status, checkedAt := s.lastStatus, s.lastCheckAt
+	s.mu.Unlock()
+	if time.Since(checkedAt) < readinessReuseTTL {
+		return status
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	return s.checkDatabase(ctx).Status
+}
+
+func (s *HealthService) checkDatabase(ctx context.Context) HealthCheckDTO {
+	check := HealthCheckDTO{Name: "database", Status: HealthStatusOK}
+	if err := s.pool.Ping(ctx); err != nil {
+		check.Status = HealthStatusFail
+		check.Message = err.Error()
+	}
+	return check
+}
+
+func (s *HealthService) checkBinary(ctx context.Context, name string, versionFlag string) HealthCheckDTO {
+	check := HealthCheckDTO{Name: name, Status: HealthStatusOK}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		check.Status = HealthStatusFail
+		check.Message = fmt.Sprintf("%s not found in PATH", name)
+		return check
+	}
+
+	s.mu.Lock()
+	cached, ok := s.versions[name]
+	s.mu.Unlock()
+	if ok && cached.path == path && time.Since(cached.checkedAt) < versionCacheTTL {
+		check.Version = cached.version
+		return check
+	}
+
+	output, err := exec.CommandContext(ctx, path, versionFlag).Output()
+	if err != nil {
+		check.Status = HealthStatusFail
+		check.Message = fmt.Sprintf("failed to run %s %s: %v", name, versionFlag, err)
+		return check
+	}
+	check.Version = parseVersion(string(output))
+
+	s.mu.Lock()
+	s.versions[name] = cachedVersion{path: path, version: check.Version, checkedAt: time.Now()}
+	s.mu.Unlock()
+
+	return check
+}
+
+// parseVersion extracts the version from "yt-dlp --version" ("2025.01.15") or
+// "ffmpeg -version" ("ffmpeg version 7.1 Copyright ...") output
+func parseVersion(output string) string {
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	fields := strings.Fields(firstLine)
+	if len(fields) >= 3 && fields[1] == "version" {
+		return fields[2]
+	}
+	return strings.TrimSpace(firstLine)
+}
+
+func (s *HealthService) checkDownloadsDir() HealthCheckDTO {
+	check := HealthCheckDTO{Name: "downloads", Status: HealthStatusOK}
+
+	probe, err := os.CreateTemp(DownloadsDir, ".readyz-*")
+	if err != nil {
+		check.Status = HealthStatusFail
+		check.Message = fmt.Sprintf("downloads directory is not writable: %v", err)
+		return check
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	free, _, err := utils.GetDiskSpace(DownloadsDir)
+	if err != nil {
+		check.Status = HealthStatusFail
+		check.Message = fmt.Sprintf("failed to read free space: %v", err)
+		return check
+	}
+	check.Message = fmt.Sprintf("%d bytes free", free)
+	if free < minReadyFreeBytes {
+		check.Status = HealthStatusFail
+	}
+	return check
+}
+
+func (s *HealthService) checkWebSocketHub(ctx context.Context) HealthCheckDTO {
+	check := HealthCheckDTO{Name: "websocket", Status: HealthStatusOK}
+	if !s.ws.Alive(ctx) {
+		check.Status = HealthStatusFail
+		check.Message = "WebSocket hub is not responding"
+	}
+	return check
+}
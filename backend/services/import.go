@@ -0,0 +1,488 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	ImportModeMove = "move"
+	ImportModeLink = "link" // hard link, the source file is left in place
+
+	ImportResultImported = "imported"
+	ImportResultFailed   = "failed"
+
+	// ImportDropDir is watched for new files, which are imported with ImportModeMove
+	ImportDropDir      = DownloadsDir + "/import"
+	importDropPrefix   = "import/"
+	importScanInterval = time.Minute
+	// importSettleTime skips files that were modified recently and may still be copied into place
+	importSettleTime = 30 * time.Second
+)
+
+// StatusImporting is a video row created by an import whose file is still being processed
+const StatusImporting DownloadStatus = "importing"
+
+// ErrImportRunning is returned when an import is started while another one is in progress
+var ErrImportRunning = errors.New("an import is already running")
+
+var importVideoExtensions = map[string]bool{
+	".mp4": true, ".mkv": true, ".webm": true, ".mov": true, ".avi": true,
+	".m4v": true, ".flv": true, ".wmv": true, ".mpg": true, ".mpeg": true, ".ts": true,
+}
+
+type ImportResultDTO struct {
+	Path    string `json:"path"`
+	Status  string `json:"status"`
+	VideoID string `json:"videoId,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type ImportStatusDTO struct {
+	Running    bool              `json:"running"`
+	Directory  string            `json:"directory"`
+	Mode       string            `json:"mode"`
+	StartedAt  string            `json:"startedAt,omitempty"`
+	FinishedAt string            `json:"finishedAt,omitempty"`
+	Results    []ImportResultDTO `json:"results"`
+}
+
+type ImportService struct {
+	queries    *database.Queries
+	quota      *QuotaService
+	metrics    *MetricsService
+	storage    Storage
+	layout     *LibraryLayout
+	onImported func(database.Video)
+
+	mu     sync.Mutex
+	status ImportStatusDTO
+}
+
+// NewImportService creates the import service. onImported is called for every video row created by an import.
+func NewImportService(queries *database.Queries, quota *QuotaService, metrics *MetricsService, storage Storage, layout *LibraryLayout, onImported func(database.Video)) *ImportService {
+	return &ImportService{
+		queries:    queries,
+		quota:      quota,
+		metrics:    metrics,
+		storage:    storage,
+		layout:     layout,
+		onImported: onImported,
+		status:     ImportStatusDTO{Results: []ImportResultDTO{}},
+	}
+}
+
+// GetStatus returns the state of the current or last import
+func (s *ImportService) GetStatus() ImportStatusDTO {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status
+	status.Results = append([]ImportResultDTO{}, s.status.Results...)
+	return status
+}
+
+// Running reports whether an import is in progress
+func (s *ImportService) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status.Running
+}
+
+// Start imports every video file under dir in the background. Directories inside the managed
+// downloads directory are refused, except for the import drop directory.
+func (s *ImportService) Start(dir string, mode string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("directory not found: %s", dir)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory: %s", dir)
+	}
+	if isWithin(dir, DownloadsDir) && !isWithin(dir, ImportDropDir) {
+		return fmt.Errorf("cannot import from the downloads directory")
+	}
+
+	s.mu.Lock()
+	if s.status.Running {
+		s.mu.Unlock()
+		return ErrImportRunning
+	}
+	s.status = ImportStatusDTO{
+		Running:   true,
+		Directory: dir,
+		Mode:      mode,
+		StartedAt: time.Now().Format(time.RFC3339),
+		Results:   []ImportResultDTO{},
+	}
+	s.mu.Unlock()
+
+	go s.run(dir, mode)
+	return nil
+}
+
+// Run watches the import drop directory and imports files placed there
+func (s *ImportService) Run() {
+	if err := os.MkdirAll(ImportDropDir, 0755); err != nil {
+		slog.Error("Failed to create import directory", "path", ImportDropDir, "error", err)
+		return
+	}
+
+	ticker := time.NewTicker(importScanInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !s.hasPendingFiles(ImportDropDir) {
+			continue
+		}
+		if err := s.Start(ImportDropDir, ImportModeMove); err != nil && !errors.Is(err, ErrImportRunning) {
+			slog.Warn("Failed to start import from drop directory", "error", err)
+		}
+	}
+}
+
+func (s *ImportService) hasPendingFiles(dir string) bool {
+	found := false
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if s.isImportable(d) {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found
+}
+
+func (s *ImportService) isImportable(d fs.DirEntry) bool {
+	if !importVideoExtensions[strings.ToLower(filepath.Ext(d.Name()))] {
+		return false
+	}
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	return time.Since(info.ModTime()) >= importSettleTime
+}
+
+func (s *ImportService) run(dir string, mode string) {
+	slog.Info("Starting import", "directory", dir, "mode", mode)
+
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() && s.isImportable(d) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to scan import directory", "directory", dir, "error", err)
+	}
+
+	for _, path := range paths {
+		result := s.importFile(context.Background(), path, mode)
+		if result.Status == ImportResultFailed {
+			slog.Warn("Failed to import file", "path", path, "error", result.Message)
+		} else {
+			slog.Info("Imported file", "path", path, "video_id", result.VideoID)
+		}
+
+		s.mu.Lock()
+		s.status.Results = append(s.status.Results, result)
+		s.mu.Unlock()
+	}
+
+	s.quota.InvalidateLibrarySize()
+
+	s.mu.Lock()
+	s.status.Running = false
+	s.status.FinishedAt = time.Now().Format(time.RFC3339)
+	s.mu.Unlock()
+
+	slog.Info("Import finished", "directory", dir, "files", len(paths))
+}
+
+func (s *ImportService) importFile(ctx context.Context, path string, mode string) ImportResultDTO {
+	result := ImportResultDTO{Path: path, Status: ImportResultFailed}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	if err := s.quota.CheckDownload(ctx, info.Size()); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	duration, codec, err := s.probeVideo(ctx, path)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	sourceBase := strings.TrimSuffix(path, filepath.Ext(path))
+	name := filepath.Base(sourceBase)
+	sidecar, err := ReadInfoJSON(sourceBase + ".info.json")
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("Failed to parse info.json sidecar", "path", sourceBase+".info.json", "error", err)
+		}
+		sidecar = &YtdlpInfo{}
+	}
+	if sidecar.Title != "" {
+		name = sidecar.Title
+	}
+
+	// The row is created first so the template can use the video's {uuid}
+	video, err := s.queries.CreateVideo(ctx, database.CreateVideoParams{
+		Name:           name,
+		OriginalUrl:    sidecar.WebpageURL,
+		DownloadStatus: string(StatusImporting),
+	})
+	if err != nil {
+		result.Message = "failed to create video record: " + err.Error()
+		return result
+	}
+	fail := func(message string) ImportResultDTO {
+		if err := s.queries.DeleteVideo(ctx, video.ID); err != nil {
+			slog.Error("Failed to remove video record of failed import", "video_id", video.ID.String(), "error", err)
+		}
+		result.Message = message
+		return result
+	}
+
+	if duration == 0 {
+		duration = sidecar.Duration
+	}
+	if _, err := s.queries.UpdateVideoMetadata(ctx, database.UpdateVideoMetadataParams{
+		ID:          video.ID,
+		ExternalID:  pgtype.Text{String: sidecar.ID, Valid: sidecar.ID != ""},
+		Uploader:    pgtype.Text{String: sidecar.Uploader, Valid: sidecar.Uploader != ""},
+		UploadDate:  sidecar.UploadDateValue(),
+		Extractor:   pgtype.Text{String: sidecar.Extractor, Valid: sidecar.Extractor != ""},
+		Description: pgtype.Text{String: sidecar.Description, Valid: sidecar.Description != ""},
+		Duration:    pgtype.Float8{Float64: duration, Valid: duration > 0},
+	}); err != nil {
+		return fail("failed to store metadata: " + err.Error())
+	}
+	if codec != "" {
+		if err := s.queries.UpdateVideoCodec(ctx, database.UpdateVideoCodecParams{
+			ID:         video.ID,
+			VideoCodec: pgtype.Text{String: codec, Valid: true},
+		}); err != nil {
+			slog.Warn("Failed to store video codec", "path", path, "error", err)
+		}
+	}
+
+	// Subtitle sidecars are only indexed for search, the files are left where they are
+	if text := ReadSubtitleText(FindSubtitleFiles(sourceBase)); text != "" {
+		if err := s.queries.SetVideoSubtitles(ctx, database.SetVideoSubtitlesParams{
+			VideoID:      video.ID,
+			SubtitleText: text,
+		}); err != nil {
+			slog.Warn("Failed to store subtitle text", "path", path, "error", err)
+		}
+	}
+
+	// Stage the file under a hidden name in the downloads directory, then hand it to storage
+	stagedPath := filepath.Join(DownloadsDir, ".import-"+video.ID.String()+ext)
+	if err := placeFile(path, stagedPath, mode); err != nil {
+		return fail(fmt.Sprintf("failed to %s file: %v", mode, err))
+	}
+
+	if _, err := recordMediaInfo(ctx, s.queries, s.metrics, video.ID, stagedPath); err != nil {
+		slog.Warn("Failed to record media info", "path", path, "error", err)
+	}
+
+	stagedThumbnail := filepath.Join(DownloadsDir, ".import-"+video.ID.String()+".jpg")
+	hasThumbnail := true
+	if err := generateThumbnail(ctx, s.metrics, stagedPath, stagedThumbnail, duration); err != nil {
+		slog.Warn("Failed to generate thumbnail", "path", path, "error", err)
+		hasThumbnail = false
+	}
+	stagedSprite := filepath.Join(DownloadsDir, ".import-"+video.ID.String()+spriteSuffix)
+	sprite, spriteErr := generateSprite(ctx, s.metrics, stagedPath, stagedSprite, duration)
+	if spriteErr != nil {
+		slog.Warn("Failed to generate sprite sheet", "path", path, "error", spriteErr)
+	}
+
+	meta := LayoutMetadata{
+		Title:      name,
+		ID:         sidecar.ID,
+		Uploader:   sidecar.Uploader,
+		UploadDate: sidecar.UploadDate,
+		Extractor:  sidecar.Extractor,
+		UUID:       video.ID.String(),
+	}
+	fileName, thumbnailName, release := s.layout.Reserve(ctx, meta, strings.TrimPrefix(ext, "."))
+	defer release()
+
+	if err := s.storage.Put(ctx, fileName, stagedPath); err != nil {
+		// Give a moved file back to its source so nothing is lost
+		if mode == ImportModeMove {
+			placeFile(stagedPath, path, ImportModeMove)
+		} else {
+			os.Remove(stagedPath)
+		}
+		os.Remove(stagedThumbnail)
+		os.Remove(stagedSprite)
+		return fail("failed to store file: " + err.Error())
+	}
+	if mode == ImportModeMove {
+		os.Remove(sourceBase + ".info.json")
+	}
+	if hasThumbnail {
+		if err := s.storage.Put(ctx, thumbnailName, stagedThumbnail); err != nil {
+			slog.Warn("Failed to store thumbnail", "path", stagedThumbnail, "error", err)
+			os.Remove(stagedThumbnail)
+			hasThumbnail = false
+		}
+	}
+	if !hasThumbnail {
+		thumbnailName = ""
+	}
+	if spriteErr == nil {
+		spriteKey, releaseSprite := s.layout.ReserveKey(ctx, SpriteKey(fileName))
+		defer releaseSprite()
+		if err := s.storage.Put(ctx, spriteKey, stagedSprite); err != nil {
+			slog.Warn("Failed to store sprite sheet", "path", stagedSprite, "error", err)
+			os.Remove(stagedSprite)
+		} else if err := s.queries.UpdateVideoSprite(ctx, sprite.params(video.ID, spriteKey)); err != nil {
+			slog.Warn("Failed to store sprite sheet details", "video_id", video.ID.String(), "error", err)
+		}
+	}
+
+	if _, err := s.queries.UpdateVideoFiles(ctx, database.UpdateVideoFilesParams{
+		ID:                video.ID,
+		FileName:          pgtype.Text{String: fileName, Valid: true},
+		ThumbnailFileName: pgtype.Text{String: thumbnailName, Valid: thumbnailName != ""},
+		FileSize:          pgtype.Int8{Int64: info.Size(), Valid: true},
+	}); err != nil {
+		slog.Error("Failed to record files of imported video", "video_id", video.ID.String(), "error", err)
+	}
+	if completed, err := s.queries.UpdateVideoStatus(ctx, database.UpdateVideoStatusParams{
+		ID:             video.ID,
+		DownloadStatus: string(StatusFinished),
+	}); err != nil {
+		slog.Error("Failed to complete imported video", "video_id", video.ID.String(), "error", err)
+	} else {
+		video = completed
+	}
+
+	if s.onImported != nil {
+		s.onImported(video)
+	}
+
+	result.Status = ImportResultImported
+	result.VideoID = video.ID.String()
+	return result
+}
+
+// probeVideo verifies with ffprobe that the file contains a video stream and returns its duration in seconds
+// and the codec of the video stream
+func (s *ImportService) probeVideo(ctx context.Context, path string) (float64, string, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error",
+		"-show_entries", "format=duration:stream=codec_type,codec_name", "-of", "json", path)
+	output, err := cmd.Output()
+	s.metrics.ObserveExit("ffprobe", err)
+	if err != nil {
+		return 0, "", fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	var probe struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			CodecName string `json:"codec_name"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return 0, "", fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	hasVideo := false
+	codec := ""
+	for _, stream := range probe.Streams {
+		if stream.CodecType == "video" {
+			hasVideo = true
+			codec = NormalizeVideoCodec(stream.CodecName)
+			break
+		}
+	}
+	if !hasVideo {
+		return 0, "", fmt.Errorf("no video stream found")
+	}
+
+	duration, _ := strconv.ParseFloat(probe.Format.Duration, 64)
+	return duration, codec, nil
+}
+
+// placeFile moves or hard links src to dst. A move across filesystems falls back to copy and delete.
+func placeFile(src, dst, mode string) error {
+	if mode == ImportModeLink {
+		return os.Link(src, dst)
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := copyFile(src, dst); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// isWithin reports whether path is dir or inside it
+func isWithin(path, dir string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os/exec"
+	"sync"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// JobLogEntry is the captured output of a single process run by a download job
+type JobLogEntry struct {
+	Command  string `json:"command"`
+	Output   string `json:"output"`
+	ExitCode *int   `json:"exitCode"` // nil while the process is still running
+}
+
+// processLog is a concurrency-safe buffer for the combined stdout/stderr of a running process
+type processLog struct {
+	mu      sync.Mutex
+	command string
+	buf     bytes.Buffer
+}
+
+func (l *processLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(p)
+}
+
+func (l *processLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.String()
+}
+
+// beginProcessLog starts capturing output for a job's process so it can be read while still running
+func (s *DownloaderService) beginProcessLog(id string, cmd *exec.Cmd) *processLog {
+	l := &processLog{command: cmd.Args[0]}
+	s.liveLogs.Store(id, l)
+	return l
+}
+
+// finishProcessLog persists a finished process's output for the job
+func (s *DownloaderService) finishProcessLog(logger *slog.Logger, id pgtype.UUID, l *processLog, err error) {
+	s.liveLogs.Delete(id.String())
+	if _, dbErr := s.queries.CreateVideoLog(context.Background(), database.CreateVideoLogParams{
+		VideoID:  id,
+		Command:  l.command,
+		Output:   l.String(),
+		ExitCode: int32(exitCode(err)),
+	}); dbErr != nil {
+		logger.Error("Failed to persist process log", "command", l.command, "error", dbErr)
+	}
+}
+
+// GetLiveLog returns the output captured so far for the job's currently running process
+func (s *DownloaderService) GetLiveLog(id string) (JobLogEntry, bool) {
+	val, ok := s.liveLogs.Load(id)
+	if !ok {
+		return JobLogEntry{}, false
+	}
+	l := val.(*processLog)
+	return JobLogEntry{Command: l.command, Output: l.String()}, true
+}
@@ -0,0 +1,468 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/Azmekk/Vidra/backend/utils"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	DefaultFilenameTemplate = "{title}.{ext}"
+
+	// missingFieldValue replaces template fields without a value, like yt-dlp does
+	missingFieldValue = "NA"
+	maxTemplateDepth  = 5
+)
+
+var templateFieldRegex = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+var templateFields = map[string]bool{
+	"title": true, "id": true, "uploader": true, "upload_date": true,
+	"extractor": true, "uuid": true, "ext": true,
+}
+
+// LayoutMetadata holds the values available to filename templates
+type LayoutMetadata struct {
+	Title      string
+	ID         string // the site's video ID
+	Uploader   string
+	UploadDate string // YYYYMMDD
+	Extractor  string
+	UUID       string // the Vidra video ID
+}
+
+// fieldValues maps template field names to their values
+func (meta LayoutMetadata) fieldValues() map[string]string {
+	return map[string]string{
+		"title":       meta.Title,
+		"id":          meta.ID,
+		"uploader":    meta.Uploader,
+		"upload_date": meta.UploadDate,
+		"extractor":   meta.Extractor,
+		"uuid":        meta.UUID,
+	}
+}
+
+// LayoutMetadataFromVideo builds the template values stored on a video row
+func LayoutMetadataFromVideo(v database.Video) LayoutMetadata {
+	meta := LayoutMetadata{
+		Title:     v.Name,
+		ID:        v.ExternalID.String,
+		Uploader:  v.Uploader.String,
+		Extractor: v.Extractor.String,
+		UUID:      v.ID.String(),
+	}
+	if v.UploadDate.Valid {
+		meta.UploadDate = v.UploadDate.Time.Format("20060102")
+	}
+	return meta
+}
+
+// ValidateFilenameTemplate checks that a template only uses known fields, ends with ".{ext}"
+// and stays inside the library
+func ValidateFilenameTemplate(template string) error {
+	if !strings.HasSuffix(template, ".{ext}") {
+		return fmt.Errorf("filename template must end with .{ext}")
+	}
+	if strings.HasPrefix(template, "/") || strings.Contains(template, "\\") {
+		return fmt.Errorf("filename template must be a relative path using / as separator")
+	}
+	segments := strings.Split(template, "/")
+	if len(segments) > maxTemplateDepth {
+		return fmt.Errorf("filename template can have at most %d levels", maxTemplateDepth)
+	}
+	for _, segment := range segments {
+		if strings.TrimSpace(segment) == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("filename template has an empty or relative path segment")
+		}
+	}
+	for _, m := range templateFieldRegex.FindAllStringSubmatch(template, -1) {
+		if !templateFields[m[1]] {
+			return fmt.Errorf("unknown template field {%s}", m[1])
+		}
+	}
+	return nil
+}
+
+// ValidateNameTemplate checks a template for display names, which can use the filename template fields except {ext}
+func ValidateNameTemplate(template string) error {
+	if strings.TrimSpace(template) == "" {
+		return fmt.Errorf("name template is required")
+	}
+	for _, m := range templateFieldRegex.FindAllStringSubmatch(template, -1) {
+		if !templateFields[m[1]] || m[1] == "ext" {
+			return fmt.Errorf("unknown template field {%s}", m[1])
+		}
+	}
+	return nil
+}
+
+// RenderNameTemplate renders a display name. Unlike filenames the result is not sanitized.
+func RenderNameTemplate(template string, meta LayoutMetadata) string {
+	values := meta.fieldValues()
+	rendered := templateFieldRegex.ReplaceAllStringFunc(template, func(field string) string {
+		if v := values[strings.Trim(field, "{}")]; v != "" {
+			return v
+		}
+		return missingFieldValue
+	})
+	return strings.TrimSpace(rendered)
+}
+
+// renderTemplateBase renders a template without its ".{ext}" suffix. Fields are substituted per
+// path segment and every segment is sanitized, so values can never add directories.
+func renderTemplateBase(template string, meta LayoutMetadata) string {
+	values := meta.fieldValues()
+
+	segments := strings.Split(strings.TrimSuffix(template, ".{ext}"), "/")
+	for i, segment := range segments {
+		rendered := templateFieldRegex.ReplaceAllStringFunc(segment, func(field string) string {
+			if v := values[strings.Trim(field, "{}")]; v != "" {
+				return v
+			}
+			return missingFieldValue
+		})
+		segments[i] = utils.SanitizeFilename(rendered)
+	}
+	return strings.Join(segments, "/")
+}
+
+// LibraryLayout decides where finished files are stored, based on the filename template setting
+type LibraryLayout struct {
+	queries  *database.Queries
+	settings *SettingsService
+	storage  Storage
+
+	mu       sync.Mutex
+	reserved map[string]bool
+
+	reorganizeMu     sync.Mutex
+	reorganizeStatus ReorganizeStatusDTO
+}
+
+func NewLibraryLayout(queries *database.Queries, settings *SettingsService, storage Storage) *LibraryLayout {
+	return &LibraryLayout{
+		queries:          queries,
+		settings:         settings,
+		storage:          storage,
+		reserved:         make(map[string]bool),
+		reorganizeStatus: ReorganizeStatusDTO{Moves: []ReorganizeMoveDTO{}},
+	}
+}
+
+func (l *LibraryLayout) template(ctx context.Context) string {
+	settings, err := l.settings.GetSettings(ctx)
+	if err != nil || ValidateFilenameTemplate(settings.FilenameTemplate) != nil {
+		return DefaultFilenameTemplate
+	}
+	return settings.FilenameTemplate
+}
+
+// Reserve picks free storage keys for a video with the given extension (without dot) and its thumbnail.
+// On a collision " (n)" is appended. The keys stay reserved until release is called, so concurrent
+// jobs never pick the same name.
+func (l *LibraryLayout) Reserve(ctx context.Context, meta LayoutMetadata, ext string) (videoKey, thumbnailKey string, release func()) {
+	return l.reserve(ctx, renderTemplateBase(l.template(ctx), meta), ext, "")
+}
+
+// reserve finds a free key for base. ownKey is the video's current key, which counts as free.
+func (l *LibraryLayout) reserve(ctx context.Context, base, ext, ownKey string) (string, string, func()) {
+	keys, release := l.reserveFirst(ctx, base, ownKey, l.isFree, func(candidate string) []string {
+		return []string{candidate + "." + ext, candidate + ".jpg"}
+	})
+	return keys[0], keys[1], release
+}
+
+// ReserveReplacement picks a key with a new extension for a video currently stored at current, e.g. after
+// re-encoding to another container. The video keeps its name and thumbnail unless the new key is taken.
+func (l *LibraryLayout) ReserveReplacement(ctx context.Context, current, ext string) (string, func()) {
+	return l.reserveKey(ctx, strings.TrimSuffix(current, path.Ext(current)), "."+ext, current)
+}
+
+// ReserveKey returns key if it is free, otherwise key with " (n)" appended before the extension
+func (l *LibraryLayout) ReserveKey(ctx context.Context, key string) (string, func()) {
+	ext := path.Ext(key)
+	return l.reserveKey(ctx, strings.TrimSuffix(key, ext), ext, "")
+}
+
+// reserveKey finds a free key for base plus ext (with dot). ownKey counts as free.
+func (l *LibraryLayout) reserveKey(ctx context.Context, base, ext, ownKey string) (string, func()) {
+	keys, release := l.reserveFirst(ctx, base, ownKey, l.isFree, func(candidate string) []string {
+		return []string{candidate + ext}
+	})
+	return keys[0], release
+}
+
+// reserveFirst reserves the keys of the first candidate, base or base with " (n)" appended, whose keys are
+// neither reserved nor taken according to free. The first key counts as free if it is ownKey. The keys are
+// claimed before free is asked, so the storage round trips happen outside the lock and a job that stores
+// one of them in the meantime is still noticed.
+func (l *LibraryLayout) reserveFirst(ctx context.Context, base, ownKey string, free func(context.Context, string) bool, keysOf func(candidate string) []string) ([]string, func()) {
+	candidate := base
+	for i := 1; ; i++ {
+		keys := keysOf(candidate)
+		if keys[0] == ownKey {
+			l.mu.Lock()
+			for _, key := range keys {
+				l.reserved[key] = true
+			}
+			l.mu.Unlock()
+			return keys, func() { l.unclaim(keys) }
+		}
+		if l.claim(keys) {
+			if allFree(ctx, free, keys) {
+				return keys, func() { l.unclaim(keys) }
+			}
+			l.unclaim(keys)
+		}
+		candidate = fmt.Sprintf("%s (%d)", base, i)
+	}
+}
+
+// claim reserves keys if none of them is reserved yet
+func (l *LibraryLayout) claim(keys []string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if l.reserved[key] {
+			return false
+		}
+	}
+	for _, key := range keys {
+		l.reserved[key] = true
+	}
+	return true
+}
+
+func (l *LibraryLayout) unclaim(keys []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		delete(l.reserved, key)
+	}
+}
+
+func allFree(ctx context.Context, free func(context.Context, string) bool, keys []string) bool {
+	for _, key := range keys {
+		if !free(ctx, key) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsReserved reports whether a running job holds key, e.g. because it stored the file but has not recorded it yet
+func (l *LibraryLayout) IsReserved(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.reserved[key]
+}
+
+func (l *LibraryLayout) isFree(ctx context.Context, key string) bool {
+	_, err := l.storage.Stat(ctx, key)
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+type ReorganizeMoveDTO struct {
+	VideoID string `json:"videoId"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Error   string `json:"error,omitempty"`
+}
+
+type ReorganizeStatusDTO struct {
+	Running    bool                `json:"running"`
+	DryRun     bool                `json:"dryRun"`
+	StartedAt  string              `json:"startedAt,omitempty"`
+	FinishedAt string              `json:"finishedAt,omitempty"`
+	Moves      []ReorganizeMoveDTO `json:"moves"`
+}
+
+// ErrReorganizeRunning is returned when a reorganize is started while another one is in progress
+var ErrReorganizeRunning = errors.New("a reorganize is already running")
+
+// GetReorganizeStatus returns the state of the current or last reorganize
+func (l *LibraryLayout) GetReorganizeStatus() ReorganizeStatusDTO {
+	l.reorganizeMu.Lock()
+	defer l.reorganizeMu.Unlock()
+	status := l.reorganizeStatus
+	status.Moves = append([]ReorganizeMoveDTO{}, l.reorganizeStatus.Moves...)
+	return status
+}
+
+// Reorganize moves every completed video into the layout of the current filename template.
+// A dry run returns the planned moves immediately; otherwise the moves happen in the background.
+func (l *LibraryLayout) Reorganize(ctx context.Context, dryRun bool) (ReorganizeStatusDTO, error) {
+	l.reorganizeMu.Lock()
+	if l.reorganizeStatus.Running {
+		l.reorganizeMu.Unlock()
+		return ReorganizeStatusDTO{}, ErrReorganizeRunning
+	}
+	status := ReorganizeStatusDTO{
+		Running:   !dryRun,
+		DryRun:    dryRun,
+		StartedAt: time.Now().Format(time.RFC3339),
+		Moves:     []ReorganizeMoveDTO{},
+	}
+	if !dryRun {
+		l.reorganizeStatus = status
+	}
+	l.reorganizeMu.Unlock()
+
+	videos, err := l.queries.ListAllVideos(ctx)
+	if err != nil {
+		l.finishReorganize()
+		return ReorganizeStatusDTO{}, err
+	}
+
+	if dryRun {
+		status.Moves = l.planReorganize(ctx, videos)
+		status.FinishedAt = time.Now().Format(time.RFC3339)
+		return status, nil
+	}
+
+	go l.runReorganize(videos)
+	return l.GetReorganizeStatus(), nil
+}
+
+// planReorganize returns the moves a reorganize would make. Keys are reserved the same way as in a real run,
+// so collision suffixes match, with the keys of earlier planned moves counting as free.
+func (l *LibraryLayout) planReorganize(ctx context.Context, videos []database.Video) []ReorganizeMoveDTO {
+	template := l.template(ctx)
+	moves := []ReorganizeMoveDTO{}
+	vacated := make(map[string]bool)
+	free := func(ctx context.Context, key string) bool {
+		return vacated[key] || l.isFree(ctx, key)
+	}
+
+	var releases []func()
+	defer func() {
+		for _, release := range releases {
+			release()
+		}
+	}()
+
+	for _, v := range videos {
+		if !v.FileName.Valid || v.DownloadStatus != string(StatusFinished) || v.DeletedAt.Valid {
+			continue
+		}
+		current := v.FileName.String
+		ext := strings.TrimPrefix(path.Ext(current), ".")
+		base := renderTemplateBase(template, LayoutMetadataFromVideo(v))
+		if base+"."+ext == current {
+			continue
+		}
+		keys, release := l.reserveFirst(ctx, base, current, free, func(candidate string) []string {
+			return []string{candidate + "." + ext, candidate + ".jpg"}
+		})
+		releases = append(releases, release)
+		if keys[0] == current {
+			continue
+		}
+		vacated[current] = true
+		if v.ThumbnailFileName.Valid && v.ThumbnailFileName.String != keys[1] {
+			vacated[v.ThumbnailFileName.String] = true
+		}
+		moves = append(moves, ReorganizeMoveDTO{VideoID: v.ID.String(), From: current, To: keys[0]})
+	}
+	return moves
+}
+
+func (l *LibraryLayout) finishReorganize() {
+	l.reorganizeMu.Lock()
+	l.reorganizeStatus.Running = false
+	l.reorganizeStatus.FinishedAt = time.Now().Format(time.RFC3339)
+	l.reorganizeMu.Unlock()
+}
+
+func (l *LibraryLayout) runReorganize(videos []database.Video) {
+	defer l.finishReorganize()
+
+	ctx := context.Background()
+	template := l.template(ctx)
+	slog.Info("Starting library reorganize", "template", template)
+
+	for _, v := range videos {
+		if !v.FileName.Valid || v.DownloadStatus != string(StatusFinished) || v.DeletedAt.Valid {
+			continue
+		}
+		move, moved := l.moveVideo(ctx, template, v)
+		if !moved {
+			continue
+		}
+		if move.Error != "" {
+			slog.Warn("Failed to move video", "video_id", move.VideoID, "from", move.From, "to", move.To, "error", move.Error)
+		}
+
+		l.reorganizeMu.Lock()
+		l.reorganizeStatus.Moves = append(l.reorganizeStatus.Moves, move)
+		l.reorganizeMu.Unlock()
+	}
+
+	slog.Info("Library reorganize finished")
+}
+
+// moveVideo moves a video, its thumbnail and its sprite sheet to the key the template gives it. It returns false if
+// the video is already in place.
+func (l *LibraryLayout) moveVideo(ctx context.Context, template string, v database.Video) (ReorganizeMoveDTO, bool) {
+	current := v.FileName.String
+	ext := strings.TrimPrefix(path.Ext(current), ".")
+	base := renderTemplateBase(template, LayoutMetadataFromVideo(v))
+	if base+"."+ext == current {
+		return ReorganizeMoveDTO{}, false
+	}
+
+	videoKey, thumbnailKey, release := l.reserve(ctx, base, ext, current)
+	defer release()
+
+	move := ReorganizeMoveDTO{VideoID: v.ID.String(), From: current, To: videoKey}
+	if videoKey == current {
+		return move, false
+	}
+
+	if err := l.storage.Move(ctx, current, videoKey); err != nil {
+		move.Error = err.Error()
+		return move, true
+	}
+
+	thumbnail := v.ThumbnailFileName
+	if thumbnail.Valid && thumbnail.String != "" && thumbnail.String != thumbnailKey {
+		if err := l.storage.Move(ctx, thumbnail.String, thumbnailKey); err != nil {
+			slog.Warn("Failed to move thumbnail", "video_id", move.VideoID, "error", err)
+		} else {
+			thumbnail = pgtype.Text{String: thumbnailKey, Valid: true}
+		}
+	}
+
+	if _, err := l.queries.UpdateVideoFiles(ctx, database.UpdateVideoFilesParams{
+		ID:                v.ID,
+		FileName:          pgtype.Text{String: videoKey, Valid: true},
+		ThumbnailFileName: thumbnail,
+		FileSize:          v.FileSize,
+	}); err != nil {
+		move.Error = "moved but failed to update database: " + err.Error()
+		return move, true
+	}
+
+	if sheet, ok := SpriteSheetFromVideo(v); ok && v.SpriteFileName.String != SpriteKey(videoKey) {
+		spriteKey, releaseSprite := l.ReserveKey(ctx, SpriteKey(videoKey))
+		defer releaseSprite()
+		if err := l.storage.Move(ctx, v.SpriteFileName.String, spriteKey); err != nil {
+			slog.Warn("Failed to move sprite sheet", "video_id", move.VideoID, "error", err)
+		} else if err := l.queries.UpdateVideoSprite(ctx, sheet.params(v.ID, spriteKey)); err != nil {
+			move.Error = "moved but failed to update database: " + err.Error()
+		}
+	}
+	return move, true
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// SetupLogging installs the default slog logger based on LOG_LEVEL (debug, info, warn, error)
+// and LOG_FORMAT (text, json). The standard library log package is routed through it as well.
+func SetupLogging() {
+	var level slog.Level
+	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	default:
+		level = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if strings.ToLower(os.Getenv("LOG_FORMAT")) == "json" {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	}
+
+	slog.SetDefault(slog.New(handler))
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"github.com/Azmekk/Vidra/backend/gen/database"
+)
+
+// Maintenance tasks recorded in maintenance_runs
+const (
+	MaintenanceTaskYtdlpUpdate   = "ytdlp_update"
+	MaintenanceTaskYtdlpRollback = "ytdlp_rollback"
+)
+
+// What started a maintenance run
+const (
+	MaintenanceTriggerManual    = "manual"
+	MaintenanceTriggerScheduled = "scheduled"
+)
+
+const (
+	MaintenanceStatusRunning   = "running"
+	MaintenanceStatusSucceeded = "succeeded"
+	MaintenanceStatusFailed    = "failed"
+)
+
+type MaintenanceRunDTO struct {
+	ID          string `json:"id"`
+	Task        string `json:"task"`
+	Trigger     string `json:"trigger"`
+	Status      string `json:"status"`
+	FromVersion string `json:"fromVersion,omitempty"`
+	ToVersion   string `json:"toVersion,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Output      string `json:"output"`
+	StartedAt   string `json:"startedAt"`
+	FinishedAt  string `json:"finishedAt,omitempty"`
+}
+
+func MapMaintenanceRun(r database.MaintenanceRun) MaintenanceRunDTO {
+	dto := MaintenanceRunDTO{
+		ID:          r.ID.String(),
+		Task:        r.Task,
+		Trigger:     r.Trigger,
+		Status:      r.Status,
+		FromVersion: r.FromVersion,
+		ToVersion:   r.ToVersion,
+		Error:       r.Error,
+		Output:      r.Output,
+		StartedAt:   r.StartedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if r.FinishedAt.Valid {
+		dto.FinishedAt = r.FinishedAt.Time.Format("2006-01-02T15:04:05Z07:00")
+	}
+	return dto
+}
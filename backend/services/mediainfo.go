@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ErrMediaInfoRunning is returned when the media info backfill is started while it is already running
+var ErrMediaInfoRunning = errors.New("media info backfill is already running")
+
+// hdrTransfers are the color transfer characteristics of HDR10/HDR10+/Dolby Vision (PQ) and HLG video
+var hdrTransfers = map[string]bool{"smpte2084": true, "arib-std-b67": true}
+
+// MediaInfo is the ffprobe summary stored in videos.media_info
+type MediaInfo struct {
+	Container string               `json:"container"`          // ffprobe format name, e.g. "matroska,webm"
+	Duration  float64              `json:"duration,omitempty"` // seconds
+	Bitrate   int64                `json:"bitrate,omitempty"`  // bits per second, all streams
+	Video     *VideoStreamInfo     `json:"video,omitempty"`
+	Audio     []AudioStreamInfo    `json:"audio"`
+	Subtitles []SubtitleStreamInfo `json:"subtitles"`
+
+	// Chapters embedded in the container. They are stored in their own column.
+	Chapters []Chapter `json:"-"`
+}
+
+type VideoStreamInfo struct {
+	Codec          string  `json:"codec"`
+	Profile        string  `json:"profile,omitempty"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	FPS            float64 `json:"fps,omitempty"`
+	PixelFormat    string  `json:"pixelFormat,omitempty"`
+	ColorTransfer  string  `json:"colorTransfer,omitempty"`
+	ColorPrimaries string  `json:"colorPrimaries,omitempty"`
+	HDR            bool    `json:"hdr"`
+	Bitrate        int64   `json:"bitrate,omitempty"`
+}
+
+type AudioStreamInfo struct {
+	Codec         string `json:"codec"`
+	Profile       string `json:"profile,omitempty"`
+	Channels      int    `json:"channels"`
+	ChannelLayout string `json:"channelLayout,omitempty"`
+	SampleRate    int    `json:"sampleRate,omitempty"`
+	Bitrate       int64  `json:"bitrate,omitempty"`
+	Language      string `json:"language,omitempty"`
+}
+
+type SubtitleStreamInfo struct {
+	Codec    string `json:"codec"`
+	Language string `json:"language,omitempty"`
+	Title    string `json:"title,omitempty"`
+}
+
+type ffprobeStream struct {
+	CodecType      string `json:"codec_type"`
+	CodecName      string `json:"codec_name"`
+	Profile        string `json:"profile"`
+	Width          int    `json:"width"`
+	Height         int    `json:"height"`
+	AvgFrameRate   string `json:"avg_frame_rate"`
+	RFrameRate     string `json:"r_frame_rate"`
+	PixFmt         string `json:"pix_fmt"`
+	ColorTransfer  string `json:"color_transfer"`
+	ColorPrimaries string `json:"color_primaries"`
+	Channels       int    `json:"channels"`
+	ChannelLayout  string `json:"channel_layout"`
+	SampleRate     string `json:"sample_rate"`
+	BitRate        string `json:"bit_rate"`
+	Tags           struct {
+		Language string `json:"language"`
+		Title    string `json:"title"`
+	} `json:"tags"`
+	Disposition struct {
+		AttachedPic int `json:"attached_pic"`
+	} `json:"disposition"`
+}
+
+// ProbeMediaInfo runs ffprobe on a file or URL
+func ProbeMediaInfo(ctx context.Context, metrics *MetricsService, input string) (MediaInfo, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-show_format", "-show_streams", "-show_chapters", "-of", "json", input)
+	output, err := cmd.Output()
+	metrics.ObserveExit("ffprobe", err)
+	if err != nil {
+		return MediaInfo{}, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	var probe struct {
+		Format struct {
+			FormatName string `json:"format_name"`
+			Duration   string `json:"duration"`
+			BitRate    string `json:"bit_rate"`
+		} `json:"format"`
+		Streams  []ffprobeStream `json:"streams"`
+		Chapters []struct {
+			StartTime string `json:"start_time"`
+			EndTime   string `json:"end_time"`
+			Tags      struct {
+				Title string `json:"title"`
+			} `json:"tags"`
+		} `json:"chapters"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return MediaInfo{}, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	info := MediaInfo{
+		Container: probe.Format.FormatName,
+		Audio:     []AudioStreamInfo{},
+		Subtitles: []SubtitleStreamInfo{},
+	}
+	info.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	info.Bitrate, _ = strconv.ParseInt(probe.Format.BitRate, 10, 64)
+
+	for _, stream := range probe.Streams {
+		bitrate, _ := strconv.ParseInt(stream.BitRate, 10, 64)
+		switch stream.CodecType {
+		case "video":
+			// Cover art embedded by yt-dlp shows up as a video stream
+			if info.Video != nil || stream.Disposition.AttachedPic == 1 {
+				continue
+			}
+			fps := parseFrameRate(stream.AvgFrameRate)
+			if fps == 0 {
+				fps = parseFrameRate(stream.RFrameRate)
+			}
+			info.Video = &VideoStreamInfo{
+				Codec:          NormalizeVideoCodec(stream.CodecName),
+				Profile:        stream.Profile,
+				Width:          stream.Width,
+				Height:         stream.Height,
+				FPS:            fps,
+				PixelFormat:    stream.PixFmt,
+				ColorTransfer:  stream.ColorTransfer,
+				ColorPrimaries: stream.ColorPrimaries,
+				HDR:            hdrTransfers[stream.ColorTransfer],
+				Bitrate:        bitrate,
+			}
+		case "audio":
+			sampleRate, _ := strconv.Atoi(stream.SampleRate)
+			info.Audio = append(info.Audio, AudioStreamInfo{
+				Codec:         stream.CodecName,
+				Profile:       stream.Profile,
+				Channels:      stream.Channels,
+				ChannelLayout: stream.ChannelLayout,
+				SampleRate:    sampleRate,
+				Bitrate:       bitrate,
+				Language:      stream.Tags.Language,
+			})
+		case "subtitle":
+			info.Subtitles = append(info.Subtitles, SubtitleStreamInfo{
+				Codec:    stream.CodecName,
+				Language: stream.Tags.Language,
+				Title:    stream.Tags.Title,
+			})
+		}
+	}
+	for _, c := range probe.Chapters {
+		start, _ := strconv.ParseFloat(c.StartTime, 64)
+		end, _ := strconv.ParseFloat(c.EndTime, 64)
+		info.Chapters = append(info.Chapters, newChapter(start, end, c.Tags.Title))
+	}
+	return info, nil
+}
+
+// parseFrameRate parses ffprobe's rational frame rates like "30000/1001", rounded to 3 decimals
+func parseFrameRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if ok {
+		d, err := strconv.ParseFloat(den, 64)
+		if err != nil || d == 0 {
+			return 0
+		}
+		n /= d
+	}
+	fps, _ := strconv.ParseFloat(strconv.FormatFloat(n, 'f', 3, 64), 64)
+	return fps
+}
+
+// mediaInfoParams copies the indexed fields out of a probe result
+func mediaInfoParams(id pgtype.UUID, info MediaInfo) (database.UpdateVideoMediaInfoParams, error) {
+	raw, err := json.Marshal(info)
+	if err != nil {
+		return database.UpdateVideoMediaInfoParams{}, err
+	}
+	params := database.UpdateVideoMediaInfoParams{
+		ID:        id,
+		MediaInfo: raw,
+		Bitrate:   pgtype.Int8{Int64: info.Bitrate, Valid: info.Bitrate > 0},
+		Duration:  pgtype.Float8{Float64: info.Duration, Valid: info.Duration > 0},
+	}
+	if v := info.Video; v != nil {
+		params.Width = pgtype.Int4{Int32: int32(v.Width), Valid: v.Width > 0}
+		params.Height = pgtype.Int4{Int32: int32(v.Height), Valid: v.Height > 0}
+		params.VideoCodec = pgtype.Text{String: v.Codec, Valid: v.Codec != ""}
+		params.Hdr = pgtype.Bool{Bool: v.HDR, Valid: true}
+	}
+	if len(info.Audio) > 0 {
+		params.AudioCodec = pgtype.Text{String: info.Audio[0].Codec, Valid: info.Audio[0].Codec != ""}
+	}
+	return params, nil
+}
+
+// recordMediaInfo probes input and stores the result on the video. Embedded chapters replace the stored ones;
+// without any the stored chapters are kept.
+func recordMediaInfo(ctx context.Context, queries *database.Queries, metrics *MetricsService, id pgtype.UUID, input string) (MediaInfo, error) {
+	info, err := ProbeMediaInfo(ctx, metrics, input)
+	if err != nil {
+		return info, err
+	}
+	params, err := mediaInfoParams(id, info)
+	if err != nil {
+		return info, err
+	}
+	if err := queries.UpdateVideoMediaInfo(ctx, params); err != nil {
+		return info, err
+	}
+	if len(info.Chapters) > 0 {
+		return info, storeChapters(ctx, queries, id, info.Chapters)
+	}
+	return info, nil
+}
+
+// probeTarget returns what ffprobe should read for a stored key: the file itself with local storage,
+// otherwise its URL, from which ffprobe only fetches the parts it needs
+func probeTarget(ctx context.Context, storage Storage, key string) (string, error) {
+	if local, ok := storage.(interface{ LocalPath(string) string }); ok {
+		return local.LocalPath(key), nil
+	}
+	return storage.URL(ctx, key)
+}
+
+type MediaInfoFailureDTO struct {
+	VideoID string `json:"videoId"`
+	Message string `json:"message"`
+}
+
+type MediaInfoStatusDTO struct {
+	Running    bool                  `json:"running"`
+	StartedAt  string                `json:"startedAt,omitempty"`
+	FinishedAt string                `json:"finishedAt,omitempty"`
+	Total      int                   `json:"total"`
+	Probed     int                   `json:"probed"`
+	Failures   []MediaInfoFailureDTO `json:"failures"`
+}
+
+// MediaInfoService probes stored videos that have no media info yet, e.g. those downloaded before it was recorded
+type MediaInfoService struct {
+	queries *database.Queries
+	metrics *MetricsService
+	storage Storage
+
+	mu     sync.Mutex
+	status MediaInfoStatusDTO
+}
+
+func NewMediaInfoService(queries *database.Queries, metrics *MetricsService, storage Storage) *MediaInfoService {
+	return &MediaInfoService{
+		queries: queries,
+		metrics: metrics,
+		storage: storage,
+		status:  MediaInfoStatusDTO{Failures: []MediaInfoFailureDTO{}},
+	}
+}
+
+// Probe probes the stored file of a video and records the result
+func (s *MediaInfoService) Probe(ctx context.Context, video database.Video) error {
+	target, err := probeTarget(ctx, s.storage, video.FileName.String)
+	if err != nil {
+		return err
+	}
+	_, err = recordMediaInfo(ctx, s.queries, s.metrics, video.ID, target)
+	return err
+}
+
+// GetStatus returns the state of the current or last backfill
+func (s *MediaInfoService) GetStatus() MediaInfoStatusDTO {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status
+	status.Failures = append([]MediaInfoFailureDTO{}, s.status.Failures...)
+	return status
+}
+
+// Start probes every completed video without media info in the background
+func (s *MediaInfoService) Start(ctx context.Context) (MediaInfoStatusDTO, error) {
+	s.mu.Lock()
+	if s.status.Running {
+		s.mu.Unlock()
+		return MediaInfoStatusDTO{}, ErrMediaInfoRunning
+	}
+	s.status = MediaInfoStatusDTO{
+		Running:   true,
+		StartedAt: time.Now().Format(time.RFC3339),
+		Failures:  []MediaInfoFailureDTO{},
+	}
+	s.mu.Unlock()
+
+	videos, err := s.queries.ListVideosMissingMediaInfo(ctx)
+	if err != nil {
+		s.finish()
+		return MediaInfoStatusDTO{}, err
+	}
+
+	s.mu.Lock()
+	s.status.Total = len(videos)
+	s.mu.Unlock()
+
+	go s.run(videos)
+	return s.GetStatus(), nil
+}
+
+func (s *MediaInfoService) run(videos []database.Video) {
+	defer s.finish()
+
+	slog.Info("Starting media info backfill", "videos", len(videos))
+	for _, v := range videos {
+		err := s.Probe(context.Background(), v)
+
+		s.mu.Lock()
+		if err != nil {
+			slog.Warn("Failed to probe video", "video_id", v.ID.String(), "error", err)
+			s.status.Failures = append(s.status.Failures, MediaInfoFailureDTO{VideoID: v.ID.String(), Message: err.Error()})
+		} else {
+			s.status.Probed++
+		}
+		s.mu.Unlock()
+	}
+	slog.Info("Media info backfill finished")
+}
+
+func (s *MediaInfoService) finish() {
+	s.mu.Lock()
+	s.status.Running = false
+	s.status.FinishedAt = time.Now().Format(time.RFC3339)
+	s.mu.Unlock()
+}
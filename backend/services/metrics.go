@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os/exec"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "vidra"
+
+// activeStatuses are the job statuses reported by the active jobs gauge
+var activeStatuses = []DownloadStatus{StatusPending, StatusDownloading, StatusEncoding}
+
+type MetricsService struct {
+	registry *prometheus.Registry
+
+	downloadsStarted   *prometheus.CounterVec
+	downloadsCompleted *prometheus.CounterVec
+	downloadsFailed    *prometheus.CounterVec
+	downloadDuration   *prometheus.HistogramVec
+	encodeDuration     *prometheus.HistogramVec
+	bytesDownloaded    *prometheus.CounterVec
+	processExits       *prometheus.CounterVec
+}
+
+func NewMetricsService(pool *pgxpool.Pool, ws *WebSocketService) *MetricsService {
+	s := &MetricsService{
+		registry: prometheus.NewRegistry(),
+		downloadsStarted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "downloads_started_total",
+			Help:      "Number of downloads started, by extractor.",
+		}, []string{"extractor"}),
+		downloadsCompleted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "downloads_completed_total",
+			Help:      "Number of downloads that finished processing successfully, by extractor.",
+		}, []string{"extractor"}),
+		downloadsFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "downloads_failed_total",
+			Help:      "Number of downloads that failed, by extractor.",
+		}, []string{"extractor"}),
+		downloadDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "download_duration_seconds",
+			Help:      "Time spent in yt-dlp downloading a video, by extractor.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 14),
+		}, []string{"extractor"}),
+		encodeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "encode_duration_seconds",
+			Help:      "Time spent in ffmpeg re-encoding a video, by video codec.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 14),
+		}, []string{"codec"}),
+		bytesDownloaded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "downloaded_bytes_total",
+			Help:      "Bytes downloaded by yt-dlp, by extractor.",
+		}, []string{"extractor"}),
+		processExits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "process_exits_total",
+			Help:      "Exit codes of external processes. A code of -1 means the process could not be started.",
+		}, []string{"binary", "code"}),
+	}
+
+	s.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		s.downloadsStarted,
+		s.downloadsCompleted,
+		s.downloadsFailed,
+		s.downloadDuration,
+		s.encodeDuration,
+		s.bytesDownloaded,
+		s.processExits,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "websocket_clients",
+			Help:      "Number of connected WebSocket clients.",
+		}, func() float64 {
+			return float64(ws.ClientCount())
+		}),
+		newPoolCollector(pool),
+	)
+
+	return s
+}
+
+// RegisterLibrarySize exposes the library size cached by the quota service, so scrapes do not walk the
+// downloads directory
+func (s *MetricsService) RegisterLibrarySize(quota *QuotaService) {
+	s.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "downloads_directory_bytes",
+		Help:      "Total size of the library in " + DownloadsDir + " or object storage in bytes.",
+	}, func() float64 {
+		return float64(quota.getLibrarySize(context.Background()))
+	}))
+}
+
+// RegisterJobs exposes the number of active jobs per status from the downloader's progress map
+func (s *MetricsService) RegisterJobs(downloader *DownloaderService) {
+	s.registry.MustRegister(&jobsCollector{downloader: downloader})
+}
+
+func (s *MetricsService) Handler() http.Handler {
+	return promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{})
+}
+
+func (s *MetricsService) DownloadStarted(extractor string) {
+	s.downloadsStarted.WithLabelValues(extractor).Inc()
+}
+
+func (s *MetricsService) DownloadCompleted(extractor string) {
+	s.downloadsCompleted.WithLabelValues(extractor).Inc()
+}
+
+func (s *MetricsService) DownloadFailed(extractor string) {
+	s.downloadsFailed.WithLabelValues(extractor).Inc()
+}
+
+func (s *MetricsService) ObserveDownload(extractor string, seconds float64, bytes int64) {
+	s.downloadDuration.WithLabelValues(extractor).Observe(seconds)
+	if bytes > 0 {
+		s.bytesDownloaded.WithLabelValues(extractor).Add(float64(bytes))
+	}
+}
+
+func (s *MetricsService) ObserveEncode(codec string, seconds float64) {
+	s.encodeDuration.WithLabelValues(codec).Observe(seconds)
+}
+
+// ObserveExit records the exit code of an external process from the error returned by Run/Wait/Output
+func (s *MetricsService) ObserveExit(binary string, err error) {
+	s.processExits.WithLabelValues(binary, strconv.Itoa(exitCode(err))).Inc()
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+type jobsCollector struct {
+	downloader *DownloaderService
+}
+
+var activeJobsDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(metricsNamespace, "", "active_jobs"),
+	"Number of download jobs currently in progress, by status.",
+	[]string{"status"}, nil,
+)
+
+func (c *jobsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeJobsDesc
+}
+
+func (c *jobsCollector) Collect(ch chan<- prometheus.Metric) {
+	counts := make(map[DownloadStatus]int)
+	for _, p := range c.downloader.GetAllProgress() {
+		counts[p.Status]++
+	}
+	for _, status := range activeStatuses {
+		ch <- prometheus.MustNewConstMetric(activeJobsDesc, prometheus.GaugeValue, float64(counts[status]), string(status))
+	}
+}
+
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquiredConns    *prometheus.Desc
+	idleConns        *prometheus.Desc
+	totalConns       *prometheus.Desc
+	maxConns         *prometheus.Desc
+	acquireCount     *prometheus.Desc
+	acquireDuration  *prometheus.Desc
+	emptyAcquires    *prometheus.Desc
+	canceledAcquires *prometheus.Desc
+}
+
+func newPoolCollector(pool *pgxpool.Pool) *poolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "db_pool", name), help, nil, nil)
+	}
+	return &poolCollector{
+		pool:             pool,
+		acquiredConns:    desc("acquired_connections", "Number of currently acquired connections."),
+		idleConns:        desc("idle_connections", "Number of currently idle connections."),
+		totalConns:       desc("total_connections", "Total number of connections in the pool."),
+		maxConns:         desc("max_connections", "Maximum size of the pool."),
+		acquireCount:     desc("acquires_total", "Cumulative count of successful acquires."),
+		acquireDuration:  desc("acquire_duration_seconds_total", "Total time spent waiting for a connection."),
+		emptyAcquires:    desc("empty_acquires_total", "Cumulative count of acquires that had to wait for a connection."),
+		canceledAcquires: desc("canceled_acquires_total", "Cumulative count of acquires canceled by a context."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquiredConns
+	ch <- c.idleConns
+	ch <- c.totalConns
+	ch <- c.maxConns
+	ch <- c.acquireCount
+	ch <- c.acquireDuration
+	ch <- c.emptyAcquires
+	ch <- c.canceledAcquires
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquires, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+}
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// SpriteTileWidth and SpriteTileHeight are the size of one frame in a sprite sheet. Frames of other
+	// aspect ratios are letterboxed.
+	SpriteTileWidth  = 160
+	SpriteTileHeight = 90
+
+	spriteColumns     = 10
+	maxSpriteTiles    = 100
+	minSpriteInterval = 2.0 // seconds
+
+	// spriteSuffix replaces the video's extension in the sprite sheet key, e.g. "title.sprite.jpg"
+	spriteSuffix = ".sprite.jpg"
+)
+
+var (
+	// ErrNoPreviewSource is returned when generating previews for a video without a finished file
+	ErrNoPreviewSource = errors.New("only completed videos have previews")
+	// ErrPreviewsRunning is returned when preview generation is started while another run is in progress
+	ErrPreviewsRunning = errors.New("preview generation is already running")
+)
+
+// SpriteSheet describes a generated sprite sheet: Count tiles taken every Interval seconds, Columns per row
+type SpriteSheet struct {
+	Interval float64
+	Columns  int
+	Count    int
+}
+
+// SpriteKey returns the default sprite sheet key for a video stored at videoKey
+func SpriteKey(videoKey string) string {
+	return strings.TrimSuffix(videoKey, path.Ext(videoKey)) + spriteSuffix
+}
+
+// SpriteSheetFromVideo returns the sprite sheet stored on a video row, if it has one
+func SpriteSheetFromVideo(v database.Video) (SpriteSheet, bool) {
+	if !v.SpriteFileName.Valid || v.SpriteFileName.String == "" || !v.SpriteInterval.Valid || !v.SpriteColumns.Valid || !v.SpriteCount.Valid {
+		return SpriteSheet{}, false
+	}
+	return SpriteSheet{
+		Interval: v.SpriteInterval.Float64,
+		Columns:  int(v.SpriteColumns.Int32),
+		Count:    int(v.SpriteCount.Int32),
+	}, true
+}
+
+func (sheet SpriteSheet) params(id pgtype.UUID, key string) database.UpdateVideoSpriteParams {
+	return database.UpdateVideoSpriteParams{
+		ID:             id,
+		SpriteFileName: pgtype.Text{String: key, Valid: true},
+		SpriteInterval: pgtype.Float8{Float64: sheet.Interval, Valid: true},
+		SpriteColumns:  pgtype.Int4{Int32: int32(sheet.Columns), Valid: true},
+		SpriteCount:    pgtype.Int4{Int32: int32(sheet.Count), Valid: true},
+	}
+}
+
+// planSprite spreads at most maxSpriteTiles frames over the video, at least minSpriteInterval apart
+func planSprite(duration float64) SpriteSheet {
+	interval := math.Max(minSpriteInterval, duration/maxSpriteTiles)
+	count := int(math.Ceil(duration / interval))
+	count = max(1, min(count, maxSpriteTiles))
+	return SpriteSheet{Interval: interval, Columns: min(count, spriteColumns), Count: count}
+}
+
+// BuildThumbnailTrack renders a WebVTT thumbnail track whose cues point at the tiles of the sprite sheet
+// served at spriteURL, using media fragments (#xywh=x,y,w,h)
+func BuildThumbnailTrack(sheet SpriteSheet, duration float64, spriteURL string) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i := 0; i < sheet.Count; i++ {
+		start := float64(i) * sheet.Interval
+		if duration > 0 && start >= duration {
+			break
+		}
+		end := start + sheet.Interval
+		if duration > 0 && end > duration {
+			end = duration
+		}
+		x := (i % sheet.Columns) * SpriteTileWidth
+		y := (i / sheet.Columns) * SpriteTileHeight
+		fmt.Fprintf(&b, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n", vttTimestamp(start), vttTimestamp(end), spriteURL, x, y, SpriteTileWidth, SpriteTileHeight)
+	}
+	return b.String()
+}
+
+func vttTimestamp(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// probeDuration returns the duration of a media file in seconds
+func probeDuration(ctx context.Context, metrics *MetricsService, input string) (float64, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "json", input)
+	output, err := cmd.Output()
+	metrics.ObserveExit("ffprobe", err)
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	var probe struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return 0, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	return strconv.ParseFloat(probe.Format.Duration, 64)
+}
+
+// generateThumbnail picks a representative frame (ffmpeg's thumbnail filter) from around 10% of the video's duration
+func generateThumbnail(ctx context.Context, metrics *MetricsService, input, output string, duration float64) error {
+	offset := strconv.FormatFloat(duration*0.1, 'f', 2, 64)
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-ss", offset, "-i", input, "-vf", "thumbnail", "-frames:v", "1", "-q:v", "2", "-y", output)
+	out, err := cmd.CombinedOutput()
+	metrics.ObserveExit("ffmpeg", err)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// generateSprite renders the timeline sprite sheet of a video into a single JPEG
+func generateSprite(ctx context.Context, metrics *MetricsService, input, output string, duration float64) (SpriteSheet, error) {
+	if duration <= 0 {
+		return SpriteSheet{}, fmt.Errorf("video duration is unknown")
+	}
+	sheet := planSprite(duration)
+	rows := (sheet.Count + sheet.Columns - 1) / sheet.Columns
+
+	filter := fmt.Sprintf("fps=1/%s,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,tile=%dx%d",
+		strconv.FormatFloat(sheet.Interval, 'f', 3, 64),
+		SpriteTileWidth, SpriteTileHeight, SpriteTileWidth, SpriteTileHeight, sheet.Columns, rows)
+	// Decoding only keyframes is much faster and close enough for hover previews
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-skip_frame", "nokey", "-i", input, "-vf", filter, "-an", "-frames:v", "1", "-q:v", "4", "-y", output)
+	out, err := cmd.CombinedOutput()
+	metrics.ObserveExit("ffmpeg", err)
+	if err != nil {
+		os.Remove(output)
+		return SpriteSheet{}, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return sheet, nil
+}
+
+type PreviewFailureDTO struct {
+	VideoID string `json:"videoId"`
+	Message string `json:"message"`
+}
+
+type PreviewStatusDTO struct {
+	Running    bool                `json:"running"`
+	All        bool                `json:"all"` // false only covers videos without a sprite sheet or thumbnail
+	StartedAt  string              `json:"startedAt,omitempty"`
+	FinishedAt string              `json:"finishedAt,omitempty"`
+	Total      int                 `json:"total"`
+	Generated  int                 `json:"generated"`
+	Failures   []PreviewFailureDTO `json:"failures"`
+}
+
+// PreviewService (re)generates thumbnails and timeline sprite sheets of videos already in the library
+type PreviewService struct {
+	queries    *database.Queries
+	downloader *DownloaderService
+
+	mu     sync.Mutex
+	status PreviewStatusDTO
+}
+
+func NewPreviewService(queries *database.Queries, downloader *DownloaderService) *PreviewService {
+	return &PreviewService{
+		queries:    queries,
+		downloader: downloader,
+		status:     PreviewStatusDTO{Failures: []PreviewFailureDTO{}},
+	}
+}
+
+// Generate rebuilds the sprite sheet of a completed video, and grabs a thumbnail if it has none
+func (s *PreviewService) Generate(ctx context.Context, video database.Video) (database.Video, error) {
+	idStr := video.ID.String()
+	if video.DownloadStatus != string(StatusFinished) || !video.FileName.Valid || video.FileName.String == "" || video.DeletedAt.Valid {
+		return video, ErrNoPreviewSource
+	}
+	if s.downloader.IsRunning(idStr) {
+		return video, ErrJobRunning
+	}
+
+	current := video.FileName.String
+	// Staged under hidden names so reconcile never takes them for orphans while they are generated
+	localSource := filepath.Join(DownloadsDir, ".preview-"+idStr+path.Ext(current))
+	if err := s.downloader.fetchFromStorage(ctx, current, localSource); err != nil {
+		return video, fmt.Errorf("failed to fetch video file: %w", err)
+	}
+	defer os.Remove(localSource)
+
+	duration := video.Duration.Float64
+	if !video.Duration.Valid || duration <= 0 {
+		probed, err := probeDuration(ctx, s.downloader.metrics, localSource)
+		if err != nil {
+			return video, err
+		}
+		duration = probed
+	}
+
+	if !s.inStorage(ctx, video.ThumbnailFileName) {
+		thumbnailPath := filepath.Join(DownloadsDir, ".preview-"+idStr+".jpg")
+		if err := generateThumbnail(ctx, s.downloader.metrics, localSource, thumbnailPath, duration); err != nil {
+			return video, fmt.Errorf("failed to generate thumbnail: %w", err)
+		}
+		// The key stays reserved until the row records it, so reconcile does not see it as an orphan
+		key, release := s.downloader.layout.ReserveKey(ctx, strings.TrimSuffix(current, path.Ext(current))+".jpg")
+		if err := s.downloader.storage.Put(ctx, key, thumbnailPath); err != nil {
+			release()
+			os.Remove(thumbnailPath)
+			return video, fmt.Errorf("failed to store thumbnail: %w", err)
+		}
+		_, err := s.queries.UpdateVideoFiles(ctx, database.UpdateVideoFilesParams{
+			ID:                video.ID,
+			FileName:          video.FileName,
+			ThumbnailFileName: pgtype.Text{String: key, Valid: true},
+			FileSize:          video.FileSize,
+		})
+		release()
+		if err != nil {
+			return video, err
+		}
+	}
+
+	spritePath := filepath.Join(DownloadsDir, ".preview-"+idStr+spriteSuffix)
+	sheet, err := generateSprite(ctx, s.downloader.metrics, localSource, spritePath, duration)
+	if err != nil {
+		return video, fmt.Errorf("failed to generate sprite sheet: %w", err)
+	}
+	// An existing sprite sheet is overwritten in place
+	key, release := video.SpriteFileName.String, func() {}
+	if !video.SpriteFileName.Valid || key == "" {
+		key, release = s.downloader.layout.ReserveKey(ctx, SpriteKey(current))
+	}
+	defer release()
+	if err := s.downloader.storage.Put(ctx, key, spritePath); err != nil {
+		os.Remove(spritePath)
+		return video, fmt.Errorf("failed to store sprite sheet: %w", err)
+	}
+	if err := s.queries.UpdateVideoSprite(ctx, sheet.params(video.ID, key)); err != nil {
+		return video, err
+	}
+
+	s.downloader.quota.InvalidateLibrarySize()
+	return s.queries.GetVideo(ctx, video.ID)
+}
+
+func (s *PreviewService) inStorage(ctx context.Context, key pgtype.Text) bool {
+	if !key.Valid || key.String == "" {
+		return false
+	}
+	_, err := s.downloader.storage.Stat(ctx, key.String)
+	return err == nil
+}
+
+// GetStatus returns the state of the current or last library-wide run
+func (s *PreviewService) GetStatus() PreviewStatusDTO {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status
+	status.Failures = append([]PreviewFailureDTO{}, s.status.Failures...)
+	return status
+}
+
+// Start generates previews for the library in the background. Unless all is set, only videos missing a
+// sprite sheet or thumbnail are covered.
+func (s *PreviewService) Start(ctx context.Context, all bool) (PreviewStatusDTO, error) {
+	s.mu.Lock()
+	if s.status.Running {
+		s.mu.Unlock()
+		return PreviewStatusDTO{}, ErrPreviewsRunning
+	}
+	s.status = PreviewStatusDTO{
+		Running:   true,
+		All:       all,
+		StartedAt: time.Now().Format(time.RFC3339),
+		Failures:  []PreviewFailureDTO{},
+	}
+	s.mu.Unlock()
+
+	videos, err := s.queries.ListAllVideos(ctx)
+	if err != nil {
+		s.finish()
+		return PreviewStatusDTO{}, err
+	}
+
+	var targets []database.Video
+	for _, v := range videos {
+		if v.DownloadStatus != string(StatusFinished) || !v.FileName.Valid || v.DeletedAt.Valid {
+			continue
+		}
+		if _, hasSprite := SpriteSheetFromVideo(v); all || !hasSprite || !v.ThumbnailFileName.Valid {
+			targets = append(targets, v)
+		}
+	}
+
+	s.mu.Lock()
+	s.status.Total = len(targets)
+	s.mu.Unlock()
+
+	go s.run(targets)
+	return s.GetStatus(), nil
+}
+
+func (s *PreviewService) run(videos []database.Video) {
+	defer s.finish()
+
+	slog.Info("Starting preview generation", "videos", len(videos))
+	for _, v := range videos {
+		_, err := s.Generate(context.Background(), v)
+
+		s.mu.Lock()
+		if err != nil {
+			slog.Warn("Failed to generate previews", "video_id", v.ID.String(), "error", err)
+			s.status.Failures = append(s.status.Failures, PreviewFailureDTO{VideoID: v.ID.String(), Message: err.Error()})
+		} else {
+			s.status.Generated++
+		}
+		s.mu.Unlock()
+	}
+	slog.Info("Preview generation finished")
+}
+
+func (s *PreviewService) finish() {
+	s.mu.Lock()
+	s.status.Running = false
+	s.status.FinishedAt = time.Now().Format(time.RFC3339)
+	s.mu.Unlock()
+}
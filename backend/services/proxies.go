@@ -0,0 +1,447 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	ProxyStrategyRoundRobin = "round_robin"
+	ProxyStrategyFailover   = "failover"
+
+	ProxyMatchExtractor = "extractor"
+	ProxyMatchDomain    = "domain"
+
+	// proxyBlockCooldown is how long a proxy that was answered with 403/429 goes to the back of its pool
+	proxyBlockCooldown = 15 * time.Minute
+
+	// proxyCheckURL answers 204 and is reachable from most places, so any other outcome is the proxy's fault
+	proxyCheckURL         = "https://www.gstatic.com/generate_204"
+	proxyCheckTimeout     = 15 * time.Second
+	proxyCheckConcurrency = 8
+)
+
+// proxyBlockedRegex matches yt-dlp errors after which the download is retried through another proxy:
+// the site refusing the proxy's address, or the proxy itself failing
+var proxyBlockedRegex = regexp.MustCompile(`HTTP Error (403|429)|ProxyError|Unable to connect to proxy|Tunnel connection failed`)
+
+// ProxyBlocked reports whether yt-dlp output shows that the proxy was blocked or failed
+func ProxyBlocked(output string) bool {
+	return proxyBlockedRegex.MatchString(output)
+}
+
+// ErrNoEnabledProxies is returned for a URL routed to a pool whose proxies are all disabled. Downloading
+// without a proxy instead would expose the address the rule was meant to hide.
+var ErrNoEnabledProxies = errors.New("no enabled proxies in pool")
+
+// ValidateProxyURL checks that a proxy URL uses a scheme both yt-dlp and the health check support. SOCKS4 is
+// left out because Go's HTTP client cannot dial it.
+func ValidateProxyURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid proxy URL: %s", raw)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return nil
+	}
+	return fmt.Errorf("invalid proxy URL scheme %q: must be http, https, socks5 or socks5h", u.Scheme)
+}
+
+// ProxyChoice is a proxy picked for a request. ID is empty for the global proxy from the settings.
+type ProxyChoice struct {
+	ID  string
+	URL string
+}
+
+type ProxyDTO struct {
+	ID             string `json:"id"`
+	URL            string `json:"url"`
+	Enabled        bool   `json:"enabled"`
+	LastCheckedAt  string `json:"lastCheckedAt,omitempty"`
+	LastCheckOK    *bool  `json:"lastCheckOk,omitempty"`
+	LastCheckError string `json:"lastCheckError,omitempty"`
+	LastLatencyMs  *int   `json:"lastLatencyMs,omitempty"`
+	BlockedUntil   string `json:"blockedUntil,omitempty"` // set while the proxy is skipped after a 403/429
+}
+
+type ProxyPoolDTO struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Strategy  string     `json:"strategy"`
+	Proxies   []ProxyDTO `json:"proxies"`
+	CreatedAt string     `json:"createdAt"`
+	UpdatedAt string     `json:"updatedAt"`
+}
+
+// ProxyInput is a proxy of a pool being created or updated, in failover order
+type ProxyInput struct {
+	URL     string
+	Enabled bool
+}
+
+type ProxyHealthDTO struct {
+	ProxyID   string `json:"proxyId"`
+	PoolID    string `json:"poolId"`
+	URL       string `json:"url"`
+	OK        bool   `json:"ok"`
+	LatencyMs int    `json:"latencyMs,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ProxyService picks the proxy for each yt-dlp request. Rules route a URL to a pool by extractor or domain;
+// URLs no rule matches use the global proxy from the settings.
+type ProxyService struct {
+	pool     *pgxpool.Pool
+	queries  *database.Queries
+	settings *SettingsService
+
+	mu           sync.Mutex
+	next         map[string]int       // pool ID -> next round-robin index
+	blockedUntil map[string]time.Time // proxy ID -> end of its cooldown
+}
+
+func NewProxyService(pool *pgxpool.Pool, queries *database.Queries, settings *SettingsService) *ProxyService {
+	return &ProxyService{
+		pool:         pool,
+		queries:      queries,
+		settings:     settings,
+		next:         make(map[string]int),
+		blockedUntil: make(map[string]time.Time),
+	}
+}
+
+// Candidates returns the proxies to try for a URL, best first. extractor is the yt-dlp extractor if it is
+// already known; otherwise extractor rules are compared with the site name of the URL. Proxies in their
+// cooldown come last. An empty result means no proxy. A URL matching a rule whose pool has no enabled proxy
+// gets ErrNoEnabledProxies.
+func (s *ProxyService) Candidates(ctx context.Context, rawURL, extractor string) ([]ProxyChoice, error) {
+	global := s.settings.GetProxyURL(ctx)
+	fallback := []ProxyChoice{}
+	if global != "" {
+		fallback = append(fallback, ProxyChoice{URL: global})
+	}
+
+	rules, err := s.queries.ListEnabledProxyRules(ctx)
+	if err != nil {
+		slog.Warn("Failed to load proxy rules", "error", err)
+		return fallback, nil
+	}
+	host := ""
+	if u, err := url.Parse(rawURL); err == nil {
+		host = strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	}
+	if extractor == "" {
+		extractor = siteName(host)
+	}
+
+	for _, rule := range rules {
+		if !matchProxyRule(rule, host, extractor) {
+			continue
+		}
+		pool, err := s.queries.GetProxyPool(ctx, rule.PoolID)
+		if err != nil {
+			slog.Warn("Failed to load proxy pool", "pool_id", rule.PoolID.String(), "error", err)
+			return fallback, nil
+		}
+		proxies, err := s.queries.ListPoolProxies(ctx, rule.PoolID)
+		if err != nil {
+			slog.Warn("Failed to load proxies", "pool_id", rule.PoolID.String(), "error", err)
+			return fallback, nil
+		}
+		candidates := s.order(pool, proxies)
+		if len(candidates) == 0 {
+			return nil, fmt.Errorf("%w %q", ErrNoEnabledProxies, pool.Name)
+		}
+		return candidates, nil
+	}
+	return fallback, nil
+}
+
+// order lists the enabled proxies of a pool by its strategy, moving proxies in their cooldown to the back.
+// It returns nil when none is enabled.
+func (s *ProxyService) order(pool database.ProxyPool, proxies []database.Proxy) []ProxyChoice {
+	enabled := make([]database.Proxy, 0, len(proxies))
+	for _, p := range proxies {
+		if p.Enabled {
+			enabled = append(enabled, p)
+		}
+	}
+	if len(enabled) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := 0
+	if pool.Strategy == ProxyStrategyRoundRobin {
+		poolID := pool.ID.String()
+		start = s.next[poolID] % len(enabled)
+		s.next[poolID] = start + 1
+	}
+
+	now := time.Now()
+	ready := make([]ProxyChoice, 0, len(enabled))
+	var cooling []ProxyChoice
+	for i := range enabled {
+		p := enabled[(start+i)%len(enabled)]
+		choice := ProxyChoice{ID: p.ID.String(), URL: p.Url}
+		if now.Before(s.blockedUntil[choice.ID]) {
+			cooling = append(cooling, choice)
+		} else {
+			ready = append(ready, choice)
+		}
+	}
+	return append(ready, cooling...)
+}
+
+// ReportBlocked puts a proxy that was refused by a site into its cooldown
+func (s *ProxyService) ReportBlocked(choice ProxyChoice) {
+	if choice.ID == "" {
+		return
+	}
+	s.mu.Lock()
+	s.blockedUntil[choice.ID] = time.Now().Add(proxyBlockCooldown)
+	s.mu.Unlock()
+}
+
+func matchProxyRule(rule database.ProxyRule, host, extractor string) bool {
+	pattern := strings.ToLower(rule.Pattern)
+	switch rule.MatchType {
+	case ProxyMatchDomain:
+		return matchDomain(host, pattern)
+	case ProxyMatchExtractor:
+		// "youtube" also covers "youtube:tab" and the like
+		family, _, _ := strings.Cut(strings.ToLower(extractor), ":")
+		return strings.EqualFold(extractor, pattern) || family == pattern
+	}
+	return false
+}
+
+// matchDomain reports whether host is domain or one of its subdomains
+func matchDomain(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// siteName guesses the extractor name from a host: the label before the public suffix, e.g. "vimeo" for
+// player.vimeo.com and "bbc" for bbc.co.uk
+func siteName(host string) string {
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 {
+		return host
+	}
+	name := labels[len(labels)-2]
+	if len(labels) > 2 && len(name) <= 3 && (name == "co" || name == "com" || name == "org" || name == "net" || name == "ac" || name == "gov") {
+		name = labels[len(labels)-3]
+	}
+	return name
+}
+
+// MapProxyPool builds the API view of a pool and its proxies
+func (s *ProxyService) MapProxyPool(pool database.ProxyPool, proxies []database.Proxy) ProxyPoolDTO {
+	dto := ProxyPoolDTO{
+		ID:        pool.ID.String(),
+		Name:      pool.Name,
+		Strategy:  pool.Strategy,
+		Proxies:   make([]ProxyDTO, 0, len(proxies)),
+		CreatedAt: pool.CreatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt: pool.UpdatedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range proxies {
+		proxy := ProxyDTO{
+			ID:             p.ID.String(),
+			URL:            p.Url,
+			Enabled:        p.Enabled,
+			LastCheckError: p.LastCheckError.String,
+		}
+		if p.LastCheckedAt.Valid {
+			proxy.LastCheckedAt = p.LastCheckedAt.Time.Format("2006-01-02T15:04:05Z07:00")
+		}
+		if p.LastCheckOk.Valid {
+			proxy.LastCheckOK = &p.LastCheckOk.Bool
+		}
+		if p.LastLatencyMs.Valid {
+			latency := int(p.LastLatencyMs.Int32)
+			proxy.LastLatencyMs = &latency
+		}
+		if until, ok := s.blockedUntil[proxy.ID]; ok && time.Now().Before(until) {
+			proxy.BlockedUntil = until.Format("2006-01-02T15:04:05Z07:00")
+		}
+		dto.Proxies = append(dto.Proxies, proxy)
+	}
+	return dto
+}
+
+// ListPools returns every pool with its proxies
+func (s *ProxyService) ListPools(ctx context.Context) ([]ProxyPoolDTO, error) {
+	pools, err := s.queries.ListProxyPools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := s.queries.ListProxies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byPool := make(map[string][]database.Proxy)
+	for _, p := range proxies {
+		byPool[p.PoolID.String()] = append(byPool[p.PoolID.String()], p)
+	}
+
+	result := make([]ProxyPoolDTO, 0, len(pools))
+	for _, pool := range pools {
+		result = append(result, s.MapProxyPool(pool, byPool[pool.ID.String()]))
+	}
+	return result, nil
+}
+
+// SavePool creates a pool, or updates it if id is valid, and replaces its proxies
+func (s *ProxyService) SavePool(ctx context.Context, id pgtype.UUID, name, strategy string, proxies []ProxyInput) (ProxyPoolDTO, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return ProxyPoolDTO{}, err
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.queries.WithTx(tx)
+
+	var pool database.ProxyPool
+	if id.Valid {
+		pool, err = qtx.UpdateProxyPool(ctx, database.UpdateProxyPoolParams{ID: id, Name: name, Strategy: strategy})
+	} else {
+		pool, err = qtx.CreateProxyPool(ctx, database.CreateProxyPoolParams{Name: name, Strategy: strategy})
+	}
+	if err != nil {
+		return ProxyPoolDTO{}, err
+	}
+
+	// Health results are kept for proxies whose URL did not change
+	existing, err := qtx.ListPoolProxies(ctx, pool.ID)
+	if err != nil {
+		return ProxyPoolDTO{}, err
+	}
+	previous := make(map[string]database.Proxy, len(existing))
+	for _, p := range existing {
+		previous[p.Url] = p
+	}
+	if err := qtx.DeletePoolProxies(ctx, pool.ID); err != nil {
+		return ProxyPoolDTO{}, err
+	}
+
+	saved := make([]database.Proxy, 0, len(proxies))
+	for i, input := range proxies {
+		p, err := qtx.CreateProxy(ctx, database.CreateProxyParams{
+			PoolID:   pool.ID,
+			Url:      input.URL,
+			Position: int32(i),
+			Enabled:  input.Enabled,
+		})
+		if err != nil {
+			return ProxyPoolDTO{}, err
+		}
+		if old, ok := previous[input.URL]; ok && old.LastCheckedAt.Valid {
+			if p, err = qtx.UpdateProxyHealth(ctx, database.UpdateProxyHealthParams{
+				ID:             p.ID,
+				LastCheckOk:    old.LastCheckOk,
+				LastCheckError: old.LastCheckError,
+				LastLatencyMs:  old.LastLatencyMs,
+			}); err != nil {
+				return ProxyPoolDTO{}, err
+			}
+		}
+		saved = append(saved, p)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return ProxyPoolDTO{}, err
+	}
+	return s.MapProxyPool(pool, saved), nil
+}
+
+// CheckAll tests every proxy by fetching a known URL through it and records the results
+func (s *ProxyService) CheckAll(ctx context.Context) ([]ProxyHealthDTO, error) {
+	proxies, err := s.queries.ListProxies(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ProxyHealthDTO, len(proxies))
+	sem := make(chan struct{}, proxyCheckConcurrency)
+	var wg sync.WaitGroup
+	for i, p := range proxies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = s.check(ctx, p)
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+func (s *ProxyService) check(ctx context.Context, p database.Proxy) ProxyHealthDTO {
+	result := ProxyHealthDTO{ProxyID: p.ID.String(), PoolID: p.PoolID.String(), URL: p.Url}
+
+	start := time.Now()
+	err := checkProxy(ctx, p.Url)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.OK = true
+		result.LatencyMs = int(time.Since(start).Milliseconds())
+	}
+
+	if _, err := s.queries.UpdateProxyHealth(ctx, database.UpdateProxyHealthParams{
+		ID:             p.ID,
+		LastCheckOk:    pgtype.Bool{Bool: result.OK, Valid: true},
+		LastCheckError: pgtype.Text{String: result.Error, Valid: result.Error != ""},
+		LastLatencyMs:  pgtype.Int4{Int32: int32(result.LatencyMs), Valid: result.OK},
+	}); err != nil {
+		slog.Warn("Failed to record proxy health", "proxy_id", result.ProxyID, "error", err)
+	}
+	return result
+}
+
+func checkProxy(ctx context.Context, proxyURL string) error {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyURL(u)},
+		Timeout:   proxyCheckTimeout,
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, proxyCheckURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
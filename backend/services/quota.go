@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Azmekk/Vidra/backend/utils"
+)
+
+const (
+	bytesPerGB = 1024 * 1024 * 1024
+
+	// librarySizeCacheTTL limits how often the downloads directory is walked
+	librarySizeCacheTTL  = 30 * time.Second
+	quotaMonitorInterval = time.Minute
+)
+
+// ErrQuotaExceeded is returned when a download would breach the configured disk limits
+var ErrQuotaExceeded = errors.New("disk quota exceeded")
+
+type DiskUsageDTO struct {
+	LibraryBytes    int64   `json:"libraryBytes"`
+	MaxLibraryBytes int64   `json:"maxLibraryBytes"` // 0 means unlimited
+	FreeBytes       int64   `json:"freeBytes"`
+	TotalBytes      int64   `json:"totalBytes"`
+	MinFreeBytes    int64   `json:"minFreeBytes"` // 0 means no minimum
+	LibraryPercent  float64 `json:"libraryPercent"`
+	DiskPercent     float64 `json:"diskPercent"`
+	WarningPercent  int     `json:"warningPercent"`
+}
+
+type QuotaService struct {
+	settings *SettingsService
+	ws       *WebSocketService
+	storage  Storage
+
+	mu            sync.Mutex
+	librarySize   int64
+	librarySizeAt time.Time
+	warned        bool
+}
+
+func NewQuotaService(settings *SettingsService, ws *WebSocketService, storage Storage) *QuotaService {
+	return &QuotaService{
+		settings: settings,
+		ws:       ws,
+		storage:  storage,
+	}
+}
+
+// getLibrarySize sums the size of every object in storage
+func (s *QuotaService) getLibrarySize(ctx context.Context) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.librarySizeAt) < librarySizeCacheTTL {
+		return s.librarySize
+	}
+	objects, err := s.storage.List(ctx, "")
+	if err != nil {
+		slog.Warn("Failed to list storage", "error", err)
+		return s.librarySize
+	}
+	var size int64
+	for _, obj := range objects {
+		size += obj.Size
+	}
+	s.librarySize = size
+	s.librarySizeAt = time.Now()
+	return size
+}
+
+// GetUsage returns the current library size and free space alongside the configured limits
+func (s *QuotaService) GetUsage(ctx context.Context) (DiskUsageDTO, error) {
+	settings, err := s.settings.GetSettings(ctx)
+	if err != nil {
+		return DiskUsageDTO{}, err
+	}
+
+	free, total, err := utils.GetDiskSpace(DownloadsDir)
+	if err != nil {
+		return DiskUsageDTO{}, err
+	}
+
+	usage := DiskUsageDTO{
+		LibraryBytes:    s.getLibrarySize(ctx),
+		MaxLibraryBytes: int64(settings.MaxLibrarySizeGB * bytesPerGB),
+		FreeBytes:       int64(free),
+		TotalBytes:      int64(total),
+		MinFreeBytes:    int64(settings.MinFreeSpaceGB * bytesPerGB),
+		WarningPercent:  settings.DiskWarningPercent,
+	}
+	if usage.MaxLibraryBytes > 0 {
+		usage.LibraryPercent = float64(usage.LibraryBytes) / float64(usage.MaxLibraryBytes) * 100
+	}
+	if usage.TotalBytes > 0 {
+		usage.DiskPercent = float64(usage.TotalBytes-usage.FreeBytes) / float64(usage.TotalBytes) * 100
+	}
+	return usage, nil
+}
+
+// CheckDownload returns ErrQuotaExceeded if downloading additionalBytes more would breach
+// the max library size or drop free space below the configured minimum.
+// Pass 0 when the size is unknown to only check the current state.
+func (s *QuotaService) CheckDownload(ctx context.Context, additionalBytes int64) error {
+	usage, err := s.GetUsage(ctx)
+	if err != nil {
+		return err
+	}
+
+	if usage.MaxLibraryBytes > 0 && usage.LibraryBytes+additionalBytes > usage.MaxLibraryBytes {
+		return fmt.Errorf("%w: library would use %.2f GB of the %.2f GB limit", ErrQuotaExceeded,
+			float64(usage.LibraryBytes+additionalBytes)/bytesPerGB, float64(usage.MaxLibraryBytes)/bytesPerGB)
+	}
+	if usage.MinFreeBytes > 0 && usage.FreeBytes-additionalBytes < usage.MinFreeBytes {
+		return fmt.Errorf("%w: free space would drop to %.2f GB, below the %.2f GB minimum", ErrQuotaExceeded,
+			float64(usage.FreeBytes-additionalBytes)/bytesPerGB, float64(usage.MinFreeBytes)/bytesPerGB)
+	}
+	return nil
+}
+
+// Limited reports whether a max library size or a minimum of free space is configured
+func (s *QuotaService) Limited(ctx context.Context) (bool, error) {
+	settings, err := s.settings.GetSettings(ctx)
+	if err != nil {
+		return false, err
+	}
+	return settings.MaxLibrarySizeGB > 0 || settings.MinFreeSpaceGB > 0, nil
+}
+
+// InvalidateLibrarySize forces the next check to re-walk the downloads directory
+func (s *QuotaService) InvalidateLibrarySize() {
+	s.mu.Lock()
+	s.librarySizeAt = time.Time{}
+	s.mu.Unlock()
+}
+
+// Run periodically broadcasts a disk warning when usage crosses the warning threshold.
+// A warning is sent once per crossing and re-armed when usage falls back below it.
+func (s *QuotaService) Run() {
+	ticker := time.NewTicker(quotaMonitorInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.checkThreshold(context.Background())
+	}
+}
+
+func (s *QuotaService) checkThreshold(ctx context.Context) {
+	usage, err := s.GetUsage(ctx)
+	if err != nil {
+		slog.Warn("Failed to read disk usage", "error", err)
+		return
+	}
+	if usage.WarningPercent <= 0 {
+		return
+	}
+
+	threshold := float64(usage.WarningPercent)
+	exceeded := usage.LibraryPercent >= threshold || usage.DiskPercent >= threshold ||
+		(usage.MinFreeBytes > 0 && usage.FreeBytes < usage.MinFreeBytes)
+
+	s.mu.Lock()
+	shouldWarn := exceeded && !s.warned
+	s.warned = exceeded
+	s.mu.Unlock()
+
+	if shouldWarn {
+		slog.Warn("Disk usage crossed warning threshold",
+			"library_percent", usage.LibraryPercent, "disk_percent", usage.DiskPercent, "free_bytes", usage.FreeBytes)
+		s.ws.Broadcast(WsEventDiskWarning, usage)
+	}
+}
@@ -0,0 +1,316 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type ReconcileOrphanDTO struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+type ReconcileMissingDTO struct {
+	VideoID  string `json:"videoId"`
+	Name     string `json:"name"`
+	FileName string `json:"fileName"`
+}
+
+type ReconcileSizeMismatchDTO struct {
+	VideoID      string `json:"videoId"`
+	FileName     string `json:"fileName"`
+	RecordedSize int64  `json:"recordedSize"`
+	ActualSize   int64  `json:"actualSize"`
+}
+
+type ReconcileStaleDTO struct {
+	VideoID   string `json:"videoId"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	NewStatus string `json:"newStatus"`
+}
+
+type ReconcileReportDTO struct {
+	DryRun         bool                       `json:"dryRun"`
+	OrphanFiles    []ReconcileOrphanDTO       `json:"orphanFiles"`
+	MissingFiles   []ReconcileMissingDTO      `json:"missingFiles"`
+	SizeMismatches []ReconcileSizeMismatchDTO `json:"sizeMismatches"`
+	StaleJobs      []ReconcileStaleDTO        `json:"staleJobs"`
+}
+
+type ReconcileService struct {
+	queries    *database.Queries
+	downloader *DownloaderService
+	imports    *ImportService
+	storage    Storage
+	mu         sync.Mutex
+}
+
+func NewReconcileService(queries *database.Queries, downloader *DownloaderService, imports *ImportService, storage Storage) *ReconcileService {
+	return &ReconcileService{
+		queries:    queries,
+		downloader: downloader,
+		imports:    imports,
+		storage:    storage,
+	}
+}
+
+// Reconcile compares storage and the downloads directory with the videos table. It reports files without a row,
+// rows whose file is gone, recorded sizes that differ from disk and jobs left in a non-terminal status
+// with no running process. Unless dryRun is set, each finding is fixed.
+func (s *ReconcileService) Reconcile(ctx context.Context, dryRun bool) (ReconcileReportDTO, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := ReconcileReportDTO{
+		DryRun:         dryRun,
+		OrphanFiles:    []ReconcileOrphanDTO{},
+		MissingFiles:   []ReconcileMissingDTO{},
+		SizeMismatches: []ReconcileSizeMismatchDTO{},
+		StaleJobs:      []ReconcileStaleDTO{},
+	}
+
+	// Finished files come from storage; job temp files always live in the local downloads directory.
+	// Jobs store their final file before recording it, so orphans are checked again before being removed.
+	files := make(map[string]int64)
+	objects, err := s.storage.List(ctx, "")
+	if err != nil {
+		return report, err
+	}
+	for _, obj := range objects {
+		if strings.HasPrefix(obj.Key, importDropPrefix) || strings.HasPrefix(path.Base(obj.Key), ".") {
+			continue
+		}
+		files[obj.Key] = obj.Size
+	}
+
+	tempFiles := make(map[string]int64)
+	entries, err := os.ReadDir(DownloadsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return report, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || tempFileVideoID(e.Name()) == "" {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			tempFiles[e.Name()] = info.Size()
+		}
+	}
+
+	videos, err := s.queries.ListAllVideos(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	known := make(map[string]bool)
+	// Videos whose temp files (<uuid>.*, <uuid>_encoded.*) must be kept: running jobs, paused jobs that can be
+	// resumed and finished videos, whose files may be named after their ID through the {uuid} template field
+	keepTemp := make(map[string]bool)
+
+	for _, v := range videos {
+		idStr := v.ID.String()
+		addKnownKeys(known, v)
+
+		switch DownloadStatus(v.DownloadStatus) {
+		case StatusPending, StatusDownloading, StatusEncoding:
+			keepTemp[idStr] = true
+			if s.downloader.IsRunning(idStr) {
+				continue
+			}
+			stale := ReconcileStaleDTO{VideoID: idStr, Name: v.Name, Status: v.DownloadStatus, NewStatus: string(StatusError)}
+			if len(v.DownloadOptions) > 0 {
+				stale.NewStatus = string(StatusPaused)
+			} else {
+				delete(keepTemp, idStr)
+			}
+			report.StaleJobs = append(report.StaleJobs, stale)
+			if !dryRun {
+				s.fixStaleJob(ctx, v.ID, stale)
+			}
+		case StatusImporting:
+			// Rows are processed by the running import; otherwise it was interrupted and cannot be resumed
+			if s.imports.Running() {
+				continue
+			}
+			stale := ReconcileStaleDTO{VideoID: idStr, Name: v.Name, Status: v.DownloadStatus, NewStatus: string(StatusError)}
+			report.StaleJobs = append(report.StaleJobs, stale)
+			if !dryRun {
+				s.fixStaleJob(ctx, v.ID, stale)
+			}
+		case StatusPaused:
+			keepTemp[idStr] = true
+		case StatusFinished:
+			keepTemp[idStr] = true
+			if !v.FileName.Valid || v.FileName.String == "" {
+				continue
+			}
+			size, ok := files[v.FileName.String]
+			if !ok {
+				report.MissingFiles = append(report.MissingFiles, ReconcileMissingDTO{VideoID: idStr, Name: v.Name, FileName: v.FileName.String})
+				if !dryRun {
+					s.fixMissingFile(ctx, v)
+				}
+				continue
+			}
+			if !v.FileSize.Valid || v.FileSize.Int64 != size {
+				report.SizeMismatches = append(report.SizeMismatches, ReconcileSizeMismatchDTO{
+					VideoID:      idStr,
+					FileName:     v.FileName.String,
+					RecordedSize: v.FileSize.Int64,
+					ActualSize:   size,
+				})
+				if !dryRun {
+					s.fixFileSize(ctx, v, size)
+				}
+			}
+		}
+	}
+
+	var orphans, tempOrphans []string
+	for key := range files {
+		// With local storage the downloads directory is the library root; its temp files are checked below
+		if _, temp := tempFiles[key]; !temp && !known[key] {
+			orphans = append(orphans, key)
+		}
+	}
+	for name := range tempFiles {
+		if isOrphanTempFile(name, known, keepTemp) {
+			tempOrphans = append(tempOrphans, name)
+		}
+	}
+	if len(orphans) > 0 || len(tempOrphans) > 0 {
+		// Re-read the table: a job may have recorded its file since the first read
+		if videos, err = s.queries.ListAllVideos(ctx); err != nil {
+			return report, err
+		}
+		for _, v := range videos {
+			addKnownKeys(known, v)
+			if v.DownloadStatus == string(StatusFinished) {
+				keepTemp[v.ID.String()] = true
+			}
+		}
+	}
+	for _, key := range orphans {
+		// Keys reserved by a running download, re-encode, import or reorganize are not recorded yet
+		if known[key] || s.downloader.layout.IsReserved(key) {
+			continue
+		}
+		size := files[key]
+		report.OrphanFiles = append(report.OrphanFiles, ReconcileOrphanDTO{Path: key, Size: size})
+		if !dryRun {
+			s.downloader.DeleteVideoFiles(ctx, key, "")
+		}
+	}
+
+	for _, name := range tempOrphans {
+		if !isOrphanTempFile(name, known, keepTemp) || s.downloader.layout.IsReserved(name) {
+			continue
+		}
+		size := tempFiles[name]
+		tempPath := filepath.Join(DownloadsDir, name)
+		report.OrphanFiles = append(report.OrphanFiles, ReconcileOrphanDTO{Path: filepath.ToSlash(tempPath), Size: size})
+		if !dryRun {
+			if err := os.Remove(tempPath); err != nil && !os.IsNotExist(err) {
+				slog.Warn("Failed to remove orphan temp file", "path", tempPath, "error", err)
+			}
+		}
+	}
+
+	if !dryRun && len(report.OrphanFiles) > 0 {
+		s.downloader.quota.InvalidateLibrarySize()
+	}
+
+	slog.Info("Reconcile finished", "dry_run", dryRun,
+		"orphans", len(report.OrphanFiles), "missing", len(report.MissingFiles),
+		"size_mismatches", len(report.SizeMismatches), "stale_jobs", len(report.StaleJobs))
+
+	return report, nil
+}
+
+// addKnownKeys marks the storage keys recorded for v
+func addKnownKeys(known map[string]bool, v database.Video) {
+	for _, key := range []pgtype.Text{v.FileName, v.ThumbnailFileName, v.SpriteFileName} {
+		if key.Valid && key.String != "" {
+			known[key.String] = true
+		}
+	}
+}
+
+// isOrphanTempFile reports whether a file in the downloads directory is a job temp file that may be removed:
+// it is named after a video ID, is not a recorded key and its video does not need it anymore
+func isOrphanTempFile(name string, known, keepTemp map[string]bool) bool {
+	id := tempFileVideoID(name)
+	return id != "" && !known[name] && !keepTemp[id]
+}
+
+// tempFileVideoID returns the video ID of a job temp file named "<uuid>.ext" or "<uuid>_encoded.ext", or "" otherwise
+func tempFileVideoID(path string) string {
+	name := filepath.Base(path)
+	if len(name) < 36 {
+		return ""
+	}
+	var id pgtype.UUID
+	if err := id.Scan(name[:36]); err != nil {
+		return ""
+	}
+	rest := name[36:]
+	if strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, "_encoded") {
+		return id.String()
+	}
+	return ""
+}
+
+// fixStaleJob moves a job that was interrupted (e.g. by a restart) to paused when it can be resumed and to error otherwise
+func (s *ReconcileService) fixStaleJob(ctx context.Context, id pgtype.UUID, stale ReconcileStaleDTO) {
+	if _, err := s.queries.UpdateVideoStatus(ctx, database.UpdateVideoStatusParams{
+		ID:             id,
+		DownloadStatus: stale.NewStatus,
+	}); err != nil {
+		slog.Error("Failed to update stale job status", "video_id", stale.VideoID, "error", err)
+		return
+	}
+	if stale.NewStatus == string(StatusError) {
+		s.recordError(ctx, id, "Job was interrupted and cannot be resumed")
+	}
+}
+
+func (s *ReconcileService) fixMissingFile(ctx context.Context, v database.Video) {
+	if _, err := s.queries.UpdateVideoStatus(ctx, database.UpdateVideoStatusParams{
+		ID:             v.ID,
+		DownloadStatus: string(StatusError),
+	}); err != nil {
+		slog.Error("Failed to update status of video with missing file", "video_id", v.ID.String(), "error", err)
+		return
+	}
+	s.recordError(ctx, v.ID, "Video file is missing from the downloads directory: "+v.FileName.String)
+}
+
+func (s *ReconcileService) fixFileSize(ctx context.Context, v database.Video, size int64) {
+	if _, err := s.queries.UpdateVideoFiles(ctx, database.UpdateVideoFilesParams{
+		ID:                v.ID,
+		FileName:          v.FileName,
+		ThumbnailFileName: v.ThumbnailFileName,
+		FileSize:          pgtype.Int8{Int64: size, Valid: true},
+	}); err != nil {
+		slog.Error("Failed to update file size", "video_id", v.ID.String(), "error", err)
+	}
+}
+
+func (s *ReconcileService) recordError(ctx context.Context, id pgtype.UUID, message string) {
+	if _, err := s.queries.CreateError(ctx, database.CreateErrorParams{
+		VideoID:      id,
+		ErrorMessage: message,
+		Command:      "reconcile",
+	}); err != nil {
+		slog.Error("Failed to record error", "video_id", id.String(), "error", err)
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestTempFileVideoID(t *testing.T) {
+	const id = "0b9d6a52-3c1f-4f5e-9a7b-2d8e4c6f1a30"
+	tests := []struct {
+		path string
+		want string
+	}{
+		{id + ".mp4", id},
+		{id + ".f137.mp4.part", id},
+		{id + ".info.json", id},
+		{id + "_encoded.mkv", id},
+		{"downloads/" + id + ".webm", id},
+		{id, ""},
+		{".preview-" + id + ".mp4", ""},
+		{".import-" + id + ".mp4", ""},
+		{"Channel/My Video.mp4", ""},
+		{"not-a-uuid-but-thirty-six-characters.mp4", ""},
+		{"short.mp4", ""},
+	}
+
+	for _, tt := range tests {
+		if got := tempFileVideoID(tt.path); got != tt.want {
+			t.Errorf("tempFileVideoID(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIsOrphanTempFile(t *testing.T) {
+	const id = "0b9d6a52-3c1f-4f5e-9a7b-2d8e4c6f1a30"
+	const other = "7f1e2d3c-4b5a-4c6d-8e7f-9a0b1c2d3e4f"
+
+	// A completed video stored with the {uuid}.{ext} template lives in the downloads directory root under
+	// names that look like job temp files
+	var videoID pgtype.UUID
+	if err := videoID.Scan(id); err != nil {
+		t.Fatal(err)
+	}
+	known := make(map[string]bool)
+	addKnownKeys(known, database.Video{
+		ID:                videoID,
+		FileName:          pgtype.Text{String: id + ".mp4", Valid: true},
+		ThumbnailFileName: pgtype.Text{String: id + ".jpg", Valid: true},
+		DownloadStatus:    string(StatusFinished),
+	})
+
+	tests := []struct {
+		name     string
+		file     string
+		keepTemp map[string]bool
+		want     bool
+	}{
+		{"recorded video file", id + ".mp4", nil, false},
+		{"recorded thumbnail", id + ".jpg", nil, false},
+		{"leftover of a completed video", id + ".info.json", map[string]bool{id: true}, false},
+		{"temp file of a kept job", other + ".f137.mp4.part", map[string]bool{other: true}, false},
+		{"temp file of a failed job", other + ".f137.mp4.part", nil, true},
+		{"encoded file of a failed job", other + "_encoded.mkv", nil, true},
+		{"not a temp file", "Channel.mp4", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isOrphanTempFile(tt.file, known, tt.keepTemp); got != tt.want {
+				t.Errorf("isOrphanTempFile(%q) = %v, want %v", tt.file, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	RetentionRuleMaxAge     = "max_age"     // delete videos older than Value days
+	RetentionRuleKeepLatest = "keep_latest" // keep only the newest Value videos per scope
+	RetentionRuleUnwatched  = "unwatched"   // delete videos nobody started watching within Value days
+
+	RetentionScopeAll  = "all"
+	RetentionScopeSite = "site" // group by the host of the original URL; only used by keep_latest
+	RetentionScopeTag  = "tag"  // only videos with the rule's tag
+
+	retentionInterval = time.Hour
+)
+
+// RetentionCandidateDTO is a video that the retention rules would delete
+type RetentionCandidateDTO struct {
+	VideoID   string `json:"videoId"`
+	Name      string `json:"name"`
+	FileSize  int64  `json:"fileSize"`
+	CreatedAt string `json:"createdAt"`
+	RuleID    string `json:"ruleId"`
+	RuleName  string `json:"ruleName"`
+	Permanent bool   `json:"permanent"` // deleted for good rather than moved to the trash
+}
+
+// retentionVideos is what the rules are evaluated against
+type retentionVideos struct {
+	videos  []database.Video    // ordered newest first
+	tags    map[string][]string // tag names by video ID
+	watched map[string]bool     // video IDs any viewer started watching
+}
+
+type RetentionService struct {
+	queries    *database.Queries
+	downloader *DownloaderService
+	tags       *TagService
+	trash      *TrashService
+}
+
+func NewRetentionService(queries *database.Queries, downloader *DownloaderService, tags *TagService, trash *TrashService) *RetentionService {
+	return &RetentionService{
+		queries:    queries,
+		downloader: downloader,
+		tags:       tags,
+		trash:      trash,
+	}
+}
+
+// Evaluate returns the videos the enabled rules would delete. Pinned videos and
+// downloads that have not reached a terminal status are never candidates.
+func (s *RetentionService) Evaluate(ctx context.Context) ([]RetentionCandidateDTO, error) {
+	candidates, _, err := s.evaluate(ctx)
+	return candidates, err
+}
+
+func (s *RetentionService) evaluate(ctx context.Context) ([]RetentionCandidateDTO, []database.Video, error) {
+	rules, err := s.queries.ListEnabledRetentionRules(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rules) == 0 {
+		return []RetentionCandidateDTO{}, nil, nil
+	}
+
+	library, err := s.loadVideos(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	matched := make(map[string]bool)
+	candidates := []RetentionCandidateDTO{}
+	var toDelete []database.Video
+
+	for _, rule := range rules {
+		for _, v := range matchRetentionRule(rule, library) {
+			idStr := v.ID.String()
+			if matched[idStr] {
+				continue
+			}
+			matched[idStr] = true
+			toDelete = append(toDelete, v)
+			candidates = append(candidates, RetentionCandidateDTO{
+				VideoID:   idStr,
+				Name:      v.Name,
+				FileSize:  v.FileSize.Int64,
+				CreatedAt: v.CreatedAt.Time.Format(time.RFC3339),
+				RuleID:    rule.ID.String(),
+				RuleName:  rule.Name,
+				Permanent: rule.Permanent,
+			})
+		}
+	}
+
+	return candidates, toDelete, nil
+}
+
+func (s *RetentionService) loadVideos(ctx context.Context) (retentionVideos, error) {
+	videos, err := s.queries.ListRetentionCandidates(ctx)
+	if err != nil {
+		return retentionVideos{}, err
+	}
+
+	ids := make([]pgtype.UUID, len(videos))
+	for i, v := range videos {
+		ids[i] = v.ID
+	}
+	tags, err := s.tags.TagsForVideos(ctx, ids)
+	if err != nil {
+		return retentionVideos{}, err
+	}
+
+	watchedIDs, err := s.queries.ListWatchedVideoIDs(ctx)
+	if err != nil {
+		return retentionVideos{}, err
+	}
+	watched := make(map[string]bool, len(watchedIDs))
+	for _, id := range watchedIDs {
+		watched[id.String()] = true
+	}
+
+	return retentionVideos{videos: videos, tags: tags, watched: watched}, nil
+}
+
+// matchRetentionRule returns the videos a single rule selects for deletion
+func matchRetentionRule(rule database.RetentionRule, library retentionVideos) []database.Video {
+	var matched []database.Video
+
+	videos := library.videos
+	if rule.Scope == RetentionScopeTag {
+		videos = nil
+		for _, v := range library.videos {
+			if slices.Contains(library.tags[v.ID.String()], rule.Tag) {
+				videos = append(videos, v)
+			}
+		}
+	}
+
+	switch rule.RuleType {
+	case RetentionRuleMaxAge:
+		cutoff := time.Now().AddDate(0, 0, -int(rule.Value))
+		for _, v := range videos {
+			if v.CreatedAt.Time.Before(cutoff) {
+				matched = append(matched, v)
+			}
+		}
+	case RetentionRuleKeepLatest:
+		kept := make(map[string]int)
+		for _, v := range videos {
+			key := ""
+			if rule.Scope == RetentionScopeSite {
+				key = siteFromURL(v.OriginalUrl)
+			}
+			if kept[key] < int(rule.Value) {
+				kept[key]++
+				continue
+			}
+			matched = append(matched, v)
+		}
+	case RetentionRuleUnwatched:
+		cutoff := time.Now().AddDate(0, 0, -int(rule.Value))
+		for _, v := range videos {
+			if v.CreatedAt.Time.Before(cutoff) && !library.watched[v.ID.String()] {
+				matched = append(matched, v)
+			}
+		}
+	}
+
+	return matched
+}
+
+// siteFromURL returns the host of a URL without a leading "www."
+func siteFromURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// RunOnce evaluates the rules and moves every candidate to the trash, or deletes it for good if its rule
+// is permanent
+func (s *RetentionService) RunOnce(ctx context.Context) ([]RetentionCandidateDTO, error) {
+	candidates, videos, err := s.evaluate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := []RetentionCandidateDTO{}
+	for i, v := range videos {
+		if candidates[i].Permanent {
+			err = s.downloader.DeleteVideo(ctx, v)
+		} else {
+			_, err = s.trash.Trash(ctx, v)
+		}
+		if err != nil {
+			slog.Error("Retention failed to delete video", "video_id", v.ID.String(), "error", err)
+			continue
+		}
+		slog.Info("Retention deleted video", "video_id", v.ID.String(), "rule", candidates[i].RuleName)
+		deleted = append(deleted, candidates[i])
+	}
+
+	return deleted, nil
+}
+
+// Run is the background janitor that applies the retention rules periodically
+func (s *RetentionService) Run() {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := s.RunOnce(context.Background())
+		if err != nil {
+			slog.Error("Retention run failed", "error", err)
+			continue
+		}
+		if len(deleted) > 0 {
+			slog.Info("Retention run finished", "deleted", len(deleted))
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// StatusScheduled is a download waiting for the next download window
+const StatusScheduled DownloadStatus = "scheduled"
+
+const scheduleCheckInterval = time.Minute
+
+var (
+	// ErrNotScheduled is returned when starting a video early that is not waiting for a download window
+	ErrNotScheduled = errors.New("video is not scheduled")
+
+	// rateLimitRegex matches the rates yt-dlp accepts for --limit-rate, in bytes per second: 500K, 4.2M, ...
+	rateLimitRegex = regexp.MustCompile(`^\d+(\.\d+)?[KkMmGg]?$`)
+	// windowTimeRegex matches a time of day as HH:MM
+	windowTimeRegex = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)
+)
+
+// DownloadWindow is a time of day range, in the server's time zone, during which new downloads may start.
+// A window whose end is before its start runs over midnight, e.g. 22:00-06:00.
+type DownloadWindow struct {
+	Start string `json:"start"` // HH:MM
+	End   string `json:"end"`   // HH:MM
+}
+
+// ValidateRateLimit checks a yt-dlp rate limit. Empty means no limit.
+func ValidateRateLimit(rate string) error {
+	if rate != "" && !rateLimitRegex.MatchString(rate) {
+		return fmt.Errorf("invalid rate limit %q: use bytes per second with an optional K, M or G suffix, e.g. 5M", rate)
+	}
+	return nil
+}
+
+// ValidateDownloadWindows checks that every window has a start and an end time as HH:MM
+func ValidateDownloadWindows(windows []DownloadWindow) error {
+	for _, w := range windows {
+		if !windowTimeRegex.MatchString(w.Start) || !windowTimeRegex.MatchString(w.End) {
+			return fmt.Errorf("invalid download window %s-%s: times must be HH:MM", w.Start, w.End)
+		}
+		if w.Start == w.End {
+			return fmt.Errorf("invalid download window %s-%s: start and end must differ", w.Start, w.End)
+		}
+	}
+	return nil
+}
+
+// minuteOfDay converts a validated HH:MM time to minutes after midnight
+func minuteOfDay(hhmm string) int {
+	h, _ := strconv.Atoi(hhmm[:2])
+	m, _ := strconv.Atoi(hhmm[3:])
+	return h*60 + m
+}
+
+func (w DownloadWindow) contains(t time.Time) bool {
+	start, end, now := minuteOfDay(w.Start), minuteOfDay(w.End), t.Hour()*60+t.Minute()
+	if start < end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+// InDownloadWindow reports whether downloads may start at t. Without windows they always may.
+func InDownloadWindow(windows []DownloadWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for _, w := range windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextDownloadWindow returns when downloads may next start: t itself inside a window, otherwise the
+// earliest window start after t
+func NextDownloadWindow(windows []DownloadWindow, t time.Time) time.Time {
+	if InDownloadWindow(windows, t) {
+		return t
+	}
+	var next time.Time
+	for _, w := range windows {
+		minute := minuteOfDay(w.Start)
+		start := time.Date(t.Year(), t.Month(), t.Day(), minute/60, minute%60, 0, 0, t.Location())
+		if !start.After(t) {
+			start = start.AddDate(0, 0, 1)
+		}
+		if next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+	return next
+}
+
+func parseDownloadWindows(raw []byte) []DownloadWindow {
+	windows := []DownloadWindow{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &windows); err != nil {
+			slog.Warn("Failed to parse download windows", "error", err)
+		}
+	}
+	return windows
+}
+
+// ScheduleService holds new downloads back until a download window opens and starts them once it does
+type ScheduleService struct {
+	queries    *database.Queries
+	settings   *SettingsService
+	downloader *DownloaderService
+
+	mu sync.Mutex // serializes Check so scheduled videos are started once
+}
+
+func NewScheduleService(queries *database.Queries, settings *SettingsService, downloader *DownloaderService) *ScheduleService {
+	return &ScheduleService{
+		queries:    queries,
+		settings:   settings,
+		downloader: downloader,
+	}
+}
+
+// NextStart returns when a new download may start and whether it has to wait for it
+func (s *ScheduleService) NextStart(ctx context.Context) (time.Time, bool) {
+	settings, err := s.settings.GetSettings(ctx)
+	if err != nil {
+		return time.Time{}, false
+	}
+	now := time.Now()
+	next := NextDownloadWindow(settings.DownloadWindows, now)
+	return next, next.After(now)
+}
+
+// Schedule puts a new video in the scheduled status until the next download window
+func (s *ScheduleService) Schedule(ctx context.Context, id pgtype.UUID, at time.Time) (database.Video, error) {
+	video, err := s.queries.ScheduleVideo(ctx, database.ScheduleVideoParams{
+		ID:          id,
+		ScheduledAt: pgtype.Timestamptz{Time: at, Valid: true},
+	})
+	if err != nil {
+		return video, err
+	}
+	slog.Info("Scheduled download", "video_id", id.String(), "scheduled_at", at.Format(time.RFC3339))
+	return video, nil
+}
+
+// StartNow starts a scheduled video without waiting for its download window
+func (s *ScheduleService) StartNow(ctx context.Context, id pgtype.UUID) (database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Read under the lock: Check may have started the video in the meantime
+	video, err := s.queries.GetVideo(ctx, id)
+	if err != nil {
+		return video, err
+	}
+	if DownloadStatus(video.DownloadStatus) != StatusScheduled {
+		return video, ErrNotScheduled
+	}
+	return s.start(ctx, video)
+}
+
+func (s *ScheduleService) start(ctx context.Context, video database.Video) (database.Video, error) {
+	var req DownloadRequest
+	if err := json.Unmarshal(video.DownloadOptions, &req); err != nil || req.URL == "" {
+		return video, fmt.Errorf("download options were not stored for this video")
+	}
+	if err := s.downloader.CheckStoredQuota(ctx, video.ID, &req); err != nil {
+		return video, err
+	}
+
+	started, err := s.queries.UpdateVideoStatus(ctx, database.UpdateVideoStatusParams{
+		ID:             video.ID,
+		DownloadStatus: string(StatusDownloading),
+	})
+	if err != nil {
+		return video, err
+	}
+	s.downloader.StartDownload(context.Background(), video.ID, req)
+	return started, nil
+}
+
+// Check starts the scheduled videos if a download window is open, and otherwise moves their start time
+// to the next window, e.g. after the windows were changed
+func (s *ScheduleService) Check(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next, wait := s.NextStart(ctx)
+	if wait {
+		if err := s.queries.RescheduleVideos(ctx, pgtype.Timestamptz{Time: next, Valid: true}); err != nil {
+			slog.Error("Failed to reschedule downloads", "error", err)
+		}
+		return
+	}
+
+	// Scheduled downloads stay scheduled while yt-dlp is replaced and start on a later check
+	if s.downloader.YtdlpUpdating() {
+		return
+	}
+
+	videos, err := s.queries.ListScheduledVideos(ctx)
+	if err != nil {
+		slog.Error("Failed to list scheduled downloads", "error", err)
+		return
+	}
+	for _, video := range videos {
+		if _, err := s.start(ctx, video); err != nil {
+			// Stays scheduled and is retried on the next check, e.g. once disk space was freed
+			slog.Warn("Failed to start scheduled download", "video_id", video.ID.String(), "error", err)
+			continue
+		}
+		slog.Info("Started scheduled download", "video_id", video.ID.String())
+	}
+}
+
+// Run checks the schedule every minute
+func (s *ScheduleService) Run() {
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.Check(context.Background())
+	}
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// windowTime returns 2025-03-10 (a Monday) at the given time in UTC, shifted by days
+func windowTime(days, hour, minute int) time.Time {
+	return time.Date(2025, 3, 10+days, hour, minute, 0, 0, time.UTC)
+}
+
+func TestInDownloadWindow(t *testing.T) {
+	night := []DownloadWindow{{Start: "22:00", End: "06:00"}}
+	tests := []struct {
+		name    string
+		windows []DownloadWindow
+		t       time.Time
+		want    bool
+	}{
+		{"no windows", nil, windowTime(0, 12, 0), true},
+		{"inside a day window", []DownloadWindow{{Start: "09:00", End: "17:00"}}, windowTime(0, 12, 0), true},
+		{"day window start is inclusive", []DownloadWindow{{Start: "09:00", End: "17:00"}}, windowTime(0, 9, 0), true},
+		{"day window end is exclusive", []DownloadWindow{{Start: "09:00", End: "17:00"}}, windowTime(0, 17, 0), false},
+		{"before midnight in a night window", night, windowTime(0, 23, 30), true},
+		{"at midnight in a night window", night, windowTime(0, 0, 0), true},
+		{"after midnight in a night window", night, windowTime(0, 5, 59), true},
+		{"night window end is exclusive", night, windowTime(0, 6, 0), false},
+		{"outside a night window", night, windowTime(0, 12, 0), false},
+		{"second of two windows", []DownloadWindow{{Start: "01:00", End: "02:00"}, {Start: "13:00", End: "14:00"}}, windowTime(0, 13, 30), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := InDownloadWindow(tt.windows, tt.t); got != tt.want {
+				t.Errorf("InDownloadWindow(%v, %s) = %v, want %v", tt.windows, tt.t.Format("15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextDownloadWindow(t *testing.T) {
+	night := []DownloadWindow{{Start: "22:00", End: "06:00"}}
+	tests := []struct {
+		name    string
+		windows []DownloadWindow
+		t       time.Time
+		want    time.Time
+	}{
+		{"no windows", nil, windowTime(0, 12, 0), windowTime(0, 12, 0)},
+		{"inside a window", night, windowTime(0, 23, 0), windowTime(0, 23, 0)},
+		{"inside a window after midnight", night, windowTime(0, 1, 0), windowTime(0, 1, 0)},
+		{"later today", night, windowTime(0, 12, 0), windowTime(0, 22, 0)},
+		{"right after the window closed", night, windowTime(0, 6, 0), windowTime(0, 22, 0)},
+		{"tomorrow", []DownloadWindow{{Start: "02:00", End: "04:00"}}, windowTime(0, 23, 30), windowTime(1, 2, 0)},
+		{"tomorrow across a month end", []DownloadWindow{{Start: "02:00", End: "04:00"}}, time.Date(2025, 3, 31, 23, 0, 0, 0, time.UTC), time.Date(2025, 4, 1, 2, 0, 0, 0, time.UTC)},
+		{"earliest of several", []DownloadWindow{{Start: "20:00", End: "21:00"}, {Start: "14:00", End: "15:00"}}, windowTime(0, 12, 0), windowTime(0, 14, 0)},
+		{"earliest wraps to tomorrow", []DownloadWindow{{Start: "08:00", End: "09:00"}, {Start: "10:00", End: "11:00"}}, windowTime(0, 12, 0), windowTime(1, 8, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NextDownloadWindow(tt.windows, tt.t); !got.Equal(tt.want) {
+				t.Errorf("NextDownloadWindow(%v, %s) = %s, want %s", tt.windows, tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDownloadWindows(t *testing.T) {
+	tests := []struct {
+		windows []DownloadWindow
+		wantErr bool
+	}{
+		{nil, false},
+		{[]DownloadWindow{{Start: "22:00", End: "06:00"}, {Start: "00:00", End: "23:59"}}, false},
+		{[]DownloadWindow{{Start: "24:00", End: "06:00"}}, true},
+		{[]DownloadWindow{{Start: "9:00", End: "17:00"}}, true},
+		{[]DownloadWindow{{Start: "09:00", End: ""}}, true},
+		{[]DownloadWindow{{Start: "09:00", End: "09:00"}}, true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateDownloadWindows(tt.windows); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateDownloadWindows(%v) = %v, want error: %v", tt.windows, err, tt.wantErr)
+		}
+	}
+}
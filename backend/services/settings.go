@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"sync"
 
 	"github.com/Azmekk/Vidra/backend/gen/database"
@@ -14,6 +15,29 @@ type SettingsDTO struct {
 	DefaultAudioCodec string `json:"defaultAudioCodec"`
 	DefaultCrf        int    `json:"defaultCrf"`
 	Theme             string `json:"theme"`
+
+	MaxLibrarySizeGB   float64 `json:"maxLibrarySizeGb"`
+	MinFreeSpaceGB     float64 `json:"minFreeSpaceGb"`
+	DiskWarningPercent int     `json:"diskWarningPercent"`
+
+	FilenameTemplate string `json:"filenameTemplate"`
+
+	TrashRetentionDays int `json:"trashRetentionDays"`
+
+	SponsorBlockAPIURL string `json:"sponsorBlockApiUrl"`
+
+	YtdlpOptions []string `json:"ytdlpOptions"`
+
+	DownloadRateLimit string           `json:"downloadRateLimit"`
+	DownloadWindows   []DownloadWindow `json:"downloadWindows"`
+
+	YtdlpChannel string `json:"ytdlpChannel"`
+	YtdlpVersion string `json:"ytdlpVersion"` // pinned version, empty for the latest of the channel
+
+	YtdlpAutoUpdate bool   `json:"ytdlpAutoUpdate"`
+	YtdlpUpdateTime string `json:"ytdlpUpdateTime"` // HH:MM
+
+	DefaultFormatPolicy FormatPolicy `json:"defaultFormatPolicy"`
 }
 
 type SettingsService struct {
@@ -36,6 +60,29 @@ func mapSettingToDTO(s database.Setting) SettingsDTO {
 		DefaultAudioCodec: s.DefaultAudioCodec,
 		DefaultCrf:        int(s.DefaultCrf),
 		Theme:             s.Theme,
+
+		MaxLibrarySizeGB:   s.MaxLibrarySizeGb,
+		MinFreeSpaceGB:     s.MinFreeSpaceGb,
+		DiskWarningPercent: int(s.DiskWarningPercent),
+
+		FilenameTemplate: s.FilenameTemplate,
+
+		TrashRetentionDays: int(s.TrashRetentionDays),
+
+		SponsorBlockAPIURL: s.SponsorblockApiUrl,
+
+		YtdlpOptions: s.YtdlpOptions,
+
+		DownloadRateLimit: s.DownloadRateLimit,
+		DownloadWindows:   parseDownloadWindows(s.DownloadWindows),
+
+		YtdlpChannel: s.YtdlpChannel,
+		YtdlpVersion: s.YtdlpVersion,
+
+		YtdlpAutoUpdate: s.YtdlpAutoUpdate,
+		YtdlpUpdateTime: s.YtdlpUpdateTime,
+
+		DefaultFormatPolicy: parseFormatPolicy(s.DefaultFormatPolicy),
 	}
 }
 
@@ -84,6 +131,171 @@ func (s *SettingsService) UpdateSettings(ctx context.Context, dto SettingsDTO) (
 	return result, nil
 }
 
+// UpdateStorageSettings updates only the disk quota settings
+func (s *SettingsService) UpdateStorageSettings(ctx context.Context, dto SettingsDTO) (SettingsDTO, error) {
+	setting, err := s.queries.UpdateStorageSettings(ctx, database.UpdateStorageSettingsParams{
+		MaxLibrarySizeGb:   dto.MaxLibrarySizeGB,
+		MinFreeSpaceGb:     dto.MinFreeSpaceGB,
+		DiskWarningPercent: int32(dto.DiskWarningPercent),
+	})
+	if err != nil {
+		return SettingsDTO{}, err
+	}
+
+	result := mapSettingToDTO(setting)
+
+	s.mu.Lock()
+	s.cache = &result
+	s.mu.Unlock()
+
+	return result, nil
+}
+
+// UpdateLibrarySettings updates only the library layout settings
+func (s *SettingsService) UpdateLibrarySettings(ctx context.Context, dto SettingsDTO) (SettingsDTO, error) {
+	setting, err := s.queries.UpdateLibrarySettings(ctx, dto.FilenameTemplate)
+	if err != nil {
+		return SettingsDTO{}, err
+	}
+
+	result := mapSettingToDTO(setting)
+
+	s.mu.Lock()
+	s.cache = &result
+	s.mu.Unlock()
+
+	return result, nil
+}
+
+// UpdateTrashSettings updates only the trash auto-purge setting
+func (s *SettingsService) UpdateTrashSettings(ctx context.Context, dto SettingsDTO) (SettingsDTO, error) {
+	setting, err := s.queries.UpdateTrashSettings(ctx, int32(dto.TrashRetentionDays))
+	if err != nil {
+		return SettingsDTO{}, err
+	}
+
+	result := mapSettingToDTO(setting)
+
+	s.mu.Lock()
+	s.cache = &result
+	s.mu.Unlock()
+
+	return result, nil
+}
+
+// UpdateSponsorBlockSettings updates only the SponsorBlock API host
+func (s *SettingsService) UpdateSponsorBlockSettings(ctx context.Context, dto SettingsDTO) (SettingsDTO, error) {
+	setting, err := s.queries.UpdateSponsorBlockSettings(ctx, dto.SponsorBlockAPIURL)
+	if err != nil {
+		return SettingsDTO{}, err
+	}
+
+	result := mapSettingToDTO(setting)
+
+	s.mu.Lock()
+	s.cache = &result
+	s.mu.Unlock()
+
+	return result, nil
+}
+
+// UpdateYtdlpOptionsSettings updates only the extra yt-dlp options added to every download
+func (s *SettingsService) UpdateYtdlpOptionsSettings(ctx context.Context, dto SettingsDTO) (SettingsDTO, error) {
+	setting, err := s.queries.UpdateYtdlpOptionsSettings(ctx, dto.YtdlpOptions)
+	if err != nil {
+		return SettingsDTO{}, err
+	}
+
+	result := mapSettingToDTO(setting)
+
+	s.mu.Lock()
+	s.cache = &result
+	s.mu.Unlock()
+
+	return result, nil
+}
+
+// UpdateDownloadSettings updates only the download rate limit and windows
+func (s *SettingsService) UpdateDownloadSettings(ctx context.Context, dto SettingsDTO) (SettingsDTO, error) {
+	windows, err := json.Marshal(dto.DownloadWindows)
+	if err != nil {
+		return SettingsDTO{}, err
+	}
+	setting, err := s.queries.UpdateDownloadSettings(ctx, database.UpdateDownloadSettingsParams{
+		DownloadRateLimit: dto.DownloadRateLimit,
+		DownloadWindows:   windows,
+	})
+	if err != nil {
+		return SettingsDTO{}, err
+	}
+
+	result := mapSettingToDTO(setting)
+
+	s.mu.Lock()
+	s.cache = &result
+	s.mu.Unlock()
+
+	return result, nil
+}
+
+// UpdateYtdlpVersionSettings updates only the yt-dlp release channel and pinned version
+func (s *SettingsService) UpdateYtdlpVersionSettings(ctx context.Context, dto SettingsDTO) (SettingsDTO, error) {
+	setting, err := s.queries.UpdateYtdlpVersionSettings(ctx, database.UpdateYtdlpVersionSettingsParams{
+		YtdlpChannel: dto.YtdlpChannel,
+		YtdlpVersion: dto.YtdlpVersion,
+	})
+	if err != nil {
+		return SettingsDTO{}, err
+	}
+
+	result := mapSettingToDTO(setting)
+
+	s.mu.Lock()
+	s.cache = &result
+	s.mu.Unlock()
+
+	return result, nil
+}
+
+// UpdateYtdlpAutoUpdateSettings updates only the automatic yt-dlp update schedule
+func (s *SettingsService) UpdateYtdlpAutoUpdateSettings(ctx context.Context, dto SettingsDTO) (SettingsDTO, error) {
+	setting, err := s.queries.UpdateYtdlpAutoUpdateSettings(ctx, database.UpdateYtdlpAutoUpdateSettingsParams{
+		YtdlpAutoUpdate: dto.YtdlpAutoUpdate,
+		YtdlpUpdateTime: dto.YtdlpUpdateTime,
+	})
+	if err != nil {
+		return SettingsDTO{}, err
+	}
+
+	result := mapSettingToDTO(setting)
+
+	s.mu.Lock()
+	s.cache = &result
+	s.mu.Unlock()
+
+	return result, nil
+}
+
+// UpdateFormatPolicySettings updates only the default format policy
+func (s *SettingsService) UpdateFormatPolicySettings(ctx context.Context, dto SettingsDTO) (SettingsDTO, error) {
+	policy, err := json.Marshal(dto.DefaultFormatPolicy)
+	if err != nil {
+		return SettingsDTO{}, err
+	}
+	setting, err := s.queries.UpdateFormatPolicySettings(ctx, policy)
+	if err != nil {
+		return SettingsDTO{}, err
+	}
+
+	result := mapSettingToDTO(setting)
+
+	s.mu.Lock()
+	s.cache = &result
+	s.mu.Unlock()
+
+	return result, nil
+}
+
 func (s *SettingsService) GetProxyURL(ctx context.Context) string {
 	settings, err := s.GetSettings(ctx)
 	if err != nil {
@@ -91,3 +303,39 @@ func (s *SettingsService) GetProxyURL(ctx context.Context) string {
 	}
 	return settings.ProxyUrl
 }
+
+// GetSponsorBlockAPIURL returns the configured SponsorBlock API, or "" for yt-dlp's default
+func (s *SettingsService) GetSponsorBlockAPIURL(ctx context.Context) string {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return ""
+	}
+	return settings.SponsorBlockAPIURL
+}
+
+// GetYtdlpOptions returns the extra yt-dlp options added to every download
+func (s *SettingsService) GetYtdlpOptions(ctx context.Context) []string {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return nil
+	}
+	return settings.YtdlpOptions
+}
+
+// GetDefaultFormatPolicy returns the format policy of downloads without their own, zero if none is set
+func (s *SettingsService) GetDefaultFormatPolicy(ctx context.Context) FormatPolicy {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return FormatPolicy{}
+	}
+	return settings.DefaultFormatPolicy
+}
+
+// GetDownloadRateLimit returns the global yt-dlp rate limit, or "" for none
+func (s *SettingsService) GetDownloadRateLimit(ctx context.Context) string {
+	settings, err := s.GetSettings(ctx)
+	if err != nil {
+		return ""
+	}
+	return settings.DownloadRateLimit
+}
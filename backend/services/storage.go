@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DownloadsDir is the local working directory. Jobs always download and encode here;
+// finished files are then handed to the configured Storage.
+const DownloadsDir = "downloads"
+
+const (
+	StorageBackendLocal = "local"
+	StorageBackendS3    = "s3"
+)
+
+type StorageObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage is where finished videos and thumbnails live. Keys are slash-separated paths relative to the
+// library root, which is what the videos table stores as file_name and thumbnail_file_name.
+// Missing keys are reported with errors matching fs.ErrNotExist.
+type Storage interface {
+	// Put moves the local file at srcPath into storage under key
+	Put(ctx context.Context, key string, srcPath string) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (StorageObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	// Move renames an object within storage
+	Move(ctx context.Context, srcKey, dstKey string) error
+	// List returns every object whose key starts with prefix
+	List(ctx context.Context, prefix string) ([]StorageObjectInfo, error)
+	// URL returns a URL clients can use to fetch the object
+	URL(ctx context.Context, key string) (string, error)
+}
+
+// NewStorageFromEnv creates the storage backend selected by STORAGE_BACKEND (local or s3)
+func NewStorageFromEnv(ctx context.Context) (Storage, error) {
+	backend := strings.ToLower(os.Getenv("STORAGE_BACKEND"))
+	switch backend {
+	case "", StorageBackendLocal:
+		return NewLocalStorage(DownloadsDir), nil
+	case StorageBackendS3:
+		return NewS3StorageFromEnv(ctx)
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q: must be local or s3", backend)
+	}
+}
+
+// LocalStorage keeps files in a directory on disk, served at /downloads/ by nginx (or by the backend in dev mode)
+type LocalStorage struct {
+	root string
+}
+
+func NewLocalStorage(root string) *LocalStorage {
+	return &LocalStorage{root: root}
+}
+
+func (s *LocalStorage) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, srcPath string) error {
+	dst := s.path(key)
+	if filepath.Clean(srcPath) == filepath.Clean(dst) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(srcPath, dst); err == nil {
+		return nil
+	}
+	// Rename fails across filesystems
+	if err := copyFile(srcPath, dst); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(srcPath)
+}
+
+func (s *LocalStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(s.path(key))
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (StorageObjectInfo, error) {
+	info, err := os.Stat(s.path(key))
+	if err != nil {
+		return StorageObjectInfo{}, err
+	}
+	return StorageObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(s.path(key)); err != nil {
+		return err
+	}
+	s.removeEmptyParents(key)
+	return nil
+}
+
+func (s *LocalStorage) Move(ctx context.Context, srcKey, dstKey string) error {
+	if err := s.Put(ctx, dstKey, s.path(srcKey)); err != nil {
+		return err
+	}
+	s.removeEmptyParents(srcKey)
+	return nil
+}
+
+// removeEmptyParents removes the directories of key that became empty, up to the root
+func (s *LocalStorage) removeEmptyParents(key string) {
+	for dir := path.Dir(key); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if err := os.Remove(s.path(dir)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *LocalStorage) List(ctx context.Context, prefix string) ([]StorageObjectInfo, error) {
+	var objects []StorageObjectInfo
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return nil
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		objects = append(objects, StorageObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return objects, nil
+	}
+	return objects, err
+}
+
+func (s *LocalStorage) URL(ctx context.Context, key string) (string, error) {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return path.Join("/downloads", strings.Join(segments, "/")), nil
+}
+
+// LocalPath returns the file a key is stored at, for tools like ffprobe that read files directly
+func (s *LocalStorage) LocalPath(key string) string {
+	return s.path(key)
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const defaultPresignExpiry = time.Hour
+
+// s3MaxCopySize is the largest object S3 copies in a single CopyObject request
+var s3MaxCopySize int64 = 5 << 30
+
+// S3Storage stores files in an S3-compatible bucket (AWS S3, MinIO, ...) and serves them through presigned URLs
+type S3Storage struct {
+	client        *minio.Client
+	bucket        string
+	presignExpiry time.Duration
+}
+
+// NewS3StorageFromEnv configures S3Storage from S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY, S3_SECRET_KEY,
+// S3_REGION, S3_USE_SSL and S3_PRESIGN_EXPIRY. The bucket is created if it does not exist.
+func NewS3StorageFromEnv(ctx context.Context) (*S3Storage, error) {
+	endpoint := os.Getenv("S3_ENDPOINT")
+	bucket := os.Getenv("S3_BUCKET")
+	if endpoint == "" || bucket == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required when STORAGE_BACKEND=s3")
+	}
+
+	useSSL := true
+	if v := os.Getenv("S3_USE_SSL"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3_USE_SSL: %w", err)
+		}
+		useSSL = parsed
+	}
+
+	presignExpiry := defaultPresignExpiry
+	if v := os.Getenv("S3_PRESIGN_EXPIRY"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3_PRESIGN_EXPIRY: %w", err)
+		}
+		presignExpiry = parsed
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"), ""),
+		Secure: useSSL,
+		Region: os.Getenv("S3_REGION"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %s: %w", bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: os.Getenv("S3_REGION")}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket %s: %w", bucket, err)
+		}
+	}
+
+	return &S3Storage{client: client, bucket: bucket, presignExpiry: presignExpiry}, nil
+}
+
+// notFound maps S3's missing-key errors onto fs.ErrNotExist
+func (s *S3Storage) notFound(key string, err error) error {
+	code := minio.ToErrorResponse(err).Code
+	if code == "NoSuchKey" || code == "NotFound" {
+		return fmt.Errorf("%w: %s", fs.ErrNotExist, key)
+	}
+	return err
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, srcPath string) error {
+	opts := minio.PutObjectOptions{ContentType: mime.TypeByExtension(filepath.Ext(key))}
+	if _, err := s.client.FPutObject(ctx, s.bucket, key, srcPath, opts); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return os.Remove(srcPath)
+}
+
+func (s *S3Storage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	// GetObject is lazy, stat first so a missing key is reported here rather than on the first read
+	if _, err := s.Stat(ctx, key); err != nil {
+		return nil, err
+	}
+	return s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+}
+
+func (s *S3Storage) Stat(ctx context.Context, key string) (StorageObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return StorageObjectInfo{}, s.notFound(key, err)
+	}
+	return StorageObjectInfo{Key: key, Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return s.notFound(key, err)
+	}
+	return nil
+}
+
+// Move copies the object on the server and deletes the source once the copy succeeded
+func (s *S3Storage) Move(ctx context.Context, srcKey, dstKey string) error {
+	info, err := s.Stat(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	src := minio.CopySrcOptions{Bucket: s.bucket, Object: srcKey}
+	dst := minio.CopyDestOptions{Bucket: s.bucket, Object: dstKey}
+	if info.Size > s3MaxCopySize {
+		// A single copy request is limited to 5 GiB, larger objects are copied part by part
+		_, err = s.client.ComposeObject(ctx, dst, src)
+	} else {
+		_, err = s.client.CopyObject(ctx, dst, src)
+	}
+	if err != nil {
+		return s.notFound(srcKey, err)
+	}
+	return s.Delete(ctx, srcKey)
+}
+
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]StorageObjectInfo, error) {
+	var objects []StorageObjectInfo
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		objects = append(objects, StorageObjectInfo{Key: obj.Key, Size: obj.Size, ModTime: obj.LastModified})
+	}
+	return objects, nil
+}
+
+func (s *S3Storage) URL(ctx context.Context, key string) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, s.presignExpiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
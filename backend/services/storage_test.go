@@ -0,0 +1,392 @@
+package services
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// fakeS3 is an in-memory S3 server with just enough of the API for S3Storage: path-style object
+// PUT, copy, HEAD, GET and DELETE, multipart copies and ListObjectsV2 without delimiters
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte // upload ID -> part number -> data
+	copies  int                       // single-request copies served
+	modTime time.Time
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if key == "" {
+		if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+			f.list(w, bucket, r.URL.Query().Get("prefix"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.URL.Query().Has("uploads") || r.URL.Query().Has("uploadId") {
+		f.multipart(w, r, key)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if src := r.Header.Get("X-Amz-Copy-Source"); src != "" {
+			src, _ = url.PathUnescape(src)
+			_, srcKey, _ := strings.Cut(strings.TrimPrefix(src, "/"), "/")
+			data, ok := f.objects[srcKey]
+			if !ok {
+				f.notFound(w, srcKey)
+				return
+			}
+			f.objects[key] = data
+			f.copies++
+			w.Header().Set("Content-Type", "application/xml")
+			io.WriteString(w, `<CopyObjectResult><ETag>"etag"</ETag><LastModified>`+f.modTime.Format(time.RFC3339)+`</LastModified></CopyObjectResult>`)
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.objects[key] = data
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodHead, http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			f.notFound(w, key)
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", f.modTime.Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// multipart serves CreateMultipartUpload, UploadPartCopy and CompleteMultipartUpload
+func (f *fakeS3) multipart(w http.ResponseWriter, r *http.Request, key string) {
+	w.Header().Set("Content-Type", "application/xml")
+	uploadID := r.URL.Query().Get("uploadId")
+	switch {
+	case r.Method == http.MethodPost && uploadID == "":
+		uploadID = strconv.Itoa(len(f.uploads) + 1)
+		f.uploads[uploadID] = make(map[int][]byte)
+		io.WriteString(w, `<InitiateMultipartUploadResult><Bucket>vidra</Bucket><Key>`+key+`</Key><UploadId>`+uploadID+`</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == http.MethodPut:
+		src, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		_, srcKey, _ := strings.Cut(strings.TrimPrefix(src, "/"), "/")
+		data, ok := f.objects[srcKey]
+		if !ok {
+			f.notFound(w, srcKey)
+			return
+		}
+		var start, end int
+		fmt.Sscanf(r.Header.Get("X-Amz-Copy-Source-Range"), "bytes=%d-%d", &start, &end)
+		part, _ := strconv.Atoi(r.URL.Query().Get("partNumber"))
+		f.uploads[uploadID][part] = data[start : end+1]
+		io.WriteString(w, `<CopyPartResult><ETag>"part"</ETag><LastModified>`+f.modTime.Format(time.RFC3339)+`</LastModified></CopyPartResult>`)
+	case r.Method == http.MethodPost:
+		var data []byte
+		for part := 1; part <= len(f.uploads[uploadID]); part++ {
+			data = append(data, f.uploads[uploadID][part]...)
+		}
+		f.objects[key] = data
+		delete(f.uploads, uploadID)
+		io.WriteString(w, `<CompleteMultipartUploadResult><Bucket>vidra</Bucket><Key>`+key+`</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) notFound(w http.ResponseWriter, key string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusNotFound)
+	io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message><Key>`+key+`</Key></Error>`)
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, bucket, prefix string) {
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int64
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		MaxKeys     int
+		IsTruncated bool
+		Contents    []content
+	}{Name: bucket, Prefix: prefix, MaxKeys: 1000}
+	for key, data := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			result.Contents = append(result.Contents, content{Key: key, LastModified: f.modTime.Format(time.RFC3339), ETag: `"etag"`, Size: int64(len(data))})
+		}
+	}
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	result.KeyCount = len(result.Contents)
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func newTestS3Storage(t *testing.T) Storage {
+	storage, _ := newFakeS3Storage(t)
+	return storage
+}
+
+func newFakeS3Storage(t *testing.T) (*S3Storage, *fakeS3) {
+	fake := &fakeS3{objects: make(map[string][]byte), uploads: make(map[string]map[int][]byte), modTime: time.Now().UTC().Truncate(time.Second)}
+	server := httptest.NewTLSServer(fake)
+	t.Cleanup(server.Close)
+
+	// Over TLS minio-go sends plain payloads rather than aws-chunked ones, which keeps the fake simple
+	client, err := minio.New(strings.TrimPrefix(server.URL, "https://"), &minio.Options{
+		Creds:     credentials.NewStaticV4("access", "secret", ""),
+		Secure:    true,
+		Region:    "us-east-1",
+		Transport: server.Client().Transport,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &S3Storage{client: client, bucket: "vidra", presignExpiry: defaultPresignExpiry}, fake
+}
+
+func newTestLocalStorage(t *testing.T) Storage {
+	return NewLocalStorage(t.TempDir())
+}
+
+var storageBackends = []struct {
+	name string
+	new  func(t *testing.T) Storage
+}{
+	{"local", newTestLocalStorage},
+	{"s3", newTestS3Storage},
+}
+
+// writeTempFile creates a local file to hand to Storage.Put
+func writeTempFile(t *testing.T, content string) string {
+	p := filepath.Join(t.TempDir(), "upload")
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func readKey(t *testing.T, storage Storage, key string) string {
+	r, err := storage.Open(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Open(%q): %v", key, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading %q: %v", key, err)
+	}
+	return string(data)
+}
+
+func listKeys(t *testing.T, storage Storage, prefix string) []string {
+	objects, err := storage.List(context.Background(), prefix)
+	if err != nil {
+		t.Fatalf("List(%q): %v", prefix, err)
+	}
+	keys := []string{}
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestStorage(t *testing.T) {
+	for _, backend := range storageBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := backend.new(t)
+
+			src := writeTempFile(t, "video data")
+			if err := storage.Put(ctx, "Channel/Video.mp4", src); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			if _, err := os.Stat(src); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Put left the source file behind: %v", err)
+			}
+			if err := storage.Put(ctx, "Channel/Video.jpg", writeTempFile(t, "jpg")); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			if err := storage.Put(ctx, "Other.mkv", writeTempFile(t, "other")); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+
+			info, err := storage.Stat(ctx, "Channel/Video.mp4")
+			if err != nil {
+				t.Fatalf("Stat: %v", err)
+			}
+			if info.Key != "Channel/Video.mp4" || info.Size != int64(len("video data")) {
+				t.Errorf("Stat = %+v, want key Channel/Video.mp4 and size %d", info, len("video data"))
+			}
+			if got := readKey(t, storage, "Channel/Video.mp4"); got != "video data" {
+				t.Errorf("Open read %q, want %q", got, "video data")
+			}
+
+			if got, want := listKeys(t, storage, ""), []string{"Channel/Video.jpg", "Channel/Video.mp4", "Other.mkv"}; strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("List(\"\") = %v, want %v", got, want)
+			}
+			if got, want := listKeys(t, storage, "Channel/"), []string{"Channel/Video.jpg", "Channel/Video.mp4"}; strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("List(\"Channel/\") = %v, want %v", got, want)
+			}
+
+			if err := storage.Move(ctx, "Channel/Video.mp4", "Moved/Video (1).mp4"); err != nil {
+				t.Fatalf("Move: %v", err)
+			}
+			if _, err := storage.Stat(ctx, "Channel/Video.mp4"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Stat of moved source = %v, want fs.ErrNotExist", err)
+			}
+			if got := readKey(t, storage, "Moved/Video (1).mp4"); got != "video data" {
+				t.Errorf("Open of moved key read %q, want %q", got, "video data")
+			}
+
+			if err := storage.Delete(ctx, "Channel/Video.jpg"); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if got, want := listKeys(t, storage, ""), []string{"Moved/Video (1).mp4", "Other.mkv"}; strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("List after Delete = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestStorageMissingKeys(t *testing.T) {
+	for _, backend := range storageBackends {
+		storage := backend.new(t)
+		ctx := context.Background()
+
+		tests := []struct {
+			name string
+			call func() error
+		}{
+			{"Stat", func() error { _, err := storage.Stat(ctx, "missing.mp4"); return err }},
+			{"Open", func() error {
+				r, err := storage.Open(ctx, "missing.mp4")
+				if err == nil {
+					r.Close()
+				}
+				return err
+			}},
+			{"Move", func() error { return storage.Move(ctx, "missing.mp4", "elsewhere.mp4") }},
+		}
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				if err := tt.call(); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("%s of a missing key = %v, want fs.ErrNotExist", tt.name, err)
+				}
+			})
+		}
+	}
+}
+
+func TestLocalStorageDelete(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	storage := NewLocalStorage(root)
+
+	if err := storage.Put(ctx, "a/b/video.mp4", writeTempFile(t, "data")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := storage.Delete(ctx, "a/b/video.mp4"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Delete left empty parent directories behind: %v", err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Errorf("Delete removed the storage root: %v", err)
+	}
+	if err := storage.Delete(ctx, "a/b/video.mp4"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Delete of a missing key = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestLocalStorageURL(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"video.mp4", "/downloads/video.mp4"},
+		{"Channel/My Video #1.mp4", "/downloads/Channel/My%20Video%20%231.mp4"},
+		{"a/b?c.mp4", "/downloads/a/b%3Fc.mp4"},
+	}
+	storage := NewLocalStorage(t.TempDir())
+	for _, tt := range tests {
+		got, err := storage.URL(context.Background(), tt.key)
+		if err != nil {
+			t.Fatalf("URL(%q): %v", tt.key, err)
+		}
+		if got != tt.want {
+			t.Errorf("URL(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestS3StorageMoveLargeObject(t *testing.T) {
+	// Pretend the object is above the single-request copy limit
+	defer func(size int64) { s3MaxCopySize = size }(s3MaxCopySize)
+	s3MaxCopySize = 4
+
+	ctx := context.Background()
+	storage, fake := newFakeS3Storage(t)
+	if err := storage.Put(ctx, "big.mkv", writeTempFile(t, "large video")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := storage.Move(ctx, "big.mkv", ".trash/big.mkv"); err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+	if fake.copies != 0 {
+		t.Errorf("Move used %d single-request copies, want a multipart copy", fake.copies)
+	}
+	if got := readKey(t, storage, ".trash/big.mkv"); got != "large video" {
+		t.Errorf("Open of moved key read %q, want %q", got, "large video")
+	}
+	if _, err := storage.Stat(ctx, "big.mkv"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat of moved source = %v, want fs.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxSubtitleTextBytes caps the text indexed per video, keeping the search document well below
+// Postgres' 1MB tsvector limit
+const maxSubtitleTextBytes = 256 * 1024
+
+var subtitleExtensions = map[string]bool{".vtt": true, ".srt": true}
+
+var (
+	subtitleTimingRegex = regexp.MustCompile(`^\d{1,2}:\d{2}(:\d{2})?[.,]\d{3}\s+-->`)
+	subtitleTagRegex    = regexp.MustCompile(`<[^>]*>`)
+)
+
+// FindSubtitleFiles returns the subtitle files written next to a file with the given path minus
+// extension, e.g. "<base>.vtt" or "<base>.en.srt"
+func FindSubtitleFiles(base string) []string {
+	entries, err := os.ReadDir(filepath.Dir(base))
+	if err != nil {
+		return nil
+	}
+	prefix := filepath.Base(base) + "."
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		if subtitleExtensions[strings.ToLower(filepath.Ext(e.Name()))] {
+			files = append(files, filepath.Join(filepath.Dir(base), e.Name()))
+		}
+	}
+	return files
+}
+
+// ReadSubtitleText extracts the spoken text from WebVTT and SRT files, dropping headers, cue numbers,
+// timings, markup and the repeated lines of auto-generated captions
+func ReadSubtitleText(paths []string) string {
+	var b strings.Builder
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		previous := ""
+		for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || line == "WEBVTT" || subtitleTimingRegex.MatchString(line) || isCueNumber(line) ||
+				strings.HasPrefix(line, "Kind:") || strings.HasPrefix(line, "Language:") ||
+				strings.HasPrefix(line, "NOTE") || strings.HasPrefix(line, "STYLE") {
+				continue
+			}
+			line = strings.TrimSpace(subtitleTagRegex.ReplaceAllString(line, ""))
+			if line == "" || line == previous {
+				continue
+			}
+			previous = line
+
+			if b.Len()+len(line)+1 > maxSubtitleTextBytes {
+				return b.String()
+			}
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+func isCueNumber(line string) bool {
+	for _, r := range line {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
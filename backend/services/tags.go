@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const maxTagLength = 64
+
+// NormalizeTags trims and lowercases tag names and drops duplicates and empty names,
+// so "Music" and " music" are the same tag
+func NormalizeTags(names []string) ([]string, error) {
+	seen := make(map[string]bool)
+	tags := []string{}
+	for _, name := range names {
+		tag := strings.ToLower(strings.TrimSpace(name))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, maxTagLength)
+		}
+		if strings.Contains(tag, ",") {
+			return nil, fmt.Errorf("tag %q must not contain commas", tag)
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+type TagService struct {
+	queries *database.Queries
+}
+
+func NewTagService(queries *database.Queries) *TagService {
+	return &TagService{queries: queries}
+}
+
+// ensureTags creates the tags that do not exist yet and returns the IDs of all of them
+func (s *TagService) ensureTags(ctx context.Context, names []string) ([]pgtype.UUID, error) {
+	ids := make([]pgtype.UUID, 0, len(names))
+	for _, name := range names {
+		tag, err := s.queries.UpsertTag(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, tag.ID)
+	}
+	return ids, nil
+}
+
+// SetVideoTags replaces the tags of a video. Names must already be normalized.
+func (s *TagService) SetVideoTags(ctx context.Context, videoID pgtype.UUID, names []string) error {
+	tagIDs, err := s.ensureTags(ctx, names)
+	if err != nil {
+		return err
+	}
+	if err := s.queries.ClearVideoTags(ctx, videoID); err != nil {
+		return err
+	}
+	if len(tagIDs) == 0 {
+		return nil
+	}
+	return s.queries.AddVideoTags(ctx, database.AddVideoTagsParams{
+		VideoIds: []pgtype.UUID{videoID},
+		TagIds:   tagIDs,
+	})
+}
+
+// BulkUpdate adds and removes tags on many videos at once. Names must already be normalized.
+func (s *TagService) BulkUpdate(ctx context.Context, videoIDs []pgtype.UUID, add, remove []string) error {
+	if len(videoIDs) == 0 {
+		return nil
+	}
+
+	if len(add) > 0 {
+		tagIDs, err := s.ensureTags(ctx, add)
+		if err != nil {
+			return err
+		}
+		if err := s.queries.AddVideoTags(ctx, database.AddVideoTagsParams{VideoIds: videoIDs, TagIds: tagIDs}); err != nil {
+			return err
+		}
+	}
+
+	if len(remove) > 0 {
+		tags, err := s.queries.ListTagsByName(ctx, remove)
+		if err != nil {
+			return err
+		}
+		tagIDs := make([]pgtype.UUID, len(tags))
+		for i, t := range tags {
+			tagIDs[i] = t.ID
+		}
+		if len(tagIDs) > 0 {
+			if err := s.queries.RemoveVideoTags(ctx, database.RemoveVideoTagsParams{VideoIds: videoIDs, TagIds: tagIDs}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// TagsForVideos returns the tag names of each video, keyed by video ID
+func (s *TagService) TagsForVideos(ctx context.Context, videoIDs []pgtype.UUID) (map[string][]string, error) {
+	tags := make(map[string][]string)
+	if len(videoIDs) == 0 {
+		return tags, nil
+	}
+	rows, err := s.queries.ListTagsForVideos(ctx, videoIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		id := row.VideoID.String()
+		tags[id] = append(tags[id], row.Name)
+	}
+	return tags, nil
+}
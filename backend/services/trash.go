@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// TrashPrefix is where trashed files are moved to, i.e. downloads/.trash/ with local storage
+	TrashPrefix = ".trash/"
+
+	trashPurgeInterval = time.Hour
+)
+
+var (
+	// ErrAlreadyTrashed is returned when trashing a video that is already in the trash
+	ErrAlreadyTrashed = errors.New("video is already in the trash")
+	// ErrNotTrashed is returned when restoring a video that is not in the trash
+	ErrNotTrashed = errors.New("video is not in the trash")
+)
+
+// TrashService soft-deletes videos: their files move under TrashPrefix and the row gets deleted_at.
+// Trashed videos are purged for good after the configured number of days.
+type TrashService struct {
+	queries    *database.Queries
+	settings   *SettingsService
+	downloader *DownloaderService
+}
+
+func NewTrashService(queries *database.Queries, settings *SettingsService, downloader *DownloaderService) *TrashService {
+	return &TrashService{
+		queries:    queries,
+		settings:   settings,
+		downloader: downloader,
+	}
+}
+
+// Trash moves a video and its files to the trash
+func (s *TrashService) Trash(ctx context.Context, video database.Video) (database.Video, error) {
+	if video.DeletedAt.Valid {
+		return video, ErrAlreadyTrashed
+	}
+	if s.downloader.IsRunning(video.ID.String()) {
+		return video, ErrJobRunning
+	}
+
+	moved, release, err := s.moveFiles(ctx, video, func(key string) string { return TrashPrefix + key })
+	if err != nil {
+		return video, err
+	}
+	defer release()
+
+	trashed, err := s.queries.TrashVideo(ctx, database.TrashVideoParams{
+		ID:                video.ID,
+		FileName:          moved.file,
+		ThumbnailFileName: moved.thumbnail,
+		SpriteFileName:    moved.sprite,
+	})
+	if err != nil {
+		s.moveBack(ctx, video, moved)
+		return video, err
+	}
+
+	slog.Info("Moved video to trash", "video_id", video.ID.String())
+	s.downloader.ws.Broadcast(WsEventVideoDeleted, map[string]interface{}{"id": video.ID.String(), "permanent": false})
+	return trashed, nil
+}
+
+// Restore moves a trashed video back into the library. Files go back to their old keys, or get a
+// " (n)" suffix if another video took the key in the meantime.
+func (s *TrashService) Restore(ctx context.Context, video database.Video) (database.Video, error) {
+	if !video.DeletedAt.Valid {
+		return video, ErrNotTrashed
+	}
+
+	moved, release, err := s.moveFiles(ctx, video, func(key string) string { return strings.TrimPrefix(key, TrashPrefix) })
+	if err != nil {
+		return video, err
+	}
+	defer release()
+
+	restored, err := s.queries.RestoreVideo(ctx, database.RestoreVideoParams{
+		ID:                video.ID,
+		FileName:          moved.file,
+		ThumbnailFileName: moved.thumbnail,
+		SpriteFileName:    moved.sprite,
+	})
+	if err != nil {
+		s.moveBack(ctx, video, moved)
+		return video, err
+	}
+
+	slog.Info("Restored video from trash", "video_id", video.ID.String())
+	return restored, nil
+}
+
+// videoFiles are the storage keys of a video that move in and out of the trash together
+type videoFiles struct {
+	file, thumbnail, sprite pgtype.Text
+}
+
+func filesOf(video database.Video) videoFiles {
+	return videoFiles{file: video.FileName, thumbnail: video.ThumbnailFileName, sprite: video.SpriteFileName}
+}
+
+func (f *videoFiles) keys() []*pgtype.Text {
+	return []*pgtype.Text{&f.file, &f.thumbnail, &f.sprite}
+}
+
+// moveFiles moves the video file, thumbnail and sprite sheet to the free key closest to target(key).
+// Missing files are skipped. If a move fails, files already moved are put back. The new keys stay reserved
+// until release is called, which must happen after the row has been updated.
+func (s *TrashService) moveFiles(ctx context.Context, video database.Video, target func(string) string) (videoFiles, func(), error) {
+	moved := filesOf(video)
+	var releases []func()
+	release := func() {
+		for _, r := range releases {
+			r()
+		}
+	}
+	for _, key := range moved.keys() {
+		if !key.Valid || key.String == "" {
+			continue
+		}
+		dst, releaseKey := s.downloader.layout.ReserveKey(ctx, target(key.String))
+		releases = append(releases, releaseKey)
+		err := s.downloader.storage.Move(ctx, key.String, dst)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			s.moveBack(ctx, video, moved)
+			release()
+			return filesOf(video), func() {}, err
+		}
+		*key = pgtype.Text{String: dst, Valid: true}
+	}
+	return moved, release, nil
+}
+
+// moveBack undoes moveFiles after a later step failed
+func (s *TrashService) moveBack(ctx context.Context, video database.Video, moved videoFiles) {
+	original := filesOf(video)
+	originalKeys := original.keys()
+	for i, key := range moved.keys() {
+		if key.String == originalKeys[i].String {
+			continue
+		}
+		if err := s.downloader.storage.Move(ctx, key.String, originalKeys[i].String); err != nil {
+			slog.Error("Failed to move file back", "video_id", video.ID.String(), "from", key.String, "to", originalKeys[i].String, "error", err)
+		}
+	}
+}
+
+// PurgeExpired permanently deletes videos that have been in the trash longer than the configured retention
+func (s *TrashService) PurgeExpired(ctx context.Context) (int, error) {
+	settings, err := s.settings.GetSettings(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if settings.TrashRetentionDays <= 0 {
+		return 0, nil
+	}
+
+	before := time.Now().AddDate(0, 0, -settings.TrashRetentionDays)
+	videos, err := s.queries.ListExpiredTrash(ctx, pgtype.Timestamptz{Time: before, Valid: true})
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, v := range videos {
+		if err := s.downloader.DeleteVideo(ctx, v); err != nil {
+			slog.Error("Failed to purge trashed video", "video_id", v.ID.String(), "error", err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// Run is the background janitor that empties expired trash periodically
+func (s *TrashService) Run() {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := s.PurgeExpired(context.Background())
+		if err != nil {
+			slog.Error("Trash purge failed", "error", err)
+			continue
+		}
+		if purged > 0 {
+			slog.Info("Trash purge finished", "purged", purged)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// DefaultViewer owns the playback state of requests that do not name a viewer
+	DefaultViewer = "default"
+
+	// watchedThreshold is the share of a video after which it counts as watched
+	watchedThreshold = 0.9
+)
+
+type WatchProgressDTO struct {
+	Position      float64 `json:"position"` // seconds
+	Watched       bool    `json:"watched"`
+	LastWatchedAt string  `json:"lastWatchedAt,omitempty"`
+}
+
+func MapWatchProgress(p database.WatchProgress) WatchProgressDTO {
+	return WatchProgressDTO{
+		Position:      p.Position,
+		Watched:       p.Watched,
+		LastWatchedAt: p.LastWatchedAt.Time.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+// WatchService keeps the playback position and watched state of each viewer
+type WatchService struct {
+	queries *database.Queries
+}
+
+func NewWatchService(queries *database.Queries) *WatchService {
+	return &WatchService{queries: queries}
+}
+
+// Save records a playback position. Without an explicit watched value, a video becomes watched once
+// the position passes watchedThreshold of its duration and then stays watched while it is rewatched.
+func (s *WatchService) Save(ctx context.Context, viewer string, video database.Video, position float64, watched *bool) (database.WatchProgress, error) {
+	if video.Duration.Valid && position > video.Duration.Float64 {
+		position = video.Duration.Float64
+	}
+
+	isWatched := false
+	if watched != nil {
+		isWatched = *watched
+	} else {
+		existing, err := s.queries.GetWatchProgress(ctx, database.GetWatchProgressParams{VideoID: video.ID, Viewer: viewer})
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return database.WatchProgress{}, err
+		}
+		isWatched = existing.Watched ||
+			(video.Duration.Valid && video.Duration.Float64 > 0 && position >= video.Duration.Float64*watchedThreshold)
+	}
+
+	return s.queries.UpsertWatchProgress(ctx, database.UpsertWatchProgressParams{
+		VideoID:  video.ID,
+		Viewer:   viewer,
+		Position: position,
+		Watched:  isWatched,
+	})
+}
+
+// ProgressForVideos returns the viewer's playback state keyed by video ID. Videos never played are absent.
+func (s *WatchService) ProgressForVideos(ctx context.Context, viewer string, videoIDs []pgtype.UUID) (map[string]WatchProgressDTO, error) {
+	progress := make(map[string]WatchProgressDTO)
+	if len(videoIDs) == 0 {
+		return progress, nil
+	}
+	rows, err := s.queries.ListWatchProgressForVideos(ctx, database.ListWatchProgressForVideosParams{
+		Viewer:   viewer,
+		VideoIds: videoIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		progress[row.VideoID.String()] = MapWatchProgress(row)
+	}
+	return progress, nil
+}
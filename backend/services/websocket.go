@@ -1,7 +1,8 @@
 package services
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
 	"sync"
 
@@ -12,9 +13,15 @@ import (
 type WsEventType string
 
 const (
-	WsEventProgress     WsEventType = "progress"
-	WsEventVideoCreated WsEventType = "video_created"
-	WsEventVideoDeleted WsEventType = "video_deleted"
+	WsEventProgress      WsEventType = "progress"
+	WsEventVideoCreated  WsEventType = "video_created"
+	WsEventVideoDeleted  WsEventType = "video_deleted"
+	WsEventDiskWarning   WsEventType = "disk_warning"
+	WsEventBulkProgress  WsEventType = "bulk_progress"
+	WsEventVideoRestored WsEventType = "video_restored"
+	WsEventYtdlpUpdate   WsEventType = "ytdlp_update"
+	// WsEventMaintenanceError carries a MaintenanceRunDTO of a maintenance run that failed
+	WsEventMaintenanceError WsEventType = "maintenance_error"
 )
 
 var upgrader = websocket.Upgrader{
@@ -35,6 +42,7 @@ type WebSocketService struct {
 	broadcast  chan WsEvent
 	register   chan *websocket.Conn
 	unregister chan *websocket.Conn
+	ping       chan chan struct{}
 	mu         sync.Mutex
 }
 
@@ -44,6 +52,7 @@ func NewWebSocketService() *WebSocketService {
 		broadcast:  make(chan WsEvent),
 		register:   make(chan *websocket.Conn),
 		unregister: make(chan *websocket.Conn),
+		ping:       make(chan chan struct{}),
 	}
 }
 
@@ -54,23 +63,26 @@ func (s *WebSocketService) Run() {
 			s.mu.Lock()
 			s.clients[client] = true
 			s.mu.Unlock()
-			log.Println("WebSocket client registered")
+			slog.Debug("WebSocket client registered")
 
 		case client := <-s.unregister:
 			s.mu.Lock()
 			if _, ok := s.clients[client]; ok {
 				delete(s.clients, client)
 				client.Close()
-				log.Println("WebSocket client unregistered")
+				slog.Debug("WebSocket client unregistered")
 			}
 			s.mu.Unlock()
 
+		case reply := <-s.ping:
+			close(reply)
+
 		case event := <-s.broadcast:
 			s.mu.Lock()
 			for client := range s.clients {
 				err := client.WriteJSON(event)
 				if err != nil {
-					log.Printf("WebSocket error: %v", err)
+					slog.Warn("WebSocket write failed", "error", err)
 					client.Close()
 					delete(s.clients, client)
 				}
@@ -83,7 +95,7 @@ func (s *WebSocketService) Run() {
 func (s *WebSocketService) HandleConnections(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("Failed to upgrade connection: %v", err)
+		slog.Error("Failed to upgrade connection", "error", err)
 		return
 	}
 	s.register <- conn
@@ -102,6 +114,29 @@ func (s *WebSocketService) HandleConnections(w http.ResponseWriter, r *http.Requ
 	}()
 }
 
+// Alive reports whether the Run loop is still processing events
+func (s *WebSocketService) Alive(ctx context.Context) bool {
+	reply := make(chan struct{})
+	select {
+	case s.ping <- reply:
+	case <-ctx.Done():
+		return false
+	}
+	select {
+	case <-reply:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ClientCount returns the number of currently registered clients
+func (s *WebSocketService) ClientCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
 func (s *WebSocketService) Broadcast(eventType WsEventType, payload interface{}) {
 	s.broadcast <- WsEvent{
 		Type:    eventType,
@@ -2,46 +2,187 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"os"
 	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type YtdlpService struct {
-	settings *SettingsService
+	settings    *SettingsService
+	proxies     *ProxyService
+	credentials *CredentialService
 }
 
 type YtdlpDownloadOptions struct {
-	FormatID          string
+	FormatID          string // selector passed to -f
+	FormatSort        string // passed to -S if set, see FormatPolicy.Compile
 	OutputPattern     string
 	WriteThumbnail    bool
 	ConvertThumbnails string
+	WriteInfoJSON     bool
+	EmbedChapters     bool
+	SponsorBlock      *SponsorBlockOptions
+	Proxy             string   // picked from ProxyService.Candidates; empty for a direct connection
+	ExtraArgs         []string // per-download options from NormalizeYtdlpOptions, added after the global ones
+	RateLimit         string   // per-download --limit-rate; empty uses the global rate limit
+}
+
+// YtdlpInfo is the subset of a yt-dlp .info.json file that is stored on the video
+type YtdlpInfo struct {
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	Uploader    string  `json:"uploader"`
+	Channel     string  `json:"channel"`
+	UploadDate  string  `json:"upload_date"` // YYYYMMDD
+	Extractor   string  `json:"extractor"`
+	Description string  `json:"description"`
+	Duration    float64 `json:"duration"`
+	WebpageURL  string  `json:"webpage_url"`
+	VCodec      string  `json:"vcodec"`
+	Chapters    []struct {
+		StartTime float64 `json:"start_time"`
+		EndTime   float64 `json:"end_time"`
+		Title     string  `json:"title"`
+	} `json:"chapters"`
+}
+
+// ReadInfoJSON parses a yt-dlp .info.json file
+func ReadInfoJSON(path string) (*YtdlpInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var info YtdlpInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	if info.Uploader == "" {
+		info.Uploader = info.Channel
+	}
+	return &info, nil
+}
+
+// UploadDateValue converts the YYYYMMDD upload date to a database date
+func (i *YtdlpInfo) UploadDateValue() pgtype.Date {
+	t, err := time.Parse("20060102", i.UploadDate)
+	if err != nil {
+		return pgtype.Date{}
+	}
+	return pgtype.Date{Time: t, Valid: true}
 }
 
-func NewYtdlpService(settings *SettingsService) *YtdlpService {
+// NormalizeVideoCodec maps the codec names used by yt-dlp (avc1.640028, vp09.00.40.08), ffprobe (h264, hevc)
+// and Vidra's encoders (libx264, libvpx-vp9) onto one family name, as stored in videos.video_codec
+func NormalizeVideoCodec(codec string) string {
+	codec = strings.ToLower(strings.TrimSpace(codec))
+	if codec == "" || codec == "none" {
+		return ""
+	}
+	family, _, _ := strings.Cut(codec, ".")
+	switch family {
+	case "avc1", "avc3", "h264", "libx264":
+		return "h264"
+	case "hev1", "hvc1", "h265", "hevc", "libx265":
+		return "hevc"
+	case "vp09", "vp9", "libvpx-vp9", "vp9_qsv":
+		return "vp9"
+	case "vp8", "libvpx":
+		return "vp8"
+	case "av01", "av1", "libaom-av1", "libsvtav1":
+		return "av1"
+	}
+	return family
+}
+
+func NewYtdlpService(settings *SettingsService, proxies *ProxyService, credentials *CredentialService) *YtdlpService {
 	return &YtdlpService{
-		settings: settings,
+		settings:    settings,
+		proxies:     proxies,
+		credentials: credentials,
 	}
 }
 
-// baseArgs returns common arguments including proxy if configured
-func (s *YtdlpService) baseArgs(ctx context.Context) []string {
+// baseArgs returns common arguments including the proxy, if any
+func (s *YtdlpService) baseArgs(proxyURL string) []string {
 	args := []string{}
-	if proxyURL := s.settings.GetProxyURL(ctx); proxyURL != "" {
+	if proxyURL != "" {
 		args = append(args, "--proxy", proxyURL)
 	}
 	return args
 }
 
-// MetadataCommand builds a yt-dlp command for fetching video metadata
-func (s *YtdlpService) MetadataCommand(ctx context.Context, url string) *exec.Cmd {
-	args := []string{"--dump-json", "--flat-playlist", "--no-warnings"}
-	args = append(args, s.baseArgs(ctx)...)
+// MetadataCommand builds a yt-dlp command for fetching video metadata, through the first proxy the proxy rules
+// pick for the URL. The returned cleanup deletes the site's credential files and must run once the command has finished.
+func (s *YtdlpService) MetadataCommand(ctx context.Context, url string) (*exec.Cmd, func(), error) {
+	return s.probeCommand(ctx, url, "--dump-json", "--flat-playlist", "--no-warnings")
+}
+
+// SizeCommand builds a yt-dlp command that prints the size in bytes of what a download with the given
+// format selector and sort would fetch, or NA if the site does not tell. Like MetadataCommand it returns a
+// cleanup for the credential files.
+func (s *YtdlpService) SizeCommand(ctx context.Context, url, format, sort string) (*exec.Cmd, func(), error) {
+	args := []string{"--simulate", "--no-playlist", "--no-warnings", "-f", format}
+	if sort != "" {
+		args = append(args, "-S", sort)
+	}
+	args = append(args, "--print", "%(filesize,filesize_approx)d")
+	return s.probeCommand(ctx, url, args...)
+}
+
+// probeCommand builds a yt-dlp command that inspects the URL without downloading it, through the first proxy
+// the proxy rules pick for the URL and with the site's credentials
+func (s *YtdlpService) probeCommand(ctx context.Context, url string, probeArgs ...string) (*exec.Cmd, func(), error) {
+	candidates, err := s.proxies.Candidates(ctx, url, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	proxyURL := ""
+	if len(candidates) > 0 {
+		proxyURL = candidates[0].URL
+	}
+	credentialArgs, cleanup, err := s.credentials.Prepare(ctx, url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Like in DownloadCommand the extra options come first, so the probe's own format and sort win
+	args := append([]string{}, s.settings.GetYtdlpOptions(ctx)...)
+	args = append(args, probeArgs...)
+	args = append(args, s.baseArgs(proxyURL)...)
+	args = append(args, credentialArgs...)
 	args = append(args, url)
-	return exec.CommandContext(ctx, "yt-dlp", args...)
+	return exec.CommandContext(ctx, "yt-dlp", args...), cleanup, nil
 }
 
-// DownloadCommand builds a yt-dlp command for downloading a video
-func (s *YtdlpService) DownloadCommand(ctx context.Context, url string, opts YtdlpDownloadOptions) *exec.Cmd {
-	args := []string{"-f", opts.FormatID, "-o", opts.OutputPattern, "--newline"}
+// DownloadCommand builds a yt-dlp command for downloading a video. The returned cleanup deletes the site's
+// credential files and must run once the command has finished.
+func (s *YtdlpService) DownloadCommand(ctx context.Context, url string, opts YtdlpDownloadOptions) (*exec.Cmd, func(), error) {
+	credentialArgs, cleanup, err := s.credentials.Prepare(ctx, url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Extra options come first: for options given twice yt-dlp uses the last, so Vidra's own format,
+	// output template and proxy always win. The dedicated rate limits go around them so that the per-download
+	// one beats everything and the global one can still be overridden with --limit-rate in the options.
+	args := []string{}
+	if rate := s.settings.GetDownloadRateLimit(ctx); rate != "" && opts.RateLimit == "" {
+		args = append(args, "--limit-rate", rate)
+	}
+	args = append(args, s.settings.GetYtdlpOptions(ctx)...)
+	args = append(args, opts.ExtraArgs...)
+	if opts.RateLimit != "" {
+		args = append(args, "--limit-rate", opts.RateLimit)
+	}
+	args = append(args, "-f", opts.FormatID)
+	if opts.FormatSort != "" {
+		args = append(args, "-S", opts.FormatSort)
+	}
+	args = append(args, "-o", opts.OutputPattern, "--newline")
 
 	if opts.WriteThumbnail {
 		args = append(args, "--write-thumbnail")
@@ -49,15 +190,38 @@ func (s *YtdlpService) DownloadCommand(ctx context.Context, url string, opts Ytd
 	if opts.ConvertThumbnails != "" {
 		args = append(args, "--convert-thumbnails", opts.ConvertThumbnails)
 	}
+	if opts.WriteInfoJSON {
+		args = append(args, "--write-info-json")
+	}
+	if opts.EmbedChapters {
+		args = append(args, "--embed-chapters")
+	}
+	if sb := opts.SponsorBlock; sb != nil {
+		if sb.Mode == SponsorBlockRemove {
+			args = append(args, "--sponsorblock-remove", sb.categoryList())
+		} else {
+			args = append(args, "--sponsorblock-mark", sb.categoryList(), "--sponsorblock-chapter-title", sponsorBlockTitlePrefix+"%(category_names)l")
+		}
+		if apiURL := s.settings.GetSponsorBlockAPIURL(ctx); apiURL != "" {
+			args = append(args, "--sponsorblock-api", apiURL)
+		}
+	}
 
-	args = append(args, s.baseArgs(ctx)...)
+	args = append(args, s.baseArgs(opts.Proxy)...)
+	args = append(args, credentialArgs...)
 	args = append(args, url)
-	return exec.Command("yt-dlp", args...)
+	return exec.Command("yt-dlp", args...), cleanup, nil
 }
 
-// UpdateCommand builds a yt-dlp command for updating yt-dlp itself
-func (s *YtdlpService) UpdateCommand(ctx context.Context) *exec.Cmd {
-	args := []string{"-U"}
-	args = append(args, s.baseArgs(ctx)...)
+// UpdateCommand builds a yt-dlp command that replaces the binary with target, a channel, channel@version
+// or version as accepted by --update-to. It goes through the global proxy.
+func (s *YtdlpService) UpdateCommand(ctx context.Context, target string) *exec.Cmd {
+	args := []string{"--update-to", target}
+	args = append(args, s.baseArgs(s.settings.GetProxyURL(ctx))...)
 	return exec.CommandContext(ctx, "yt-dlp", args...)
 }
+
+// VersionCommand builds a yt-dlp command that prints the installed version
+func (s *YtdlpService) VersionCommand(ctx context.Context) *exec.Cmd {
+	return exec.CommandContext(ctx, "yt-dlp", "--version")
+}
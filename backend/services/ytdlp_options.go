@@ -0,0 +1,144 @@
+package services
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// allowedYtdlpOptions are the yt-dlp options that may be passed through from the settings and from a download
+// request, with the number of values each takes. Options that run commands, read or write arbitrary files or
+// replace what Vidra manages itself (format selection and sorting, proxy, cookies, post-processing) are
+// deliberately missing.
+var allowedYtdlpOptions = map[string]int{
+	// Network and geo-restriction
+	"--socket-timeout":        1,
+	"--source-address":        1,
+	"--force-ipv4":            0,
+	"--force-ipv6":            0,
+	"--impersonate":           1,
+	"--geo-bypass":            0,
+	"--no-geo-bypass":         0,
+	"--geo-bypass-country":    1,
+	"--geo-bypass-ip-block":   1,
+	"--xff":                   1,
+	"--legacy-server-connect": 0,
+	"--no-check-certificates": 0,
+	"--user-agent":            1,
+	"--referer":               1,
+	"--add-headers":           1,
+
+	// Download speed and retries
+	"--limit-rate":                     1,
+	"--throttled-rate":                 1,
+	"--concurrent-fragments":           1,
+	"--retries":                        1,
+	"--fragment-retries":               1,
+	"--extractor-retries":              1,
+	"--retry-sleep":                    1,
+	"--skip-unavailable-fragments":     0,
+	"--abort-on-unavailable-fragments": 0,
+	"--http-chunk-size":                1,
+	"--buffer-size":                    1,
+	"--hls-use-mpegts":                 0,
+
+	// Rate limiting towards the site
+	"--sleep-requests":     1,
+	"--sleep-interval":     1,
+	"--max-sleep-interval": 1,
+	"--sleep-subtitles":    1,
+
+	// Extraction and formats
+	"--extractor-args":      1,
+	"--prefer-free-formats": 0,
+	"--merge-output-format": 1,
+	"--audio-multistreams":  0,
+	"--video-multistreams":  0,
+	"--write-subs":          0,
+	"--write-auto-subs":     0,
+	"--sub-langs":           1,
+	"--sub-format":          1,
+	"--embed-subs":          0,
+	"--embed-metadata":      0,
+	"--no-mtime":            0,
+	"--mark-watched":        0,
+	"--no-mark-watched":     0,
+
+	// Output templates are checked to stay in the downloads directory
+	"--output": 1,
+}
+
+// ytdlpOptionAliases maps the short forms of allowed options to their long names
+var ytdlpOptionAliases = map[string]string{
+	"-4": "--force-ipv4",
+	"-6": "--force-ipv6",
+	"-r": "--limit-rate",
+	"-N": "--concurrent-fragments",
+	"-R": "--retries",
+	"-o": "--output",
+}
+
+// outputTypeRegex matches the "TYPES:" prefix of a typed output template, e.g. "subtitle,thumbnail:"
+var outputTypeRegex = regexp.MustCompile(`^(?:subtitle|thumbnail|description|annotation|infojson|link|pl_thumbnail|pl_description|pl_infojson|chapter|pl_video)(?:,(?:subtitle|thumbnail|description|annotation|infojson|link|pl_thumbnail|pl_description|pl_infojson|chapter|pl_video))*:`)
+
+// NormalizeYtdlpOptions checks extra yt-dlp options against the allow-list and returns them as separate
+// option and value arguments with long option names. Values may follow their option as the next element
+// or be joined to it with "=".
+func NormalizeYtdlpOptions(args []string) ([]string, error) {
+	normalized := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := strings.TrimSpace(args[i])
+		if !strings.HasPrefix(arg, "-") {
+			return nil, fmt.Errorf("invalid yt-dlp options: %q is not an option", arg)
+		}
+
+		name, value, hasValue := arg, "", false
+		if strings.HasPrefix(arg, "--") {
+			name, value, hasValue = strings.Cut(arg, "=")
+		}
+		if long, ok := ytdlpOptionAliases[name]; ok {
+			name = long
+		}
+		arity, ok := allowedYtdlpOptions[name]
+		if !ok {
+			return nil, fmt.Errorf("yt-dlp option %s is not allowed", name)
+		}
+
+		if arity == 0 {
+			if hasValue {
+				return nil, fmt.Errorf("yt-dlp option %s does not take a value", name)
+			}
+			normalized = append(normalized, name)
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("yt-dlp option %s requires a value", name)
+			}
+			i++
+			value = args[i]
+		}
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return nil, fmt.Errorf("invalid value for yt-dlp option %s", name)
+		}
+		if name == "--output" {
+			if err := validateOutputTemplate(value); err != nil {
+				return nil, err
+			}
+		}
+		normalized = append(normalized, name, value)
+	}
+	return normalized, nil
+}
+
+// validateOutputTemplate rejects output templates that would write outside the downloads directory. yt-dlp
+// resolves relative templates against the working directory, so they have to start with downloads/ too.
+func validateOutputTemplate(template string) error {
+	path := outputTypeRegex.ReplaceAllString(template, "")
+	cleaned := filepath.Clean(path)
+	if filepath.IsAbs(cleaned) || !strings.HasPrefix(cleaned, DownloadsDir+string(filepath.Separator)) {
+		return fmt.Errorf("invalid yt-dlp output template %q: must stay in %s/", template, DownloadsDir)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalizeYtdlpOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{"empty", []string{}, []string{}, false},
+		{"value as next element", []string{"--retries", "3"}, []string{"--retries", "3"}, false},
+		{"value joined with =", []string{"--retries=3"}, []string{"--retries", "3"}, false},
+		{"short alias", []string{"-R", "3", "-4"}, []string{"--retries", "3", "--force-ipv4"}, false},
+		{"flag", []string{"--embed-subs"}, []string{"--embed-subs"}, false},
+		{"surrounding spaces", []string{" --no-mtime "}, []string{"--no-mtime"}, false},
+		{"value starting with a dash", []string{"--extractor-args", "-x"}, []string{"--extractor-args", "-x"}, false},
+		{"output in downloads", []string{"-o", "downloads/%(title)s.%(ext)s"}, []string{"--output", "downloads/%(title)s.%(ext)s"}, false},
+		{"typed output in downloads", []string{"--output=thumbnail:downloads/thumbs/%(id)s"}, []string{"--output", "thumbnail:downloads/thumbs/%(id)s"}, false},
+		{"not allowed", []string{"--exec", "rm -rf /"}, nil, true},
+		{"not allowed short option", []string{"-f", "best"}, nil, true},
+		{"not allowed format sort", []string{"-S", "res:720"}, nil, true},
+		{"not allowed cookies", []string{"--cookies=/etc/passwd"}, nil, true},
+		{"not an option", []string{"retries"}, nil, true},
+		{"missing value", []string{"--retries"}, nil, true},
+		{"value on a flag", []string{"--force-ipv4=yes"}, nil, true},
+		{"newline in value", []string{"--user-agent", "a\n--exec=id"}, nil, true},
+		{"output outside downloads", []string{"-o", "/tmp/%(title)s.%(ext)s"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeYtdlpOptions(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeYtdlpOptions(%q) error = %v, want error: %v", tt.args, err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(got, tt.want) {
+				t.Errorf("NormalizeYtdlpOptions(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateOutputTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		wantErr  bool
+	}{
+		{"downloads/%(title)s.%(ext)s", false},
+		{"downloads/%(uploader)s/%(title)s.%(ext)s", false},
+		{"./downloads/%(id)s.%(ext)s", false},
+		{"thumbnail:downloads/%(id)s", false},
+		{"subtitle,thumbnail:downloads/extra/%(id)s", false},
+		{"%(title)s.%(ext)s", true},
+		{"downloads", true},
+		{"downloads/../%(id)s", true},
+		{"downloads/a/../../%(id)s", true},
+		{"/downloads/%(id)s", true},
+		{"/etc/cron.d/%(id)s", true},
+		{"thumbnail:/tmp/%(id)s", true},
+		{"unknowntype:downloads/%(id)s", true},
+	}
+
+	for _, tt := range tests {
+		err := validateOutputTemplate(tt.template)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateOutputTemplate(%q) = %v, want error: %v", tt.template, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package services
+
+import "testing"
+
+func TestNormalizeVideoCodec(t *testing.T) {
+	tests := []struct {
+		codec string
+		want  string
+	}{
+		{"", ""},
+		{"none", ""},
+		{"avc1.640028", "h264"},
+		{"avc3.4D401F", "h264"},
+		{"h264", "h264"},
+		{"libx264", "h264"},
+		{"hvc1.2.4.L153.B0", "hevc"},
+		{"hev1.1.6.L120.90", "hevc"},
+		{"HEVC", "hevc"},
+		{"vp09.00.40.08", "vp9"},
+		{"vp9", "vp9"},
+		{"libvpx-vp9", "vp9"},
+		{"vp9_qsv", "vp9"},
+		{"vp8", "vp8"},
+		{"av01.0.08M.08", "av1"},
+		{"libsvtav1", "av1"},
+		{" AV1 ", "av1"},
+		{"mpeg4", "mpeg4"},
+		{"theora.x", "theora"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeVideoCodec(tt.codec); got != tt.want {
+			t.Errorf("NormalizeVideoCodec(%q) = %q, want %q", tt.codec, got, tt.want)
+		}
+	}
+}
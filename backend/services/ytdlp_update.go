@@ -0,0 +1,478 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azmekk/Vidra/backend/gen/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	YtdlpChannelStable  = "stable"
+	YtdlpChannelNightly = "nightly"
+	YtdlpChannelMaster  = "master"
+
+	// ytdlpPreviousSuffix names the copy of the binary taken before an update, kept for rollbacks
+	ytdlpPreviousSuffix = ".previous"
+
+	ytdlpUpdateTimeout = 10 * time.Minute
+	ytdlpSmokeTimeout  = 30 * time.Second
+
+	ytdlpAutoUpdateCheckInterval = time.Minute
+)
+
+var (
+	ErrYtdlpUpdateRunning = errors.New("a yt-dlp update is already running")
+	ErrNoPreviousYtdlp    = errors.New("no previous yt-dlp version to roll back to")
+
+	// ytdlpVersionRegex matches yt-dlp release versions: 2025.01.15, and nightlies like 2025.01.15.232842
+	ytdlpVersionRegex = regexp.MustCompile(`^\d{4}\.\d{2}\.\d{2}(\.\d+)?$`)
+)
+
+// ValidateYtdlpVersionSettings checks a release channel and an optional pinned version
+func ValidateYtdlpVersionSettings(channel, version string) error {
+	if channel != YtdlpChannelStable && channel != YtdlpChannelNightly && channel != YtdlpChannelMaster {
+		return fmt.Errorf("invalid channel: must be stable, nightly or master")
+	}
+	if version != "" && !ytdlpVersionRegex.MatchString(version) {
+		return fmt.Errorf("invalid version %q: must look like 2025.01.15", version)
+	}
+	return nil
+}
+
+// ValidateYtdlpUpdateTime checks the time of day of automatic updates as HH:MM
+func ValidateYtdlpUpdateTime(t string) error {
+	if !windowTimeRegex.MatchString(t) {
+		return fmt.Errorf("invalid update time %q: must be HH:MM", t)
+	}
+	return nil
+}
+
+// ytdlpUpdateTarget returns the --update-to argument for a channel and an optional pinned version
+func ytdlpUpdateTarget(channel, version string) string {
+	if version == "" {
+		return channel
+	}
+	return channel + "@" + version
+}
+
+type YtdlpVersionDTO struct {
+	Version         string `json:"version"` // empty if yt-dlp does not run
+	Path            string `json:"path"`
+	Channel         string `json:"channel"`
+	PinnedVersion   string `json:"pinnedVersion,omitempty"`
+	PreviousVersion string `json:"previousVersion,omitempty"` // the version a rollback restores
+	Error           string `json:"error,omitempty"`
+}
+
+type YtdlpUpdateStatusDTO struct {
+	Running     bool   `json:"running"`
+	Rollback    bool   `json:"rollback"` // a manual rollback to the previous version rather than an update
+	Trigger     string `json:"trigger,omitempty"`
+	Target      string `json:"target,omitempty"`
+	StartedAt   string `json:"startedAt,omitempty"`
+	FinishedAt  string `json:"finishedAt,omitempty"`
+	FromVersion string `json:"fromVersion,omitempty"`
+	ToVersion   string `json:"toVersion,omitempty"`
+	RolledBack  bool   `json:"rolledBack"` // the new binary failed the smoke test and the old one was restored
+	Error       string `json:"error,omitempty"`
+	Output      string `json:"output"`
+}
+
+// YtdlpUpdateEvent is the payload of WsEventYtdlpUpdate: a line of output while the job runs, and the
+// final status once it finished
+type YtdlpUpdateEvent struct {
+	Line   string                `json:"line,omitempty"`
+	Status *YtdlpUpdateStatusDTO `json:"status,omitempty"`
+}
+
+// YtdlpUpdateService installs yt-dlp releases in the background, on request or daily when automatic updates
+// are enabled. The binary is copied before every update and restored if the new one fails a --version smoke
+// test. Every run is recorded in maintenance_runs.
+type YtdlpUpdateService struct {
+	queries    *database.Queries
+	ytdlp      *YtdlpService
+	settings   *SettingsService
+	downloader *DownloaderService
+	ws         *WebSocketService
+	metrics    *MetricsService
+
+	mu     sync.Mutex
+	status YtdlpUpdateStatusDTO
+	runID  pgtype.UUID // maintenance_runs row of the current or last run
+}
+
+func NewYtdlpUpdateService(queries *database.Queries, ytdlp *YtdlpService, settings *SettingsService, downloader *DownloaderService, ws *WebSocketService, metrics *MetricsService) *YtdlpUpdateService {
+	return &YtdlpUpdateService{
+		queries:    queries,
+		ytdlp:      ytdlp,
+		settings:   settings,
+		downloader: downloader,
+		ws:         ws,
+		metrics:    metrics,
+	}
+}
+
+// Version reports the installed yt-dlp, the configured channel and the version kept for rollbacks
+func (s *YtdlpUpdateService) Version(ctx context.Context) (YtdlpVersionDTO, error) {
+	settings, err := s.settings.GetSettings(ctx)
+	if err != nil {
+		return YtdlpVersionDTO{}, err
+	}
+	dto := YtdlpVersionDTO{Channel: settings.YtdlpChannel, PinnedVersion: settings.YtdlpVersion}
+
+	path, err := exec.LookPath("yt-dlp")
+	if err != nil {
+		dto.Error = err.Error()
+		return dto, nil
+	}
+	dto.Path = path
+	if dto.Version, err = s.smokeTest(ctx, path); err != nil {
+		dto.Error = err.Error()
+	}
+	if _, err := os.Stat(path + ytdlpPreviousSuffix); err == nil {
+		dto.PreviousVersion, _ = s.smokeTest(ctx, path+ytdlpPreviousSuffix)
+	}
+	return dto, nil
+}
+
+// smokeTest runs a yt-dlp binary with --version and returns the version it prints
+func (s *YtdlpUpdateService) smokeTest(ctx context.Context, path string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, ytdlpSmokeTimeout)
+	defer cancel()
+
+	cmd := s.ytdlp.VersionCommand(ctx)
+	cmd.Path = path
+	output, err := cmd.Output()
+	s.metrics.ObserveExit("yt-dlp", err)
+	if err != nil {
+		return "", fmt.Errorf("yt-dlp --version failed: %w", err)
+	}
+	version := strings.TrimSpace(string(output))
+	if version == "" {
+		return "", fmt.Errorf("yt-dlp --version printed nothing")
+	}
+	return version, nil
+}
+
+func (s *YtdlpUpdateService) GetStatus() YtdlpUpdateStatusDTO {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Start installs the pinned version, or the latest release of the configured channel, in the background
+func (s *YtdlpUpdateService) Start(ctx context.Context) (YtdlpUpdateStatusDTO, error) {
+	return s.start(ctx, MaintenanceTriggerManual)
+}
+
+func (s *YtdlpUpdateService) start(ctx context.Context, trigger string) (YtdlpUpdateStatusDTO, error) {
+	settings, err := s.settings.GetSettings(ctx)
+	if err != nil {
+		return YtdlpUpdateStatusDTO{}, err
+	}
+	target := ytdlpUpdateTarget(settings.YtdlpChannel, settings.YtdlpVersion)
+	if err := s.begin(ctx, false, trigger, target); err != nil {
+		return YtdlpUpdateStatusDTO{}, err
+	}
+	go s.run(func(path string) error { return s.update(path, target) })
+	return s.GetStatus(), nil
+}
+
+// Rollback restores the version that was installed before the last update, in the background
+func (s *YtdlpUpdateService) Rollback(ctx context.Context) (YtdlpUpdateStatusDTO, error) {
+	path, err := exec.LookPath("yt-dlp")
+	if err != nil {
+		return YtdlpUpdateStatusDTO{}, err
+	}
+	if _, err := os.Stat(path + ytdlpPreviousSuffix); err != nil {
+		return YtdlpUpdateStatusDTO{}, ErrNoPreviousYtdlp
+	}
+	if err := s.begin(ctx, true, MaintenanceTriggerManual, ""); err != nil {
+		return YtdlpUpdateStatusDTO{}, err
+	}
+	go s.run(func(path string) error {
+		s.appendOutput("Restoring " + path + ytdlpPreviousSuffix)
+		return replaceExecutable(path+ytdlpPreviousSuffix, path)
+	})
+	return s.GetStatus(), nil
+}
+
+func (s *YtdlpUpdateService) begin(ctx context.Context, rollback bool, trigger, target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status.Running {
+		return ErrYtdlpUpdateRunning
+	}
+	s.status = YtdlpUpdateStatusDTO{
+		Running:   true,
+		Rollback:  rollback,
+		Trigger:   trigger,
+		Target:    target,
+		StartedAt: time.Now().Format(time.RFC3339),
+	}
+
+	task := MaintenanceTaskYtdlpUpdate
+	if rollback {
+		task = MaintenanceTaskYtdlpRollback
+	}
+	run, err := s.queries.CreateMaintenanceRun(ctx, database.CreateMaintenanceRunParams{Task: task, Trigger: trigger})
+	if err != nil {
+		// The update itself does not depend on the record
+		slog.Error("Failed to record maintenance run", "task", task, "error", err)
+	}
+	s.runID = run.ID
+	return nil
+}
+
+// run backs up the binary, lets install replace it and rolls back if the result does not run. Downloads
+// running yt-dlp are waited for, and new ones wait until the update is done.
+func (s *YtdlpUpdateService) run(install func(path string) error) {
+	defer s.finish()
+
+	path, err := exec.LookPath("yt-dlp")
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	if active := s.downloader.ActiveJobs(); active > 0 {
+		s.appendOutput(fmt.Sprintf("Waiting for %d active downloads to finish", active))
+	}
+	release := s.downloader.HoldYtdlp()
+	defer release()
+
+	from, _ := s.smokeTest(context.Background(), path)
+	s.mu.Lock()
+	s.status.FromVersion = from
+	s.mu.Unlock()
+
+	// Keep the binary being replaced: a rollback restores it, and this job falls back to it
+	backup := path + ".backup"
+	os.Remove(backup)
+	if err := copyFile(path, backup); err != nil {
+		s.fail(fmt.Errorf("failed to back up yt-dlp: %w", err))
+		return
+	}
+	defer os.Remove(backup)
+
+	slog.Info("Replacing yt-dlp", "path", path, "from", from)
+	installErr := install(path)
+	if installErr != nil {
+		s.appendOutput(installErr.Error())
+	}
+
+	to, smokeErr := s.smokeTest(context.Background(), path)
+	if smokeErr != nil {
+		slog.Error("yt-dlp smoke test failed, rolling back", "error", smokeErr)
+		s.appendOutput("Smoke test failed: " + smokeErr.Error() + ", restoring " + from)
+		if err := replaceExecutable(backup, path); err != nil {
+			s.fail(fmt.Errorf("smoke test failed (%v) and restoring the previous binary failed: %w", smokeErr, err))
+			return
+		}
+		s.mu.Lock()
+		s.status.RolledBack = true
+		s.status.ToVersion = from
+		s.mu.Unlock()
+		s.fail(smokeErr)
+		return
+	}
+
+	if to != from {
+		// The replaced binary becomes the rollback target
+		if err := replaceExecutable(backup, path+ytdlpPreviousSuffix); err != nil {
+			slog.Warn("Failed to keep the previous yt-dlp", "error", err)
+		}
+	}
+	s.mu.Lock()
+	s.status.ToVersion = to
+	s.mu.Unlock()
+	if installErr != nil {
+		s.fail(installErr)
+		return
+	}
+	slog.Info("yt-dlp replaced", "from", from, "to", to)
+}
+
+// update runs yt-dlp --update-to, streaming its output
+func (s *YtdlpUpdateService) update(path, target string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ytdlpUpdateTimeout)
+	defer cancel()
+
+	cmd := s.ytdlp.UpdateCommand(ctx, target)
+	cmd.Path = path
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			s.appendOutput(scanner.Text())
+		}
+	}()
+
+	err := cmd.Run()
+	pw.Close()
+	<-done
+	s.metrics.ObserveExit("yt-dlp", err)
+	if err != nil {
+		return fmt.Errorf("yt-dlp --update-to %s failed: %w", target, err)
+	}
+	return nil
+}
+
+func (s *YtdlpUpdateService) appendOutput(line string) {
+	s.mu.Lock()
+	s.status.Output += line + "\n"
+	s.mu.Unlock()
+	s.ws.Broadcast(WsEventYtdlpUpdate, YtdlpUpdateEvent{Line: line})
+}
+
+func (s *YtdlpUpdateService) fail(err error) {
+	slog.Error("yt-dlp update failed", "error", err)
+	s.mu.Lock()
+	s.status.Error = err.Error()
+	s.mu.Unlock()
+}
+
+func (s *YtdlpUpdateService) finish() {
+	s.mu.Lock()
+	s.status.Running = false
+	s.status.FinishedAt = time.Now().Format(time.RFC3339)
+	status, runID := s.status, s.runID
+	s.mu.Unlock()
+	s.ws.Broadcast(WsEventYtdlpUpdate, YtdlpUpdateEvent{Status: &status})
+	s.record(runID, status)
+}
+
+// record stores the result of a run in maintenance_runs. A failure is also added to the error log and
+// broadcast as WsEventMaintenanceError.
+func (s *YtdlpUpdateService) record(runID pgtype.UUID, status YtdlpUpdateStatusDTO) {
+	ctx := context.Background()
+	run := database.MaintenanceRun{
+		ID:          runID,
+		Task:        MaintenanceTaskYtdlpUpdate,
+		Trigger:     status.Trigger,
+		Status:      MaintenanceStatusSucceeded,
+		FromVersion: status.FromVersion,
+		ToVersion:   status.ToVersion,
+		Error:       status.Error,
+		Output:      status.Output,
+	}
+	command := "yt-dlp --update-to " + status.Target
+	if status.Rollback {
+		run.Task = MaintenanceTaskYtdlpRollback
+		command = "yt-dlp rollback"
+	}
+	if status.Error != "" {
+		run.Status = MaintenanceStatusFailed
+	}
+
+	if runID.Valid {
+		finished, err := s.queries.FinishMaintenanceRun(ctx, database.FinishMaintenanceRunParams{
+			ID:          runID,
+			Status:      run.Status,
+			FromVersion: run.FromVersion,
+			ToVersion:   run.ToVersion,
+			Error:       run.Error,
+			Output:      run.Output,
+		})
+		if err != nil {
+			slog.Error("Failed to record maintenance run", "task", run.Task, "error", err)
+		} else {
+			run = finished
+		}
+	}
+	if status.Error == "" {
+		return
+	}
+
+	if _, err := s.queries.CreateError(ctx, database.CreateErrorParams{
+		ErrorMessage: "yt-dlp " + run.Trigger + " " + strings.TrimPrefix(run.Task, "ytdlp_") + " failed: " + status.Error,
+		Command:      command,
+		Output:       status.Output,
+	}); err != nil {
+		slog.Error("Failed to record error", "error", err)
+	}
+	s.ws.Broadcast(WsEventMaintenanceError, MapMaintenanceRun(run))
+}
+
+// checkSchedule starts the automatic update once the configured time of day has passed, unless it already
+// ran since then or downloads are active. A run that had to wait is started as soon as downloads finish.
+func (s *YtdlpUpdateService) checkSchedule(ctx context.Context) {
+	settings, err := s.settings.GetSettings(ctx)
+	if err != nil || !settings.YtdlpAutoUpdate || ValidateYtdlpUpdateTime(settings.YtdlpUpdateTime) != nil {
+		return
+	}
+
+	now := time.Now()
+	minute := minuteOfDay(settings.YtdlpUpdateTime)
+	due := time.Date(now.Year(), now.Month(), now.Day(), minute/60, minute%60, 0, 0, now.Location())
+	if now.Before(due) {
+		return
+	}
+
+	last, err := s.queries.GetLastMaintenanceRun(ctx, database.GetLastMaintenanceRunParams{
+		Task:    MaintenanceTaskYtdlpUpdate,
+		Trigger: MaintenanceTriggerScheduled,
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		slog.Error("Failed to read the last automatic yt-dlp update", "error", err)
+		return
+	}
+	if err == nil && !last.StartedAt.Time.Before(due) {
+		return
+	}
+
+	if active := s.downloader.ActiveJobs(); active > 0 {
+		slog.Debug("Automatic yt-dlp update waits for active downloads", "active", active)
+		return
+	}
+
+	if _, err := s.start(ctx, MaintenanceTriggerScheduled); err != nil {
+		if !errors.Is(err, ErrYtdlpUpdateRunning) {
+			slog.Error("Failed to start automatic yt-dlp update", "error", err)
+		}
+		return
+	}
+	slog.Info("Started automatic yt-dlp update")
+}
+
+// Run checks every minute whether the automatic update is due
+func (s *YtdlpUpdateService) Run() {
+	ticker := time.NewTicker(ytdlpAutoUpdateCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.checkSchedule(context.Background())
+	}
+}
+
+// replaceExecutable copies src over dst through a temp file, so dst is never half written
+func replaceExecutable(src, dst string) error {
+	tmp := dst + ".tmp"
+	os.Remove(tmp)
+	if err := copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, 0755); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,6 @@
+ALTER TABLE videos DROP COLUMN download_options;
+
+ALTER TABLE settings
+    DROP COLUMN max_library_size_gb,
+    DROP COLUMN min_free_space_gb,
+    DROP COLUMN disk_warning_percent;
@@ -0,0 +1,6 @@
+ALTER TABLE settings
+    ADD COLUMN max_library_size_gb DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN min_free_space_gb DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN disk_warning_percent INTEGER NOT NULL DEFAULT 90;
+
+ALTER TABLE videos ADD COLUMN download_options JSONB;
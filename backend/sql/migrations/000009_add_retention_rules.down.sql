@@ -0,0 +1,4 @@
+ALTER TABLE videos DROP COLUMN pinned;
+
+DROP TRIGGER IF EXISTS update_retention_rules_updated_at ON retention_rules;
+DROP TABLE IF EXISTS retention_rules;
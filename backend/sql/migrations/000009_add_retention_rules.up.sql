@@ -0,0 +1,17 @@
+CREATE TABLE retention_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL,
+    rule_type TEXT NOT NULL,
+    value INTEGER NOT NULL,
+    scope TEXT NOT NULL DEFAULT 'all',
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER update_retention_rules_updated_at
+    BEFORE UPDATE ON retention_rules
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+ALTER TABLE videos ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,9 @@
+ALTER TABLE videos
+    DROP COLUMN duration,
+    DROP COLUMN description,
+    DROP COLUMN extractor,
+    DROP COLUMN upload_date,
+    DROP COLUMN uploader,
+    DROP COLUMN external_id;
+
+ALTER TABLE settings DROP COLUMN filename_template;
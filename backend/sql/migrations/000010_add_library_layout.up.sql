@@ -0,0 +1,9 @@
+ALTER TABLE settings ADD COLUMN filename_template TEXT NOT NULL DEFAULT '{title}.{ext}';
+
+ALTER TABLE videos
+    ADD COLUMN external_id TEXT,
+    ADD COLUMN uploader TEXT,
+    ADD COLUMN upload_date DATE,
+    ADD COLUMN extractor TEXT,
+    ADD COLUMN description TEXT,
+    ADD COLUMN duration DOUBLE PRECISION;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS collection_videos;
+DROP TRIGGER IF EXISTS update_collections_updated_at ON collections;
+DROP TABLE IF EXISTS collections;
+DROP TABLE IF EXISTS video_tags;
+DROP TABLE IF EXISTS tags;
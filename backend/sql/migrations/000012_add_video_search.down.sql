@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS refresh_video_search_on_tag ON tags;
+DROP TRIGGER IF EXISTS refresh_video_search_on_video_tag ON video_tags;
+DROP TRIGGER IF EXISTS refresh_video_search_on_video ON videos;
+DROP FUNCTION IF EXISTS refresh_video_search_on_tag();
+DROP FUNCTION IF EXISTS refresh_video_search_on_video_tag();
+DROP FUNCTION IF EXISTS refresh_video_search_on_video();
+DROP FUNCTION IF EXISTS refresh_video_search(UUID);
+DROP FUNCTION IF EXISTS video_search_document(UUID, TEXT);
+DROP TABLE IF EXISTS video_search;
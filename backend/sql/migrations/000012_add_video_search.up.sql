@@ -0,0 +1,80 @@
+-- Search data lives outside videos so SELECT * on videos stays small.
+-- The document is weighted: name (A), uploader and tags (B), description (C), subtitles (D).
+CREATE TABLE video_search (
+    video_id UUID PRIMARY KEY REFERENCES videos(id) ON DELETE CASCADE,
+    subtitle_text TEXT NOT NULL DEFAULT '',
+    document TSVECTOR NOT NULL
+);
+
+CREATE INDEX idx_video_search_document ON video_search USING GIN (document);
+
+CREATE OR REPLACE FUNCTION video_search_document(vid UUID, subtitles TEXT)
+RETURNS TSVECTOR AS $$
+    SELECT setweight(to_tsvector('english', coalesce(v.name, '')), 'A') ||
+           setweight(to_tsvector('english', coalesce(v.uploader, '')), 'B') ||
+           setweight(to_tsvector('english', coalesce((
+               SELECT string_agg(t.name, ' ') FROM video_tags vt JOIN tags t ON t.id = vt.tag_id WHERE vt.video_id = v.id
+           ), '')), 'B') ||
+           setweight(to_tsvector('english', coalesce(v.description, '')), 'C') ||
+           setweight(to_tsvector('english', coalesce(subtitles, '')), 'D')
+    FROM videos v
+    WHERE v.id = vid;
+$$ language 'sql' STABLE;
+
+CREATE OR REPLACE FUNCTION refresh_video_search(vid UUID)
+RETURNS VOID AS $$
+BEGIN
+    INSERT INTO video_search (video_id, document)
+    SELECT v.id, video_search_document(v.id, coalesce(s.subtitle_text, ''))
+    FROM videos v
+    LEFT JOIN video_search s ON s.video_id = v.id
+    WHERE v.id = vid
+    ON CONFLICT (video_id) DO UPDATE SET document = EXCLUDED.document;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE FUNCTION refresh_video_search_on_video()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM refresh_video_search(NEW.id);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE FUNCTION refresh_video_search_on_video_tag()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM refresh_video_search(OLD.video_id);
+    ELSE
+        PERFORM refresh_video_search(NEW.video_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE FUNCTION refresh_video_search_on_tag()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM refresh_video_search(vt.video_id) FROM video_tags vt WHERE vt.tag_id = NEW.id;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER refresh_video_search_on_video
+AFTER INSERT OR UPDATE OF name, uploader, description ON videos
+FOR EACH ROW
+EXECUTE FUNCTION refresh_video_search_on_video();
+
+CREATE TRIGGER refresh_video_search_on_video_tag
+AFTER INSERT OR DELETE ON video_tags
+FOR EACH ROW
+EXECUTE FUNCTION refresh_video_search_on_video_tag();
+
+CREATE TRIGGER refresh_video_search_on_tag
+AFTER UPDATE OF name ON tags
+FOR EACH ROW
+EXECUTE FUNCTION refresh_video_search_on_tag();
+
+INSERT INTO video_search (video_id, document)
+SELECT id, video_search_document(id, '') FROM videos;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_videos_extractor;
+DROP INDEX IF EXISTS idx_videos_uploader;
+DROP INDEX IF EXISTS idx_videos_download_status;
+DROP INDEX IF EXISTS idx_videos_duration_id;
+DROP INDEX IF EXISTS idx_videos_file_size_id;
+DROP INDEX IF EXISTS idx_videos_created_at_id;
+ALTER TABLE videos DROP COLUMN IF EXISTS video_codec;
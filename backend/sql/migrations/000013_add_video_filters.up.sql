@@ -0,0 +1,17 @@
+ALTER TABLE videos ADD COLUMN video_codec TEXT;
+
+-- Codec of videos re-encoded by Vidra is known from the stored download options
+UPDATE videos SET video_codec = CASE download_options->'encodingOptions'->>'videoCodec'
+        WHEN 'libx264' THEN 'h264'
+        WHEN 'libvpx-vp9' THEN 'vp9'
+        WHEN 'vp9_qsv' THEN 'vp9'
+    END
+WHERE (download_options->>'reEncode')::boolean IS TRUE;
+
+-- Keyset pagination walks these (sort key, id) pairs
+CREATE INDEX idx_videos_created_at_id ON videos(created_at, id);
+CREATE INDEX idx_videos_file_size_id ON videos((COALESCE(file_size, -1)), id);
+CREATE INDEX idx_videos_duration_id ON videos((COALESCE(duration, -1)), id);
+CREATE INDEX idx_videos_download_status ON videos(download_status);
+CREATE INDEX idx_videos_uploader ON videos(lower(uploader));
+CREATE INDEX idx_videos_extractor ON videos(lower(extractor));
@@ -0,0 +1,4 @@
+ALTER TABLE settings DROP COLUMN trash_retention_days;
+
+DROP INDEX IF EXISTS idx_videos_deleted_at;
+ALTER TABLE videos DROP COLUMN deleted_at;
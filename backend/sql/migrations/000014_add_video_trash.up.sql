@@ -0,0 +1,6 @@
+-- Deleted videos stay in the table with deleted_at set until they are restored or purged
+ALTER TABLE videos ADD COLUMN deleted_at TIMESTAMPTZ;
+CREATE INDEX idx_videos_deleted_at ON videos(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- 0 keeps trashed videos until they are deleted by hand
+ALTER TABLE settings ADD COLUMN trash_retention_days INTEGER NOT NULL DEFAULT 30;
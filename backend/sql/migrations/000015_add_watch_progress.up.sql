@@ -0,0 +1,11 @@
+-- Playback state per viewer. Viewers are identified by name since Vidra has no accounts of its own.
+CREATE TABLE watch_progress (
+    video_id UUID NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    viewer TEXT NOT NULL,
+    position DOUBLE PRECISION NOT NULL DEFAULT 0,
+    watched BOOLEAN NOT NULL DEFAULT false,
+    last_watched_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (video_id, viewer)
+);
+
+CREATE INDEX idx_watch_progress_viewer_last_watched ON watch_progress(viewer, last_watched_at DESC);
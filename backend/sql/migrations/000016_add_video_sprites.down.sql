@@ -0,0 +1,4 @@
+ALTER TABLE videos DROP COLUMN sprite_count;
+ALTER TABLE videos DROP COLUMN sprite_columns;
+ALTER TABLE videos DROP COLUMN sprite_interval;
+ALTER TABLE videos DROP COLUMN sprite_file_name;
@@ -0,0 +1,6 @@
+-- Timeline sprite sheet for hover previews: sprite_count tiles taken every sprite_interval seconds,
+-- laid out sprite_columns per row
+ALTER TABLE videos ADD COLUMN sprite_file_name TEXT;
+ALTER TABLE videos ADD COLUMN sprite_interval DOUBLE PRECISION;
+ALTER TABLE videos ADD COLUMN sprite_columns INTEGER;
+ALTER TABLE videos ADD COLUMN sprite_count INTEGER;
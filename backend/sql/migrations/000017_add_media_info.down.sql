@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_videos_hdr;
+DROP INDEX IF EXISTS idx_videos_audio_codec;
+DROP INDEX IF EXISTS idx_videos_height;
+
+ALTER TABLE videos DROP COLUMN hdr;
+ALTER TABLE videos DROP COLUMN audio_codec;
+ALTER TABLE videos DROP COLUMN bitrate;
+ALTER TABLE videos DROP COLUMN height;
+ALTER TABLE videos DROP COLUMN width;
+ALTER TABLE videos DROP COLUMN media_info;
@@ -0,0 +1,11 @@
+-- Full ffprobe result of the stored file; the fields below are copied out of it for filtering and sorting
+ALTER TABLE videos ADD COLUMN media_info JSONB;
+ALTER TABLE videos ADD COLUMN width INTEGER;
+ALTER TABLE videos ADD COLUMN height INTEGER;
+ALTER TABLE videos ADD COLUMN bitrate BIGINT;
+ALTER TABLE videos ADD COLUMN audio_codec TEXT;
+ALTER TABLE videos ADD COLUMN hdr BOOLEAN;
+
+CREATE INDEX idx_videos_height ON videos(height);
+CREATE INDEX idx_videos_audio_codec ON videos(audio_codec);
+CREATE INDEX idx_videos_hdr ON videos(hdr) WHERE hdr;
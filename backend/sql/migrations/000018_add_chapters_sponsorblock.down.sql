@@ -0,0 +1,3 @@
+ALTER TABLE settings DROP COLUMN sponsorblock_api_url;
+
+ALTER TABLE videos DROP COLUMN chapters;
@@ -0,0 +1,5 @@
+-- Chapters of the stored file: [{"start": 0, "end": 61.5, "title": "Intro", "sponsorBlock": false}, ...]
+ALTER TABLE videos ADD COLUMN chapters JSONB;
+
+-- Empty uses yt-dlp's default SponsorBlock API (https://sponsor.ajay.app)
+ALTER TABLE settings ADD COLUMN sponsorblock_api_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS update_proxy_rules_updated_at ON proxy_rules;
+DROP TABLE IF EXISTS proxy_rules;
+DROP TABLE IF EXISTS proxies;
+DROP TRIGGER IF EXISTS update_proxy_pools_updated_at ON proxy_pools;
+DROP TABLE IF EXISTS proxy_pools;
@@ -0,0 +1,46 @@
+-- A pool hands out its proxies round-robin or in order (failover). Rules route URLs to a pool;
+-- URLs no rule matches keep using settings.proxy_url.
+CREATE TABLE proxy_pools (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL UNIQUE,
+    strategy TEXT NOT NULL DEFAULT 'failover',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER update_proxy_pools_updated_at
+    BEFORE UPDATE ON proxy_pools
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TABLE proxies (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    pool_id UUID NOT NULL REFERENCES proxy_pools(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    last_checked_at TIMESTAMP WITH TIME ZONE,
+    last_check_ok BOOLEAN,
+    last_check_error TEXT,
+    last_latency_ms INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_proxies_pool_id ON proxies(pool_id, position);
+
+-- match_type is extractor (yt-dlp extractor name) or domain (the URL's host or a parent domain)
+CREATE TABLE proxy_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    pool_id UUID NOT NULL REFERENCES proxy_pools(id) ON DELETE CASCADE,
+    match_type TEXT NOT NULL,
+    pattern TEXT NOT NULL,
+    priority INTEGER NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER update_proxy_rules_updated_at
+    BEFORE UPDATE ON proxy_rules
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS update_site_credentials_updated_at ON site_credentials;
+DROP TABLE IF EXISTS site_credentials;
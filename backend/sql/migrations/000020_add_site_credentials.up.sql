@@ -0,0 +1,15 @@
+-- Cookies and logins handed to yt-dlp for a domain and its subdomains. Both are AES-GCM encrypted with
+-- a key derived from VIDRA_SECRET_KEY; login holds the username and password as JSON.
+CREATE TABLE site_credentials (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    domain TEXT NOT NULL UNIQUE,
+    cookies BYTEA,
+    login BYTEA,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER update_site_credentials_updated_at
+    BEFORE UPDATE ON site_credentials
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1 @@
+ALTER TABLE settings DROP COLUMN IF EXISTS ytdlp_options;
@@ -0,0 +1,2 @@
+-- Extra yt-dlp arguments added to every download, e.g. {--limit-rate,5M,--geo-bypass}. Checked against an allow-list.
+ALTER TABLE settings ADD COLUMN ytdlp_options TEXT[] NOT NULL DEFAULT '{}';
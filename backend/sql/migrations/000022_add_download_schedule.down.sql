@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_videos_scheduled;
+ALTER TABLE videos DROP COLUMN IF EXISTS scheduled_at;
+ALTER TABLE settings DROP COLUMN IF EXISTS download_windows;
+ALTER TABLE settings DROP COLUMN IF EXISTS download_rate_limit;
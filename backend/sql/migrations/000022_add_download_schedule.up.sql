@@ -0,0 +1,9 @@
+-- Rate limit passed to yt-dlp --limit-rate (e.g. 5M), empty for none
+ALTER TABLE settings ADD COLUMN download_rate_limit TEXT NOT NULL DEFAULT '';
+-- Times of day new downloads may start: [{"start": "01:00", "end": "07:00"}]. Empty allows any time.
+ALTER TABLE settings ADD COLUMN download_windows JSONB NOT NULL DEFAULT '[]';
+
+-- When a video waiting in the scheduled status will start, i.e. the next download window
+ALTER TABLE videos ADD COLUMN scheduled_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_videos_scheduled ON videos(created_at) WHERE download_status = 'scheduled';
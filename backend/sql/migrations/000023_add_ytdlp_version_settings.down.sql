@@ -0,0 +1,2 @@
+ALTER TABLE settings DROP COLUMN IF EXISTS ytdlp_version;
+ALTER TABLE settings DROP COLUMN IF EXISTS ytdlp_channel;
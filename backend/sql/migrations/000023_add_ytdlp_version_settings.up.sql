@@ -0,0 +1,4 @@
+-- yt-dlp release channel (stable, nightly or master) and an optional pinned version such as 2025.01.15.
+-- Updates install the pinned version, or the latest release of the channel without one.
+ALTER TABLE settings ADD COLUMN ytdlp_channel TEXT NOT NULL DEFAULT 'stable';
+ALTER TABLE settings ADD COLUMN ytdlp_version TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS maintenance_runs;
+ALTER TABLE settings DROP COLUMN IF EXISTS ytdlp_update_time;
+ALTER TABLE settings DROP COLUMN IF EXISTS ytdlp_auto_update;
@@ -0,0 +1,19 @@
+-- Automatic yt-dlp updates: once a day at ytdlp_update_time (HH:MM, server time zone) when no downloads are active
+ALTER TABLE settings ADD COLUMN ytdlp_auto_update BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE settings ADD COLUMN ytdlp_update_time TEXT NOT NULL DEFAULT '04:00';
+
+-- Background maintenance such as yt-dlp updates and rollbacks, started manually or by a schedule
+CREATE TABLE maintenance_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    task TEXT NOT NULL,
+    trigger TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running',
+    from_version TEXT NOT NULL DEFAULT '',
+    to_version TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    output TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_maintenance_runs_task ON maintenance_runs(task, trigger, started_at DESC);
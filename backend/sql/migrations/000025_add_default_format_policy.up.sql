@@ -0,0 +1,3 @@
+-- Format policy used by downloads without a format ID or policy of their own, e.g.
+-- {"maxHeight": 1080, "codecs": ["av1", "vp9", "h264"], "preferHighFps": true, "maxSize": "2G"}. Empty lets yt-dlp pick the best format.
+ALTER TABLE settings ADD COLUMN default_format_policy JSONB NOT NULL DEFAULT '{}';
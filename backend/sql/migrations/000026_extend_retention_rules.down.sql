@@ -0,0 +1,2 @@
+ALTER TABLE retention_rules DROP COLUMN IF EXISTS permanent;
+ALTER TABLE retention_rules DROP COLUMN IF EXISTS tag;
@@ -0,0 +1,4 @@
+-- Tag a rule is limited to when its scope is 'tag'
+ALTER TABLE retention_rules ADD COLUMN tag TEXT NOT NULL DEFAULT '';
+-- Delete matching videos for good instead of moving them to the trash
+ALTER TABLE retention_rules ADD COLUMN permanent BOOLEAN NOT NULL DEFAULT false;
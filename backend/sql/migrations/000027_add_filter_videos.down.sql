@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS filter_videos(TEXT, TEXT[], TIMESTAMP WITH TIME ZONE, TIMESTAMP WITH TIME ZONE, BIGINT, BIGINT, DOUBLE PRECISION, DOUBLE PRECISION, TEXT, TEXT, TEXT, TEXT[], TEXT, TEXT);
@@ -0,0 +1,49 @@
+-- The ListVideos filters, shared by the list, count, bulk and full-text search queries. Arguments that are
+-- NULL (or an empty array) are ignored. Being a single STABLE SQL SELECT, it is inlined into the calling
+-- query, so the planner still uses the videos indexes.
+CREATE OR REPLACE FUNCTION filter_videos(
+    filter_search TEXT,
+    filter_statuses TEXT[],
+    filter_created_after TIMESTAMP WITH TIME ZONE,
+    filter_created_before TIMESTAMP WITH TIME ZONE,
+    filter_min_size BIGINT,
+    filter_max_size BIGINT,
+    filter_min_duration DOUBLE PRECISION,
+    filter_max_duration DOUBLE PRECISION,
+    filter_uploader TEXT,
+    filter_extractor TEXT,
+    filter_codec TEXT,
+    filter_tags TEXT[],
+    filter_watch TEXT,
+    filter_viewer TEXT
+)
+RETURNS SETOF videos AS $$
+    SELECT * FROM videos
+    WHERE deleted_at IS NULL
+      AND (coalesce(filter_search, '') = '' OR name ILIKE '%' || filter_search || '%' OR original_url ILIKE '%' || filter_search || '%')
+      AND (cardinality(filter_statuses) = 0 OR download_status = ANY(filter_statuses))
+      AND (filter_created_after IS NULL OR created_at >= filter_created_after)
+      AND (filter_created_before IS NULL OR created_at < filter_created_before)
+      AND (filter_min_size IS NULL OR file_size >= filter_min_size)
+      AND (filter_max_size IS NULL OR file_size <= filter_max_size)
+      AND (filter_min_duration IS NULL OR duration >= filter_min_duration)
+      AND (filter_max_duration IS NULL OR duration <= filter_max_duration)
+      AND (filter_uploader IS NULL OR lower(uploader) = lower(filter_uploader))
+      AND (filter_extractor IS NULL OR lower(extractor) = lower(filter_extractor))
+      AND (filter_codec IS NULL OR video_codec = lower(filter_codec))
+      AND (cardinality(filter_tags) = 0 OR id IN (
+        SELECT vt.video_id FROM video_tags vt
+        JOIN tags t ON t.id = vt.tag_id
+        WHERE t.name = ANY(filter_tags)
+        GROUP BY vt.video_id
+        HAVING COUNT(DISTINCT t.name) = cardinality(filter_tags)
+      ))
+      AND (filter_watch IS NULL OR CASE filter_watch
+        WHEN 'unwatched' THEN NOT EXISTS (
+          SELECT 1 FROM watch_progress wp WHERE wp.video_id = videos.id AND wp.viewer = filter_viewer AND wp.watched)
+        WHEN 'in_progress' THEN EXISTS (
+          SELECT 1 FROM watch_progress wp WHERE wp.video_id = videos.id AND wp.viewer = filter_viewer AND NOT wp.watched AND wp.position > 0)
+        ELSE EXISTS (
+          SELECT 1 FROM watch_progress wp WHERE wp.video_id = videos.id AND wp.viewer = filter_viewer AND wp.watched)
+      END);
+$$ language 'sql' STABLE;
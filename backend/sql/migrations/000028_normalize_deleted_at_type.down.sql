@@ -0,0 +1 @@
+ALTER TABLE videos ALTER COLUMN deleted_at TYPE TIMESTAMPTZ;
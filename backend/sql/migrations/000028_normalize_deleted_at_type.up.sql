@@ -0,0 +1,3 @@
+-- TIMESTAMPTZ is an alias of TIMESTAMP WITH TIME ZONE, so this only spells deleted_at like the other
+-- columns; the table is not rewritten
+ALTER TABLE videos ALTER COLUMN deleted_at TYPE TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,56 @@
+-- name: ListCollections :many
+SELECT c.id, c.name, c.description, c.created_at, c.updated_at, COUNT(cv.video_id) AS video_count
+FROM collections c
+LEFT JOIN collection_videos cv ON cv.collection_id = c.id
+GROUP BY c.id
+ORDER BY c.name;
+
+-- name: GetCollection :one
+SELECT * FROM collections
+WHERE id = $1 LIMIT 1;
+
+-- name: CreateCollection :one
+INSERT INTO collections (
+    name, description
+) VALUES (
+    $1, $2
+)
+RETURNING *;
+
+-- name: UpdateCollection :one
+UPDATE collections
+  set name = $2,
+  description = $3
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteCollection :exec
+DELETE FROM collections
+WHERE id = $1;
+
+-- name: ListCollectionVideos :many
+SELECT v.*
+FROM collection_videos cv
+JOIN videos v ON v.id = cv.video_id
+WHERE cv.collection_id = $1
+  AND v.deleted_at IS NULL
+ORDER BY cv.position, cv.added_at;
+
+-- name: AddCollectionVideo :exec
+INSERT INTO collection_videos (collection_id, video_id, position)
+SELECT $1, $2, COALESCE(MAX(position) + 1, 0)
+FROM collection_videos
+WHERE collection_id = $1
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveCollectionVideo :exec
+DELETE FROM collection_videos
+WHERE collection_id = $1 AND video_id = $2;
+
+-- name: ReorderCollectionVideos :exec
+UPDATE collection_videos cv
+  set position = COALESCE(
+    (SELECT o.ord::int FROM unnest(sqlc.arg('video_ids')::uuid[]) WITH ORDINALITY AS o(video_id, ord) WHERE o.video_id = cv.video_id),
+    cardinality(sqlc.arg('video_ids')::uuid[]) + 1 + cv.position
+  )
+WHERE cv.collection_id = sqlc.arg('collection_id');
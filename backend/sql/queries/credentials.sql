@@ -0,0 +1,24 @@
+-- name: ListSiteCredentials :many
+SELECT * FROM site_credentials
+ORDER BY domain;
+
+-- name: GetSiteCredential :one
+SELECT * FROM site_credentials
+WHERE id = $1 LIMIT 1;
+
+-- name: CreateSiteCredential :one
+INSERT INTO site_credentials (domain, cookies, login)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: UpdateSiteCredential :one
+UPDATE site_credentials
+  set domain = $2,
+  cookies = $3,
+  login = $4
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteSiteCredential :exec
+DELETE FROM site_credentials
+WHERE id = $1;
@@ -0,0 +1,29 @@
+-- name: CreateMaintenanceRun :one
+INSERT INTO maintenance_runs (task, trigger)
+VALUES ($1, $2)
+RETURNING *;
+
+-- name: FinishMaintenanceRun :one
+UPDATE maintenance_runs
+  set status = $2,
+  from_version = $3,
+  to_version = $4,
+  error = $5,
+  output = $6,
+  finished_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetLastMaintenanceRun :one
+SELECT * FROM maintenance_runs
+WHERE task = $1 AND trigger = $2
+ORDER BY started_at DESC
+LIMIT 1;
+
+-- name: ListMaintenanceRuns :many
+SELECT * FROM maintenance_runs
+ORDER BY started_at DESC
+LIMIT $1 OFFSET $2;
+
+-- name: CountMaintenanceRuns :one
+SELECT COUNT(*) FROM maintenance_runs;
@@ -0,0 +1,86 @@
+-- name: ListProxyPools :many
+SELECT * FROM proxy_pools
+ORDER BY name;
+
+-- name: GetProxyPool :one
+SELECT * FROM proxy_pools
+WHERE id = $1 LIMIT 1;
+
+-- name: CreateProxyPool :one
+INSERT INTO proxy_pools (name, strategy)
+VALUES ($1, $2)
+RETURNING *;
+
+-- name: UpdateProxyPool :one
+UPDATE proxy_pools
+  set name = $2,
+  strategy = $3
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteProxyPool :exec
+DELETE FROM proxy_pools
+WHERE id = $1;
+
+-- name: ListProxies :many
+SELECT * FROM proxies
+ORDER BY pool_id, position;
+
+-- name: ListPoolProxies :many
+SELECT * FROM proxies
+WHERE pool_id = $1
+ORDER BY position;
+
+-- name: GetProxy :one
+SELECT * FROM proxies
+WHERE id = $1 LIMIT 1;
+
+-- name: DeletePoolProxies :exec
+DELETE FROM proxies
+WHERE pool_id = $1;
+
+-- name: CreateProxy :one
+INSERT INTO proxies (pool_id, url, position, enabled)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: UpdateProxyHealth :one
+UPDATE proxies
+  set last_checked_at = NOW(),
+  last_check_ok = $2,
+  last_check_error = $3,
+  last_latency_ms = $4
+WHERE id = $1
+RETURNING *;
+
+-- name: ListProxyRules :many
+SELECT * FROM proxy_rules
+ORDER BY priority, created_at;
+
+-- name: ListEnabledProxyRules :many
+SELECT * FROM proxy_rules
+WHERE enabled = true
+ORDER BY priority, created_at;
+
+-- name: GetProxyRule :one
+SELECT * FROM proxy_rules
+WHERE id = $1 LIMIT 1;
+
+-- name: CreateProxyRule :one
+INSERT INTO proxy_rules (pool_id, match_type, pattern, priority, enabled)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: UpdateProxyRule :one
+UPDATE proxy_rules
+  set pool_id = $2,
+  match_type = $3,
+  pattern = $4,
+  priority = $5,
+  enabled = $6
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteProxyRule :exec
+DELETE FROM proxy_rules
+WHERE id = $1;
@@ -0,0 +1,48 @@
+-- name: ListRetentionRules :many
+SELECT * FROM retention_rules
+ORDER BY created_at ASC;
+
+-- name: ListEnabledRetentionRules :many
+SELECT * FROM retention_rules
+WHERE enabled = true
+ORDER BY created_at ASC;
+
+-- name: GetRetentionRule :one
+SELECT * FROM retention_rules
+WHERE id = $1 LIMIT 1;
+
+-- name: CreateRetentionRule :one
+INSERT INTO retention_rules (
+    name, rule_type, value, scope, enabled, tag, permanent
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7
+)
+RETURNING *;
+
+-- name: UpdateRetentionRule :one
+UPDATE retention_rules
+  set name = $2,
+  rule_type = $3,
+  value = $4,
+  scope = $5,
+  enabled = $6,
+  tag = $7,
+  permanent = $8
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteRetentionRule :exec
+DELETE FROM retention_rules
+WHERE id = $1;
+
+-- name: ListRetentionCandidates :many
+SELECT * FROM videos
+WHERE pinned = false
+  AND deleted_at IS NULL
+  AND download_status IN ('completed', 'error')
+ORDER BY created_at DESC;
+
+-- name: ListWatchedVideoIDs :many
+-- Videos any viewer has started or finished watching
+SELECT DISTINCT video_id FROM watch_progress
+WHERE watched OR position > 0;
@@ -12,3 +12,71 @@ UPDATE settings SET
     updated_at = NOW()
 WHERE id = 1
 RETURNING *;
+
+-- name: UpdateStorageSettings :one
+UPDATE settings SET
+    max_library_size_gb = $1,
+    min_free_space_gb = $2,
+    disk_warning_percent = $3,
+    updated_at = NOW()
+WHERE id = 1
+RETURNING *;
+
+-- name: UpdateLibrarySettings :one
+UPDATE settings SET
+    filename_template = $1,
+    updated_at = NOW()
+WHERE id = 1
+RETURNING *;
+
+-- name: UpdateTrashSettings :one
+UPDATE settings SET
+    trash_retention_days = $1,
+    updated_at = NOW()
+WHERE id = 1
+RETURNING *;
+
+-- name: UpdateSponsorBlockSettings :one
+UPDATE settings SET
+    sponsorblock_api_url = $1,
+    updated_at = NOW()
+WHERE id = 1
+RETURNING *;
+
+-- name: UpdateYtdlpOptionsSettings :one
+UPDATE settings SET
+    ytdlp_options = $1,
+    updated_at = NOW()
+WHERE id = 1
+RETURNING *;
+
+-- name: UpdateDownloadSettings :one
+UPDATE settings SET
+    download_rate_limit = $1,
+    download_windows = $2,
+    updated_at = NOW()
+WHERE id = 1
+RETURNING *;
+
+-- name: UpdateYtdlpVersionSettings :one
+UPDATE settings SET
+    ytdlp_channel = $1,
+    ytdlp_version = $2,
+    updated_at = NOW()
+WHERE id = 1
+RETURNING *;
+
+-- name: UpdateYtdlpAutoUpdateSettings :one
+UPDATE settings SET
+    ytdlp_auto_update = $1,
+    ytdlp_update_time = $2,
+    updated_at = NOW()
+WHERE id = 1
+RETURNING *;
+
+-- name: UpdateFormatPolicySettings :one
+UPDATE settings SET
+    default_format_policy = $1,
+    updated_at = NOW()
+WHERE id = 1
+RETURNING *;
@@ -0,0 +1,52 @@
+-- name: ListTags :many
+SELECT t.id, t.name, t.created_at, COUNT(vt.video_id) AS video_count
+FROM tags t
+LEFT JOIN video_tags vt ON vt.tag_id = t.id
+GROUP BY t.id
+ORDER BY t.name;
+
+-- name: GetTag :one
+SELECT * FROM tags
+WHERE id = $1 LIMIT 1;
+
+-- name: ListTagsByName :many
+SELECT * FROM tags
+WHERE name = ANY(sqlc.arg('names')::text[]);
+
+-- name: UpsertTag :one
+INSERT INTO tags (name) VALUES ($1)
+ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+RETURNING *;
+
+-- name: RenameTag :one
+UPDATE tags
+  set name = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteTag :exec
+DELETE FROM tags
+WHERE id = $1;
+
+-- name: ListTagsForVideos :many
+SELECT vt.video_id, t.name
+FROM video_tags vt
+JOIN tags t ON t.id = vt.tag_id
+WHERE vt.video_id = ANY(sqlc.arg('video_ids')::uuid[])
+ORDER BY t.name;
+
+-- name: AddVideoTags :exec
+INSERT INTO video_tags (video_id, tag_id)
+SELECT v, t
+FROM unnest(sqlc.arg('video_ids')::uuid[]) AS v
+CROSS JOIN unnest(sqlc.arg('tag_ids')::uuid[]) AS t
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveVideoTags :exec
+DELETE FROM video_tags
+WHERE video_id = ANY(sqlc.arg('video_ids')::uuid[])
+  AND tag_id = ANY(sqlc.arg('tag_ids')::uuid[]);
+
+-- name: ClearVideoTags :exec
+DELETE FROM video_tags
+WHERE video_id = $1;
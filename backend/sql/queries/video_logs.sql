@@ -0,0 +1,12 @@
+-- name: CreateVideoLog :one
+INSERT INTO video_logs (
+    video_id, command, output, exit_code
+) VALUES (
+    $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: ListVideoLogs :many
+SELECT * FROM video_logs
+WHERE video_id = $1
+ORDER BY created_at ASC;
@@ -1,8 +1,8 @@
 -- name: CreateVideo :one
 INSERT INTO videos (
-    name, file_name, thumbnail_file_name, original_url, download_status
+    name, file_name, thumbnail_file_name, original_url, download_status, download_options
 ) VALUES (
-    $1, $2, $3, $4, $5
+    $1, $2, $3, $4, $5, $6
 )
 RETURNING *;
 
@@ -11,20 +11,106 @@ SELECT * FROM videos
 WHERE id = $1 LIMIT 1;
 
 -- name: ListVideos :many
-SELECT * FROM videos
-WHERE (name ILIKE '%' || sqlc.arg('search') || '%' OR original_url ILIKE '%' || sqlc.arg('search') || '%')
+-- Filters are applied by filter_videos, which ignores arguments that are NULL (or an empty array). With a
+-- cursor_id only rows after the cursor position in the current ordering are returned (keyset pagination);
+-- the cursor value matching the ordering's sort key is passed in cursor_time, cursor_text, cursor_size or
+-- cursor_num. The size and duration keys are compared as the expressions indexed in migration 000013.
+SELECT * FROM filter_videos(
+    sqlc.narg('search')::text, sqlc.arg('statuses')::text[],
+    sqlc.narg('created_after')::timestamptz, sqlc.narg('created_before')::timestamptz,
+    sqlc.narg('min_size')::bigint, sqlc.narg('max_size')::bigint,
+    sqlc.narg('min_duration')::float8, sqlc.narg('max_duration')::float8,
+    sqlc.narg('uploader')::text, sqlc.narg('extractor')::text, sqlc.narg('codec')::text,
+    sqlc.arg('tags')::text[], sqlc.narg('watch')::text, sqlc.arg('viewer')::text
+) AS videos
+WHERE (sqlc.narg('cursor_id')::uuid IS NULL OR CASE sqlc.arg('ordering')::text
+    WHEN 'name_asc' THEN (name, id) > (sqlc.narg('cursor_text')::text, sqlc.narg('cursor_id')::uuid)
+    WHEN 'name_desc' THEN (name, id) < (sqlc.narg('cursor_text')::text, sqlc.narg('cursor_id')::uuid)
+    WHEN 'created_at_asc' THEN (created_at, id) > (sqlc.narg('cursor_time')::timestamptz, sqlc.narg('cursor_id')::uuid)
+    WHEN 'status_asc' THEN (download_status, id) > (sqlc.narg('cursor_text')::text, sqlc.narg('cursor_id')::uuid)
+    WHEN 'status_desc' THEN (download_status, id) < (sqlc.narg('cursor_text')::text, sqlc.narg('cursor_id')::uuid)
+    WHEN 'size_asc' THEN (COALESCE(file_size, -1), id) > (sqlc.narg('cursor_size')::bigint, sqlc.narg('cursor_id')::uuid)
+    WHEN 'size_desc' THEN (COALESCE(file_size, -1), id) < (sqlc.narg('cursor_size')::bigint, sqlc.narg('cursor_id')::uuid)
+    WHEN 'duration_asc' THEN (COALESCE(duration, -1), id) > (sqlc.narg('cursor_num')::float8, sqlc.narg('cursor_id')::uuid)
+    WHEN 'duration_desc' THEN (COALESCE(duration, -1), id) < (sqlc.narg('cursor_num')::float8, sqlc.narg('cursor_id')::uuid)
+    ELSE (created_at, id) < (sqlc.narg('cursor_time')::timestamptz, sqlc.narg('cursor_id')::uuid)
+  END)
 ORDER BY 
     CASE WHEN sqlc.arg('ordering') = 'name_asc' THEN name END ASC,
     CASE WHEN sqlc.arg('ordering') = 'name_desc' THEN name END DESC,
     CASE WHEN sqlc.arg('ordering') = 'created_at_asc' THEN created_at END ASC,
     CASE WHEN sqlc.arg('ordering') = 'status_asc' THEN download_status END ASC,
     CASE WHEN sqlc.arg('ordering') = 'status_desc' THEN download_status END DESC,
-    CASE WHEN sqlc.arg('ordering') = 'created_at_desc' OR sqlc.arg('ordering') = '' OR sqlc.arg('ordering') IS NULL THEN created_at END DESC
+    CASE WHEN sqlc.arg('ordering') = 'size_asc' THEN COALESCE(file_size, -1) END ASC,
+    CASE WHEN sqlc.arg('ordering') = 'size_desc' THEN COALESCE(file_size, -1) END DESC,
+    CASE WHEN sqlc.arg('ordering') = 'duration_asc' THEN COALESCE(duration, -1) END ASC,
+    CASE WHEN sqlc.arg('ordering') = 'duration_desc' THEN COALESCE(duration, -1) END DESC,
+    CASE WHEN sqlc.arg('ordering') = 'created_at_desc' OR sqlc.arg('ordering') = '' OR sqlc.arg('ordering') IS NULL THEN created_at END DESC,
+    CASE WHEN sqlc.arg('ordering') IN ('name_asc', 'created_at_asc', 'status_asc', 'size_asc', 'duration_asc') THEN id END ASC,
+    id DESC
 LIMIT $1 OFFSET $2;
 
 -- name: CountVideos :one
-SELECT COUNT(*) FROM videos
-WHERE (name ILIKE '%' || sqlc.arg('search') || '%' OR original_url ILIKE '%' || sqlc.arg('search') || '%');
+SELECT COUNT(*) FROM filter_videos(
+    sqlc.narg('search')::text, sqlc.arg('statuses')::text[],
+    sqlc.narg('created_after')::timestamptz, sqlc.narg('created_before')::timestamptz,
+    sqlc.narg('min_size')::bigint, sqlc.narg('max_size')::bigint,
+    sqlc.narg('min_duration')::float8, sqlc.narg('max_duration')::float8,
+    sqlc.narg('uploader')::text, sqlc.narg('extractor')::text, sqlc.narg('codec')::text,
+    sqlc.arg('tags')::text[], sqlc.narg('watch')::text, sqlc.arg('viewer')::text
+);
+
+-- name: ListFilteredVideoIDs :many
+SELECT id FROM filter_videos(
+    sqlc.narg('search')::text, sqlc.arg('statuses')::text[],
+    sqlc.narg('created_after')::timestamptz, sqlc.narg('created_before')::timestamptz,
+    sqlc.narg('min_size')::bigint, sqlc.narg('max_size')::bigint,
+    sqlc.narg('min_duration')::float8, sqlc.narg('max_duration')::float8,
+    sqlc.narg('uploader')::text, sqlc.narg('extractor')::text, sqlc.narg('codec')::text,
+    sqlc.arg('tags')::text[], sqlc.narg('watch')::text, sqlc.arg('viewer')::text
+)
+ORDER BY created_at DESC
+LIMIT $1;
+
+-- name: SearchVideos :many
+SELECT sqlc.embed(v),
+    ts_rank_cd(s.document, q.query)::real AS rank,
+    ts_headline('english', concat_ws(' … ', v.name, v.description, nullif(s.subtitle_text, '')), q.query,
+        'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5')::text AS snippet
+FROM videos v
+JOIN video_search s ON s.video_id = v.id
+CROSS JOIN websearch_to_tsquery('english', sqlc.arg('query')) AS q(query)
+WHERE s.document @@ q.query
+  AND v.id IN (SELECT id FROM filter_videos(
+      '', sqlc.arg('statuses')::text[],
+      sqlc.narg('created_after')::timestamptz, sqlc.narg('created_before')::timestamptz,
+      sqlc.narg('min_size')::bigint, sqlc.narg('max_size')::bigint,
+      sqlc.narg('min_duration')::float8, sqlc.narg('max_duration')::float8,
+      sqlc.narg('uploader')::text, sqlc.narg('extractor')::text, sqlc.narg('codec')::text,
+      sqlc.arg('tags')::text[], sqlc.narg('watch')::text, sqlc.arg('viewer')::text
+  ))
+ORDER BY rank DESC, v.created_at DESC
+LIMIT $1 OFFSET $2;
+
+-- name: CountSearchVideos :one
+SELECT COUNT(*) FROM videos v
+JOIN video_search s ON s.video_id = v.id
+WHERE s.document @@ websearch_to_tsquery('english', sqlc.arg('query'))
+  AND v.id IN (SELECT id FROM filter_videos(
+      '', sqlc.arg('statuses')::text[],
+      sqlc.narg('created_after')::timestamptz, sqlc.narg('created_before')::timestamptz,
+      sqlc.narg('min_size')::bigint, sqlc.narg('max_size')::bigint,
+      sqlc.narg('min_duration')::float8, sqlc.narg('max_duration')::float8,
+      sqlc.narg('uploader')::text, sqlc.narg('extractor')::text, sqlc.narg('codec')::text,
+      sqlc.arg('tags')::text[], sqlc.narg('watch')::text, sqlc.arg('viewer')::text
+  ));
+
+-- name: SetVideoSubtitles :exec
+INSERT INTO video_search (video_id, subtitle_text, document)
+VALUES ($1, $2, video_search_document($1, $2))
+ON CONFLICT (video_id) DO UPDATE SET
+    subtitle_text = EXCLUDED.subtitle_text,
+    document = EXCLUDED.document;
 
 -- name: UpdateVideoStatus :one
 UPDATE videos
@@ -51,4 +137,133 @@ RETURNING *;
 
 -- name: DeleteVideo :exec
 DELETE FROM videos
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: UpdateVideoPinned :one
+UPDATE videos
+  set pinned = $2,
+  updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: ListAllVideos :many
+SELECT * FROM videos
+ORDER BY created_at DESC;
+
+-- name: UpdateVideoMetadata :one
+UPDATE videos
+  set external_id = $2,
+  uploader = $3,
+  upload_date = $4,
+  extractor = $5,
+  description = $6,
+  duration = $7,
+  updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: UpdateVideoCodec :exec
+UPDATE videos
+  set video_codec = $2
+WHERE id = $1;
+
+-- name: UpdateVideoDownloadOptions :exec
+UPDATE videos
+  set download_options = $2
+WHERE id = $1;
+
+-- name: UpdateVideoSprite :exec
+UPDATE videos
+  set sprite_file_name = $2,
+  sprite_interval = $3,
+  sprite_columns = $4,
+  sprite_count = $5,
+  updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpdateVideoMediaInfo :exec
+UPDATE videos
+  set media_info = sqlc.arg('media_info'),
+  width = sqlc.arg('width'),
+  height = sqlc.arg('height'),
+  bitrate = sqlc.arg('bitrate'),
+  audio_codec = sqlc.arg('audio_codec'),
+  hdr = sqlc.arg('hdr'),
+  video_codec = COALESCE(sqlc.narg('video_codec'), video_codec),
+  duration = COALESCE(sqlc.narg('duration'), duration)
+WHERE id = sqlc.arg('id');
+
+-- name: UpdateVideoChapters :exec
+UPDATE videos
+  set chapters = $2
+WHERE id = $1;
+
+-- name: ListVideosMissingMediaInfo :many
+SELECT * FROM videos
+WHERE download_status = 'completed'
+  AND file_name IS NOT NULL
+  AND media_info IS NULL
+  AND deleted_at IS NULL
+ORDER BY created_at;
+
+-- name: GetVideosByIDs :many
+SELECT * FROM videos
+WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
+-- name: DeleteVideos :many
+DELETE FROM videos
+WHERE id = ANY(sqlc.arg('ids')::uuid[])
+RETURNING *;
+
+-- name: TrashVideo :one
+UPDATE videos
+  set deleted_at = NOW(),
+  file_name = $2,
+  thumbnail_file_name = $3,
+  sprite_file_name = $4,
+  updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: RestoreVideo :one
+UPDATE videos
+  set deleted_at = NULL,
+  file_name = $2,
+  thumbnail_file_name = $3,
+  sprite_file_name = $4,
+  updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: ListTrashedVideos :many
+SELECT * FROM videos
+WHERE deleted_at IS NOT NULL
+ORDER BY deleted_at DESC, id DESC
+LIMIT $1 OFFSET $2;
+
+-- name: CountTrashedVideos :one
+SELECT COUNT(*) FROM videos
+WHERE deleted_at IS NOT NULL;
+
+-- name: ListExpiredTrash :many
+SELECT * FROM videos
+WHERE deleted_at < sqlc.arg('before')::timestamptz
+ORDER BY deleted_at;
+
+-- name: ScheduleVideo :one
+UPDATE videos
+  set download_status = 'scheduled',
+  scheduled_at = $2,
+  updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: ListScheduledVideos :many
+SELECT * FROM videos
+WHERE download_status = 'scheduled' AND deleted_at IS NULL
+ORDER BY created_at;
+
+-- name: RescheduleVideos :exec
+UPDATE videos
+  set scheduled_at = $1
+WHERE download_status = 'scheduled' AND scheduled_at IS DISTINCT FROM $1;
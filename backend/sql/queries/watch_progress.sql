@@ -0,0 +1,49 @@
+-- name: GetWatchProgress :one
+SELECT * FROM watch_progress
+WHERE video_id = $1 AND viewer = $2 LIMIT 1;
+
+-- name: UpsertWatchProgress :one
+INSERT INTO watch_progress (
+    video_id, viewer, position, watched
+) VALUES (
+    $1, $2, $3, $4
+)
+ON CONFLICT (video_id, viewer) DO UPDATE SET
+    position = EXCLUDED.position,
+    watched = EXCLUDED.watched,
+    last_watched_at = NOW()
+RETURNING *;
+
+-- name: DeleteWatchProgress :exec
+DELETE FROM watch_progress
+WHERE video_id = $1 AND viewer = $2;
+
+-- name: ListWatchProgressForVideos :many
+SELECT * FROM watch_progress
+WHERE viewer = sqlc.arg('viewer')
+  AND video_id = ANY(sqlc.arg('video_ids')::uuid[]);
+
+-- name: ListWatchHistory :many
+-- state filters to in_progress (started but not watched) or watched videos; NULL returns both
+SELECT sqlc.embed(v), sqlc.embed(wp)
+FROM watch_progress wp
+JOIN videos v ON v.id = wp.video_id
+WHERE wp.viewer = sqlc.arg('viewer')
+  AND v.deleted_at IS NULL
+  AND (sqlc.narg('state')::text IS NULL OR CASE sqlc.narg('state')::text
+    WHEN 'in_progress' THEN NOT wp.watched AND wp.position > 0
+    ELSE wp.watched
+  END)
+ORDER BY wp.last_watched_at DESC
+LIMIT $1 OFFSET $2;
+
+-- name: CountWatchHistory :one
+SELECT COUNT(*)
+FROM watch_progress wp
+JOIN videos v ON v.id = wp.video_id
+WHERE wp.viewer = sqlc.arg('viewer')
+  AND v.deleted_at IS NULL
+  AND (sqlc.narg('state')::text IS NULL OR CASE sqlc.narg('state')::text
+    WHEN 'in_progress' THEN NOT wp.watched AND wp.position > 0
+    ELSE wp.watched
+  END);
@@ -0,0 +1,17 @@
+//go:build windows
+
+package utils
+
+import "golang.org/x/sys/windows"
+
+// GetDiskSpace returns the bytes available to the current user and the total size of the volume containing path
+func GetDiskSpace(path string) (free uint64, total uint64, err error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := windows.GetDiskFreeSpaceEx(pathPtr, &free, &total, nil); err != nil {
+		return 0, 0, err
+	}
+	return free, total, nil
+}
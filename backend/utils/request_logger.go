@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// RequestLogger logs every HTTP request with its status, size and duration.
+// Successful requests are logged at debug level to keep polling endpoints quiet.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+
+		next.ServeHTTP(ww, r)
+
+		level := slog.LevelDebug
+		if ww.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		} else if ww.Status() >= http.StatusBadRequest {
+			level = slog.LevelWarn
+		}
+
+		slog.Log(r.Context(), level, "HTTP request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", ww.Status(),
+			"bytes", ww.BytesWritten(),
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
@@ -21,13 +21,45 @@ import globalAxios from 'axios';
 import { DUMMY_BASE_URL, assertParamExists, setApiKeyToObject, setBasicAuthToObject, setBearerAuthToObject, setOAuthToObject, setSearchParams, serializeDataIfNeeded, toPathString, createRequestFunction } from '../common';
 // @ts-ignore
 import { BASE_PATH, COLLECTION_FORMATS, type RequestArgs, BaseAPI, RequiredError, operationServerMap } from '../base';
+// @ts-ignore
+import type { ServicesYtdlpUpdateStatusDTO } from '../models';
 /**
  * YtdlpApi - axios parameter creator
  */
 export const YtdlpApiAxiosParamCreator = function (configuration?: Configuration) {
     return {
         /**
-         * Execute yt-dlp -U to update the binary
+         * Get the output and result of the current or last yt-dlp update or rollback
+         * @summary Get yt-dlp update status
+         * @param {*} [options] Override http request option.
+         * @throws {RequiredError}
+         */
+        getYtdlpUpdateStatus: async (options: RawAxiosRequestConfig = {}): Promise<RequestArgs> => {
+            const localVarPath = `/api/yt-dlp/update`;
+            // use dummy base URL string because the URL constructor only accepts absolute URLs.
+            const localVarUrlObj = new URL(localVarPath, DUMMY_BASE_URL);
+            let baseOptions;
+            if (configuration) {
+                baseOptions = configuration.baseOptions;
+            }
+
+            const localVarRequestOptions = { method: 'GET', ...baseOptions, ...options};
+            const localVarHeaderParameter = {} as any;
+            const localVarQueryParameter = {} as any;
+
+            localVarHeaderParameter['Accept'] = 'application/json';
+
+            setSearchParams(localVarUrlObj, localVarQueryParameter);
+            let headersFromBaseOptions = baseOptions && baseOptions.headers ? baseOptions.headers : {};
+            localVarRequestOptions.headers = {...localVarHeaderParameter, ...headersFromBaseOptions, ...options.headers};
+
+            return {
+                url: toPathString(localVarUrlObj),
+                options: localVarRequestOptions,
+            };
+        },
+        /**
+         * Install the pinned version, or the latest release of the channel, in the background. Output is streamed as ytdlp_update WebSocket events. If the new binary fails a --version smoke test the previous one is restored.
          * @summary Update yt-dlp
          * @param {*} [options] Override http request option.
          * @throws {RequiredError}
@@ -66,12 +98,24 @@ export const YtdlpApiFp = function(configuration?: Configuration) {
     const localVarAxiosParamCreator = YtdlpApiAxiosParamCreator(configuration)
     return {
         /**
-         * Execute yt-dlp -U to update the binary
+         * Get the output and result of the current or last yt-dlp update or rollback
+         * @summary Get yt-dlp update status
+         * @param {*} [options] Override http request option.
+         * @throws {RequiredError}
+         */
+        async getYtdlpUpdateStatus(options?: RawAxiosRequestConfig): Promise<(axios?: AxiosInstance, basePath?: string) => AxiosPromise<ServicesYtdlpUpdateStatusDTO>> {
+            const localVarAxiosArgs = await localVarAxiosParamCreator.getYtdlpUpdateStatus(options);
+            const localVarOperationServerIndex = configuration?.serverIndex ?? 0;
+            const localVarOperationServerBasePath = operationServerMap['YtdlpApi.getYtdlpUpdateStatus']?.[localVarOperationServerIndex]?.url;
+            return (axios, basePath) => createRequestFunction(localVarAxiosArgs, globalAxios, BASE_PATH, configuration)(axios, localVarOperationServerBasePath || basePath);
+        },
+        /**
+         * Install the pinned version, or the latest release of the channel, in the background. Output is streamed as ytdlp_update WebSocket events. If the new binary fails a --version smoke test the previous one is restored.
          * @summary Update yt-dlp
          * @param {*} [options] Override http request option.
          * @throws {RequiredError}
          */
-        async updateYtdlp(options?: RawAxiosRequestConfig): Promise<(axios?: AxiosInstance, basePath?: string) => AxiosPromise<{ [key: string]: string; }>> {
+        async updateYtdlp(options?: RawAxiosRequestConfig): Promise<(axios?: AxiosInstance, basePath?: string) => AxiosPromise<ServicesYtdlpUpdateStatusDTO>> {
             const localVarAxiosArgs = await localVarAxiosParamCreator.updateYtdlp(options);
             const localVarOperationServerIndex = configuration?.serverIndex ?? 0;
             const localVarOperationServerBasePath = operationServerMap['YtdlpApi.updateYtdlp']?.[localVarOperationServerIndex]?.url;
@@ -87,12 +131,21 @@ export const YtdlpApiFactory = function (configuration?: Configuration, basePath
     const localVarFp = YtdlpApiFp(configuration)
     return {
         /**
-         * Execute yt-dlp -U to update the binary
+         * Get the output and result of the current or last yt-dlp update or rollback
+         * @summary Get yt-dlp update status
+         * @param {*} [options] Override http request option.
+         * @throws {RequiredError}
+         */
+        getYtdlpUpdateStatus(options?: RawAxiosRequestConfig): AxiosPromise<ServicesYtdlpUpdateStatusDTO> {
+            return localVarFp.getYtdlpUpdateStatus(options).then((request) => request(axios, basePath));
+        },
+        /**
+         * Install the pinned version, or the latest release of the channel, in the background. Output is streamed as ytdlp_update WebSocket events. If the new binary fails a --version smoke test the previous one is restored.
          * @summary Update yt-dlp
          * @param {*} [options] Override http request option.
          * @throws {RequiredError}
          */
-        updateYtdlp(options?: RawAxiosRequestConfig): AxiosPromise<{ [key: string]: string; }> {
+        updateYtdlp(options?: RawAxiosRequestConfig): AxiosPromise<ServicesYtdlpUpdateStatusDTO> {
             return localVarFp.updateYtdlp(options).then((request) => request(axios, basePath));
         },
     };
@@ -103,7 +156,17 @@ export const YtdlpApiFactory = function (configuration?: Configuration, basePath
  */
 export class YtdlpApi extends BaseAPI {
     /**
-     * Execute yt-dlp -U to update the binary
+     * Get the output and result of the current or last yt-dlp update or rollback
+     * @summary Get yt-dlp update status
+     * @param {*} [options] Override http request option.
+     * @throws {RequiredError}
+     */
+    public getYtdlpUpdateStatus(options?: RawAxiosRequestConfig) {
+        return YtdlpApiFp(this.configuration).getYtdlpUpdateStatus(options).then((request) => request(this.axios, this.basePath));
+    }
+
+    /**
+     * Install the pinned version, or the latest release of the channel, in the background. Output is streamed as ytdlp_update WebSocket events. If the new binary fails a --version smoke test the previous one is restored.
      * @summary Update yt-dlp
      * @param {*} [options] Override http request option.
      * @throws {RequiredError}
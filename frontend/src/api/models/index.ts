@@ -13,3 +13,4 @@ export * from './services-download-progress-dto';
 export * from './services-download-status';
 export * from './services-video-metadata';
 export * from './services-video-option';
+export * from './services-ytdlp-update-status-dto';
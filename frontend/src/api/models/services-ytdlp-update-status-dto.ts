@@ -0,0 +1,36 @@
+/* tslint:disable */
+/* eslint-disable */
+/**
+ * Vidra API
+ * REST API for Vidra video downloader and manager
+ *
+ * The version of the OpenAPI document: 1.0
+ * Contact: martin.yordanov@vexbyte.com
+ *
+ * NOTE: This class is auto generated by OpenAPI Generator (https://openapi-generator.tech).
+ * https://openapi-generator.tech
+ * Do not edit the class manually.
+ */
+
+
+
+export interface ServicesYtdlpUpdateStatusDTO {
+    'error'?: string;
+    'finishedAt'?: string;
+    'fromVersion'?: string;
+    'output'?: string;
+    /**
+     * a manual rollback to the previous version rather than an update
+     */
+    'rollback'?: boolean;
+    /**
+     * the new binary failed the smoke test and the old one was restored
+     */
+    'rolledBack'?: boolean;
+    'running'?: boolean;
+    'startedAt'?: string;
+    'target'?: string;
+    'toVersion'?: string;
+    'trigger'?: string;
+}
+